@@ -6,20 +6,29 @@ import (
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
-	"github.com/gogo/protobuf/proto"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/api"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/controller"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/gcp"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/groups"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/iam"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/notify"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/util"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/watcher"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
-	admin "google.golang.org/api/admin/directory/v1"
-	settingsSdk "google.golang.org/api/groupssettings/v1"
+	"golang.org/x/oauth2/google"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"io/ioutil"
 	"net/http"
+	"net/smtp"
 	"os"
 	"path/filepath"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"strings"
 	"time"
 )
@@ -32,16 +41,84 @@ type RunOptions struct{
 	Continuous bool
 	SyncPeriod time.Duration
 	ForcedResyncPreiod time.Duration
+	Debounce time.Duration
+	UsePolling bool
+	WriteStatus bool
+	StatusDir string
+	StatusReport string
+	ServiceAccountKey string
+	Subject string
+	AuthFlow string
+	MetricsAddr string
+	SecretKeepVersions int
+	SecretPrune string
+	TokenKey string
+	OldTokenKeys []string
+	KubeSecret string
+}
+
+type ControllerOptions struct{
+	Namespace string
+	MetricsAddr string
+	EnableLeaderElection bool
+	ResyncPeriod time.Duration
+}
+
+type NotifyOptions struct{
+	WebhookURL string
+	SMTPAddr string
+	SMTPFrom string
+	SMTPUsername string
+	Templates string
+}
+
+type ValidateOptions struct{
+	ExpiryWarning time.Duration
+	ImportConfig string
+	IAMPolicies string
+	Domain string
+}
+
+type UpgradeOptions struct{
+	Transformations string
+	DryRun bool
+}
+
+type DriftOptions struct{
+	Format string
+}
+
+type DiffOptions struct{
+	Base string
+	Head string
+	Path string
+}
+
+type IAMOptions struct{
+	Input string
+	Format string
+	DryRun bool
+	Report string
 }
 
 type ImportOptions struct{
 	Output string
 	Domain string
+	Config string
+	Merge bool
+	Groups []string
 }
 
 var (
 	opts = RunOptions{}
 	iOpts = ImportOptions{}
+	cOpts = ControllerOptions{}
+	nOpts = NotifyOptions{}
+	vOpts = ValidateOptions{}
+	uOpts = UpgradeOptions{}
+	dOpts = DriftOptions{}
+	diffOpts = DiffOptions{}
+	iamOpts = IAMOptions{}
 
 	rootCmd    = &cobra.Command{}
 
@@ -69,40 +146,220 @@ var (
 		},
 	}
 
-	log logr.Logger
+	validateCmd  = &cobra.Command{
+		Use:   "validate",
+		Short: "Validate group specs. Exits non-zero if there are errors.",
+		Run: func(cmd *cobra.Command, args []string) {
+			validate()
+		},
+	}
+
+	expireCmd  = &cobra.Command{
+		Use:   "expire",
+		Short: "Remove expired memberships from the group specs.",
+		Run: func(cmd *cobra.Command, args []string) {
+			expire()
+		},
+	}
+
+	driftCmd  = &cobra.Command{
+		Use:   "drift",
+		Short: "Report where Google Groups differ from the group specs. Exits 1 if there is drift and 2 if the report couldn't be generated.",
+		Run: func(cmd *cobra.Command, args []string) {
+			drift()
+		},
+	}
+
+	diffCmd  = &cobra.Command{
+		Use:   "diff",
+		Short: "Print the changes between two revisions of the group specs as Markdown. Doesn't contact Google.",
+		Run: func(cmd *cobra.Command, args []string) {
+			diffSpecs()
+		},
+	}
+
+	controllerCmd  = &cobra.Command{
+		Use:   "controller",
+		Short: "Run a Kubernetes controller that syncs GoogleGroup custom resources.",
+		Run: func(cmd *cobra.Command, args []string) {
+			runController()
+		},
+	}
+
+	authCmd  = &cobra.Command{
+		Use:   "auth",
+		Short: "Manage the cached OAuth2 credential.",
+	}
+
+	authLoginCmd  = &cobra.Command{
+		Use:   "login",
+		Short: "Run the OAuth2 flow, asking for consent again, and save the new token to the token cache.",
+		Run: func(cmd *cobra.Command, args []string) {
+			authLogin()
+		},
+	}
+
+	authStatusCmd  = &cobra.Command{
+		Use:   "status",
+		Short: "Show the scopes and expiry of the cached token and whether it can be refreshed. Exits 1 if it can't.",
+		Run: func(cmd *cobra.Command, args []string) {
+			authStatus()
+		},
+	}
+
+	authRevokeCmd  = &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke the cached credential and clear the token cache.",
+		Run: func(cmd *cobra.Command, args []string) {
+			authRevoke()
+		},
+	}
 
-	scopes = []string {
-		admin.AdminDirectoryGroupMemberScope,
-		admin.AdminDirectoryGroupScope,
-		admin.CloudPlatformScope,
-		settingsSdk.AppsGroupsSettingsScope,
+	iamCmd  = &cobra.Command{
+		Use:   "iam",
+		Short: "Plan and apply the IAM policies of GCP projects from {project}.iam.policy.yaml files.",
 	}
+
+	iamPlanCmd  = &cobra.Command{
+		Use:   "plan",
+		Short: "Print the changes applying the IAM policy files would make. Exits 1 if there are changes and 2 if there are errors e.g. an etag mismatch.",
+		Run: func(cmd *cobra.Command, args []string) {
+			iamPlan()
+		},
+	}
+
+	iamApplyCmd  = &cobra.Command{
+		Use:   "apply",
+		Short: "Apply the IAM policy files and update their etags. A policy is only applied if its etag matches the live policy. Exits 1 if any policy failed.",
+		Run: func(cmd *cobra.Command, args []string) {
+			iamApply()
+		},
+	}
+
+	log logr.Logger
+
+	// scopes are the OAuth2 scopes requested for the token. Each command sets the minimal scopes it needs and
+	// getAdminClient checks that the token carries them.
+	scopes []string
 )
 
 func init() {
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(upgradeCmd)
 	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(controllerCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(expireCmd)
+	rootCmd.AddCommand(driftCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authStatusCmd)
+	authCmd.AddCommand(authRevokeCmd)
+	rootCmd.AddCommand(iamCmd)
+	iamCmd.AddCommand(iamPlanCmd)
+	iamCmd.AddCommand(iamApplyCmd)
 
 	upgradeCmd.Flags().StringVarP(&opts.Input, "input", "", "", "A glob to match config files to upgrade.")
-	upgradeCmd.Flags().StringVarP(&iOpts.Output, "output", "", "", "The directory to write the Group specs to")
+	upgradeCmd.Flags().StringVarP(&iOpts.Output, "output", "", "", "The directory to write the Group specs to. Defaults to the directory containing the input")
+	upgradeCmd.Flags().StringVarP(&uOpts.Transformations, "transformations", "", "", "YAML file listing the transformations to apply")
+	upgradeCmd.Flags().BoolVarP(&uOpts.DryRun, "dry-run", "", false, "If true only print a diff of the changes without writing them")
 	upgradeCmd.MarkFlagRequired("input")
-	upgradeCmd.MarkFlagRequired("output")
+	upgradeCmd.MarkFlagRequired("transformations")
 
 	runCmd.Flags().StringVarP(&opts.Input, "input", "", "", "A glob to match config files to apply.")
 
-	runCmd.Flags().StringVarP(&opts.CredentialsFile, "credentials-file", "", "", "JSON File containing OAuth2Client credentials as downloaded from APIConsole. Can be a GCS file.")
+	runCmd.Flags().StringVarP(&opts.CredentialsFile, "credentials-file", "", "", "JSON File containing OAuth2Client credentials as downloaded from APIConsole. Can be a GCS file or a https:// URL.")
 	runCmd.Flags().StringVarP(&opts.Secret, "secret", "", "", "The name of a secret in GCP secret manager where the OAuth2 token should be cached. Should be in the form {project}/{secret}")
 	runCmd.Flags().BoolVarP(&opts.Continuous, "continuous", "", false, "If true runs forever; resyncing the groups whenever a change is detected")
-	runCmd.Flags().DurationVarP(&opts.SyncPeriod, "sync-period", "", 30 * time.Second, "How often to check for changes. This should be O(seconds)")
+	runCmd.Flags().DurationVarP(&opts.SyncPeriod, "sync-period", "", 30 * time.Second, "How often to poll for changes when filesystem events aren't used and how long to wait before first retrying a failed sync; the wait doubles after each failure up to --forced-sync-period. This should be O(seconds)")
 	runCmd.Flags().DurationVarP(&opts.ForcedResyncPreiod, "forced-sync-period", "", 4 * time.Hour, "How often to resync even when no changes have been detected. Should be on the order of hours")
+	runCmd.Flags().DurationVarP(&opts.Debounce, "debounce", "", watcher.DefaultDebounce, "How long to wait for a burst of filesystem events to settle before syncing")
+	runCmd.Flags().BoolVarP(&opts.WriteStatus, "write-status", "", false, "If true write a copy of each group's YAML spec including its observed status to --status-dir")
+	runCmd.Flags().StringVarP(&opts.StatusDir, "status-dir", "", "", "The directory --write-status writes the specs with their status to. Required with --write-status; it must not be the directory of --input, so use a directory outside the git-synced checkout")
+	runCmd.Flags().StringVarP(&opts.StatusReport, "status-report", "", "", "If set write a report of the observed status of all groups to this file. Written as JSON if the file ends in .json and YAML otherwise")
+	runCmd.Flags().StringVarP(&opts.MetricsAddr, "metrics-addr", "", "", "If set serve Prometheus metrics (e.g. revoked credentials) on this address when running continuously")
+	runCmd.Flags().BoolVarP(&opts.UsePolling, "use-polling", "", false, "If true poll for changes instead of using filesystem events. Use this on filesystems where events are unreliable")
 
 	importCmd.Flags().StringVarP(&opts.CredentialsFile, "credentials-file", "", "", "JSON File containing OAuth2Client credentials as downloaded from APIConsole.")
 	importCmd.Flags().StringVarP(&iOpts.Domain, "domain", "", "kubeflow.org", "The domain containing the Google groups to import")
 	importCmd.Flags().StringVarP(&iOpts.Output, "output", "", "", "The directory to write the results to")
+	importCmd.Flags().StringVarP(&iOpts.Config, "import-config", "", "", "YAML file with the allowlist of groups whose members can be imported and the consent records of members. If not set no members are imported")
+	importCmd.Flags().BoolVarP(&iOpts.Merge, "merge", "", false, "If true only write groups that don't have a spec in the output directory yet; differences between existing specs and Google Groups are reported instead of overwriting the specs")
+	importCmd.Flags().StringSliceVarP(&iOpts.Groups, "group", "", []string{}, "Email of a group to import. Can be repeated. If not set all groups in the domain are imported")
 	importCmd.MarkFlagRequired("input")
 	importCmd.MarkFlagRequired("output")
 	importCmd.MarkFlagRequired("domain")
+
+	validateCmd.Flags().StringVarP(&opts.Input, "input", "", "", "A glob to match config files to validate.")
+	validateCmd.Flags().DurationVarP(&vOpts.ExpiryWarning, "expiry-warning", "", 14 * 24 * time.Hour, "Warn about memberships expiring within this period")
+	validateCmd.Flags().StringVarP(&vOpts.ImportConfig, "import-config", "", "", "If set check the consent records in this import config and warn about members who haven't consented")
+	validateCmd.Flags().StringVarP(&vOpts.IAMPolicies, "iam-policies", "", "", "If set a glob matching IAM policy files whose bindings are checked against the group specs")
+	validateCmd.Flags().StringVarP(&vOpts.Domain, "domain", "", "kubeflow.org", "The domain of the groups defined by the group specs")
+	validateCmd.MarkFlagRequired("input")
+
+	expireCmd.Flags().StringVarP(&opts.Input, "input", "", "", "A glob to match config files to remove expired members from.")
+	expireCmd.Flags().StringVarP(&iOpts.Output, "output", "", "", "The directory to write the Group specs to. Defaults to the directory containing the input")
+	expireCmd.MarkFlagRequired("input")
+
+	driftCmd.Flags().StringVarP(&opts.Input, "input", "", "", "A glob to match the config files to compare to Google Groups.")
+	driftCmd.Flags().StringVarP(&opts.CredentialsFile, "credentials-file", "", "", "JSON File containing OAuth2Client credentials as downloaded from APIConsole. Can be a GCS file or a https:// URL.")
+	driftCmd.Flags().StringVarP(&opts.Secret, "secret", "", "", "The name of a secret in GCP secret manager where the OAuth2 token should be cached. Should be in the form {project}/{secret}")
+	driftCmd.Flags().StringVarP(&iOpts.Domain, "domain", "", "kubeflow.org", "The domain containing the Google groups")
+	driftCmd.Flags().StringVarP(&dOpts.Format, "format", "", api.FormatTable, "The format of the report; one of table, json or markdown")
+	driftCmd.MarkFlagRequired("input")
+
+	diffCmd.Flags().StringVarP(&diffOpts.Base, "base", "", "", "Directory or git revision containing the original specs e.g. origin/master")
+	diffCmd.Flags().StringVarP(&diffOpts.Head, "head", "", "", "Directory or git revision containing the changed specs e.g. HEAD")
+	diffCmd.Flags().StringVarP(&diffOpts.Path, "path", "", "groups", "Directory, relative to the current directory, containing the specs in git revisions")
+	diffCmd.MarkFlagRequired("base")
+	diffCmd.MarkFlagRequired("head")
+
+	for _, c := range []*cobra.Command{iamPlanCmd, iamApplyCmd} {
+		c.Flags().StringVarP(&iamOpts.Input, "input", "", "", "A glob to match the {project}.iam.policy.yaml files e.g. ../gcp_iam_policies/*.iam.policy.yaml")
+		c.Flags().StringVarP(&iamOpts.Format, "format", "", api.FormatTable, "The format of the plan; one of table, json or markdown")
+		c.Flags().StringVarP(&iamOpts.Report, "report", "", "", "If set write a record of the planned or applied changes to this file. Written as JSON if the file ends in .json and YAML otherwise")
+		c.MarkFlagRequired("input")
+	}
+	iamApplyCmd.Flags().BoolVarP(&iamOpts.DryRun, "dry-run", "", false, "If true only print the changes without applying them")
+
+	for _, c := range []*cobra.Command{runCmd, controllerCmd, importCmd, driftCmd, iamPlanCmd, iamApplyCmd} {
+		c.Flags().StringVarP(&opts.ServiceAccountKey, "service-account-key", "", "", "JSON key of a service account with domain-wide delegation. Can be a GCS file or a https:// URL. If set it is used instead of the OAuth2 webflow")
+		c.Flags().StringVarP(&opts.Subject, "subject", "", "", "Email of the Google Workspace admin the service account impersonates. Required with --service-account-key")
+	}
+
+	for _, c := range []*cobra.Command{authLoginCmd, authStatusCmd, authRevokeCmd} {
+		c.Flags().StringVarP(&opts.CredentialsFile, "credentials-file", "", "", "JSON File containing OAuth2Client credentials as downloaded from APIConsole. Can be a GCS file or a https:// URL.")
+		c.Flags().StringVarP(&opts.Secret, "secret", "", "", "The name of a secret in GCP secret manager where the OAuth2 token is cached. Should be in the form {project}/{secret}")
+		c.MarkFlagRequired("credentials-file")
+	}
+
+	for _, c := range []*cobra.Command{runCmd, controllerCmd, importCmd, driftCmd, authLoginCmd, authStatusCmd, authRevokeCmd} {
+		c.Flags().StringVarP(&opts.AuthFlow, "auth-flow", "", string(gcp.LoopbackFlow), "OAuth2 flow used when there is no cached token. loopback redirects a local browser to an ephemeral local port; device prints a code to enter on another device and works on headless machines, but Google's device flow doesn't grant the Admin SDK directory scopes so run and import fail with invalid_scope")
+		c.Flags().StringVarP(&opts.KubeSecret, "kube-secret", "", "", "The name of a Kubernetes secret where the OAuth2 token should be cached when running in a cluster. In the form {namespace}/{name} or {name} for the pod's namespace")
+		c.Flags().StringVarP(&opts.TokenKey, "token-encryption-key", "", "", "Encrypt the local token cache with this key. One of file:PATH (key file), env:VAR (base64 key in an environment variable) or passphrase:VAR (passphrase in an environment variable). A plaintext cache is encrypted the next time it is read")
+		c.Flags().StringSliceVarP(&opts.OldTokenKeys, "old-token-encryption-key", "", []string{}, "Previous --token-encryption-key. Can be repeated. A cache encrypted with an old key is re-encrypted with --token-encryption-key")
+	}
+
+	for _, c := range []*cobra.Command{runCmd, controllerCmd, driftCmd, authLoginCmd, authStatusCmd} {
+		c.Flags().IntVarP(&opts.SecretKeepVersions, "secret-keep-versions", "", 3, "Number of most recent versions of --secret to keep when saving a new token. 0 keeps all versions")
+		c.Flags().StringVarP(&opts.SecretPrune, "secret-prune", "", string(gcp.PruneDisable), "What to do with versions of --secret beyond --secret-keep-versions; disable or destroy")
+	}
+
+	for _, c := range []*cobra.Command{runCmd, controllerCmd} {
+		c.Flags().StringVarP(&nOpts.WebhookURL, "webhook-url", "", os.Getenv("GROUPS_WEBHOOK_URL"), "URL of a Slack compatible webhook to post group changes to. Defaults to the environment variable GROUPS_WEBHOOK_URL")
+		c.Flags().StringVarP(&nOpts.SMTPAddr, "smtp-addr", "", "", "Address (host:port) of an SMTP server used to email group changes. If not set no emails are sent")
+		c.Flags().StringVarP(&nOpts.SMTPFrom, "smtp-from", "", "", "The address notification emails are sent from")
+		c.Flags().StringVarP(&nOpts.SMTPUsername, "smtp-username", "", "", "Username for the SMTP server. The password is read from the environment variable SMTP_PASSWORD")
+		c.Flags().StringVarP(&nOpts.Templates, "notification-templates", "", "", "YAML file mapping event types (GroupCreated, MemberAdded, MemberRemoved) to message templates")
+	}
+
+	controllerCmd.Flags().StringVarP(&opts.CredentialsFile, "credentials-file", "", "", "JSON File containing OAuth2Client credentials as downloaded from APIConsole. Can be a GCS file or a https:// URL.")
+	controllerCmd.Flags().StringVarP(&opts.Secret, "secret", "", "", "The name of a secret in GCP secret manager where the OAuth2 token should be cached. Should be in the form {project}/{secret}")
+	controllerCmd.Flags().StringVarP(&cOpts.Namespace, "namespace", "", "", "The namespace to watch for GoogleGroup resources. Defaults to all namespaces")
+	controllerCmd.Flags().StringVarP(&cOpts.MetricsAddr, "metrics-addr", "", ":8080", "The address the metric endpoint binds to")
+	controllerCmd.Flags().BoolVarP(&cOpts.EnableLeaderElection, "enable-leader-election", "", false, "Enable leader election so only one replica syncs groups at a time")
+	controllerCmd.Flags().DurationVarP(&cOpts.ResyncPeriod, "resync-period", "", 4 * time.Hour, "How often to resync a group even when its spec hasn't changed. Should be on the order of hours")
 }
 
 func initLogger() {
@@ -134,6 +391,9 @@ func getWebFlowLocal() *gcp.CachedCredentialHelper {
 		return nil
 	}
 
+	webFlow.Flow = gcp.AuthFlow(opts.AuthFlow)
+	webFlow.Log = log
+
 	home, err := os.UserHomeDir()
 
 	if err != nil {
@@ -142,12 +402,39 @@ func getWebFlowLocal() *gcp.CachedCredentialHelper {
 	}
 
 	cacheFile := filepath.Join(home, ".cache", "kubeflow", "groups.sync.token")
-	h := &gcp.CachedCredentialHelper {
-		CredentialHelper: webFlow,
-		TokenCache: &gcp.FileTokenCache{
+	var cache gcp.TokenCache = &gcp.FileTokenCache{
+		CacheFile: cacheFile,
+		Log:       log,
+	}
+
+	if opts.TokenKey != "" {
+		key, err := gcp.ParseTokenKey(opts.TokenKey)
+		if err != nil {
+			log.Error(err, "Invalid token encryption key")
+			return nil
+		}
+
+		encrypted := &gcp.EncryptedFileTokenCache{
 			CacheFile: cacheFile,
+			Key:       key,
+			OldKeys:   []*gcp.TokenKey{},
 			Log:       log,
-		},
+		}
+
+		for _, spec := range opts.OldTokenKeys {
+			k, err := gcp.ParseTokenKey(spec)
+			if err != nil {
+				log.Error(err, "Invalid old token encryption key")
+				return nil
+			}
+			encrypted.OldKeys = append(encrypted.OldKeys, k)
+		}
+		cache = encrypted
+	}
+
+	h := &gcp.CachedCredentialHelper {
+		CredentialHelper: webFlow,
+		TokenCache: cache,
 		Log: log,
 	}
 
@@ -162,6 +449,9 @@ func getWebFlowSecretManager() *gcp.CachedCredentialHelper {
 		return nil
 	}
 
+	webFlow.Flow = gcp.AuthFlow(opts.AuthFlow)
+	webFlow.Log = log
+
 	pieces := strings.Split(opts.Secret, "/")
 
 	if len(pieces) != 2 {
@@ -169,6 +459,11 @@ func getWebFlowSecretManager() *gcp.CachedCredentialHelper {
 		return nil
 	}
 
+	if p := gcp.PruneMode(opts.SecretPrune); p != gcp.PruneDisable && p != gcp.PruneDestroy {
+		log.Error(fmt.Errorf("--secret-prune must be %v or %v", gcp.PruneDisable, gcp.PruneDestroy), "Invalid prune mode", "prune", opts.SecretPrune)
+		return nil
+	}
+
 	cache, err := gcp.NewSecretCache(pieces[0], pieces[1], "latest")
 
 	if err != nil {
@@ -176,6 +471,54 @@ func getWebFlowSecretManager() *gcp.CachedCredentialHelper {
 		return nil
 	}
 
+	cache.Log = log
+	cache.KeepVersions = opts.SecretKeepVersions
+	cache.Prune = gcp.PruneMode(opts.SecretPrune)
+
+	h := &gcp.CachedCredentialHelper {
+		CredentialHelper: webFlow,
+		TokenCache: cache,
+		Log: log,
+	}
+
+	return h
+}
+
+func getWebFlowKubeSecret() *gcp.CachedCredentialHelper {
+	webFlow, err := gcp.NewWebFlowHelper(opts.CredentialsFile, scopes)
+
+	if err != nil {
+		log.Error(err, "Failed to create a WebFlowHelper credential helper")
+		return nil
+	}
+
+	webFlow.Flow = gcp.AuthFlow(opts.AuthFlow)
+	webFlow.Log = log
+
+	namespace := ""
+	name := opts.KubeSecret
+	if pieces := strings.Split(opts.KubeSecret, "/"); len(pieces) == 2 {
+		namespace = pieces[0]
+		name = pieces[1]
+	}
+
+	if namespace == "" {
+		// Default to the namespace the pod is running in.
+		b, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+		if err != nil {
+			log.Error(err, "Could not determine the pod's namespace; specify the secret as {namespace}/{name}", "secret", opts.KubeSecret)
+			return nil
+		}
+		namespace = strings.TrimSpace(string(b))
+	}
+
+	cache, err := gcp.NewKubeSecretCache(namespace, name)
+
+	if err != nil {
+		log.Error(err, "Could not create cache for Kubernetes secret")
+		return nil
+	}
+
 	cache.Log = log
 
 	h := &gcp.CachedCredentialHelper {
@@ -187,6 +530,52 @@ func getWebFlowSecretManager() *gcp.CachedCredentialHelper {
 	return h
 }
 
+// getNotifier returns a notifier for the configured backends. It returns nil if no backends are configured.
+func getNotifier() (notify.Notifier, error) {
+	templates, err := notify.NewTemplates(nil)
+
+	if nOpts.Templates != "" {
+		templates, err = notify.ReadTemplates(nOpts.Templates)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &notify.MultiNotifier{
+		Notifiers: []notify.Notifier{},
+		Log: log,
+	}
+
+	if nOpts.WebhookURL != "" {
+		log.Info("Sending notifications to webhook")
+		m.Notifiers = append(m.Notifiers, &notify.WebhookNotifier{
+			URL: nOpts.WebhookURL,
+			Templates: templates,
+		})
+	}
+
+	if nOpts.SMTPAddr != "" {
+		log.Info("Sending notifications by email", "smtp", nOpts.SMTPAddr, "from", nOpts.SMTPFrom)
+		n := &notify.SMTPNotifier{
+			Addr: nOpts.SMTPAddr,
+			From: nOpts.SMTPFrom,
+			Templates: templates,
+		}
+
+		if nOpts.SMTPUsername != "" {
+			host := strings.Split(nOpts.SMTPAddr, ":")[0]
+			n.Auth = smtp.PlainAuth("", nOpts.SMTPUsername, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		m.Notifiers = append(m.Notifiers, n)
+	}
+
+	if len(m.Notifiers) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
 // getAdminClient initializes an admin client using a local credential cahce
 func getAdminClient(h gcp.CredentialHelper) *http.Client{
 	ctx := context.Background()
@@ -197,22 +586,141 @@ func getAdminClient(h gcp.CredentialHelper) *http.Client{
 		return nil
 	}
 
+	return newVerifiedClient(ctx, ts)
+}
+
+// newVerifiedClient returns a client using ts after checking its tokens carry the scopes the command needs.
+func newVerifiedClient(ctx context.Context, ts oauth2.TokenSource) *http.Client {
+	if err := gcp.VerifyScopes(ctx, ts, scopes, ""); err != nil {
+		log.Error(err, "The OAuth2 token doesn't carry the scopes this command needs", "required", scopes)
+		return nil
+	}
+
 	client := oauth2.NewClient(ctx, ts)
 	return client
 }
 
-func run() {
-	initLogger()
+// getCredsHelper returns a credential helper for the service account if --service-account-key is set and the
+// helper returned by getCachedCredsHelper otherwise.
+func getCredsHelper() gcp.CredentialHelper {
+	if opts.ServiceAccountKey != "" {
+		log.Info("Getting credential via service account with domain-wide delegation")
+		h, err := gcp.NewServiceAccountHelper(opts.ServiceAccountKey, opts.Subject, scopes)
 
-	var credsHelper gcp.CredentialHelper
+		if err != nil {
+			log.Error(err, "Failed to create a ServiceAccountHelper credential helper")
+			return nil
+		}
+		return h
+	}
 
+	// Explicitly return nil on failure; returning a nil *CachedCredentialHelper would produce a non nil interface.
+	if h := getCachedCredsHelper(); h != nil {
+		return h
+	}
+	return nil
+}
+
+// getCachedCredsHelper returns a credential helper that caches the token in secret manager if --secret is set,
+// in a Kubernetes secret if --kube-secret is set and in a local file otherwise.
+func getCachedCredsHelper() *gcp.CachedCredentialHelper {
 	if opts.Secret != "" {
 		log.Info("Getting OAuth2 credential via webflow and secret manager")
-		credsHelper = getWebFlowSecretManager()
-	} else {
-		log.Info("Getting OAuth2 credential via webflow and local cache")
-		credsHelper = getWebFlowLocal()
+		return getWebFlowSecretManager()
+	}
+
+	if opts.KubeSecret != "" {
+		log.Info("Getting OAuth2 credential via webflow and Kubernetes secret")
+		return getWebFlowKubeSecret()
+	}
+
+	log.Info("Getting OAuth2 credential via webflow and local cache")
+	return getWebFlowLocal()
+}
+
+// getAuthManager returns an AuthManager for the configured token cache.
+func getAuthManager() *gcp.AuthManager {
+	initLogger()
+	// The cached token is the one used to sync groups.
+	scopes = groups.SyncScopes
+	h := getCachedCredsHelper()
+
+	if h == nil {
+		return nil
+	}
+
+	return &gcp.AuthManager{
+		WebFlow: h.CredentialHelper.(*gcp.WebFlowHelper),
+		Cache: h.TokenCache,
+		Log: log,
+		RequiredScopes: scopes,
+	}
+}
+
+func authLogin() {
+	m := getAuthManager()
+
+	if m == nil {
+		os.Exit(1)
+	}
+
+	if _, err := m.Login(context.Background()); err != nil {
+		log.Error(err, "Login failed")
+		os.Exit(1)
 	}
+	fmt.Println("Logged in; the new token was saved to the token cache")
+}
+
+func authStatus() {
+	m := getAuthManager()
+
+	if m == nil {
+		os.Exit(2)
+	}
+
+	status, err := m.Status(context.Background())
+
+	if err != nil {
+		log.Error(err, "Failed to get the status of the cached token")
+		os.Exit(2)
+	}
+
+	if err := status.Write(os.Stdout); err != nil {
+		log.Error(err, "Failed to write status")
+		os.Exit(2)
+	}
+
+	if !status.OK() {
+		os.Exit(1)
+	}
+}
+
+func authRevoke() {
+	m := getAuthManager()
+
+	if m == nil {
+		os.Exit(1)
+	}
+
+	if err := m.Revoke(context.Background()); err != nil {
+		log.Error(err, "Failed to revoke the cached token")
+		os.Exit(1)
+	}
+	fmt.Println("Revoked the cached credential, if there was one, and cleared the token cache")
+}
+
+func run() {
+	initLogger()
+	scopes = groups.SyncScopes
+
+	if opts.WriteStatus {
+		if err := checkStatusDir(opts.StatusDir, opts.Input); err != nil {
+			log.Error(err, "Invalid --status-dir", "statusDir", opts.StatusDir, "input", opts.Input)
+			return
+		}
+	}
+
+	credsHelper := getCredsHelper()
 
 	if credsHelper == nil {
 		return
@@ -224,9 +732,17 @@ func run() {
 		return
 	}
 
+	notifier, err := getNotifier()
+
+	if err != nil {
+		log.Error(err, "Failed to create notifier")
+		return
+	}
+
 	s := &groups.GroupSyncer{
 		Client: client,
 		Log: log,
+		Notifier: notifier,
 	}
 
 
@@ -244,6 +760,23 @@ func run() {
 			log.Error(err, "Failed to sync")
 		}
 
+		if gcp.IsRevoked(err) {
+			log.Info("The OAuth2 credential was revoked; rerun the OAuth flow to obtain a new credential", "secret", opts.Secret)
+		}
+
+		// Failing to report the status shouldn't cause the sync to be retried.
+		if opts.WriteStatus {
+			if wErr := api.WriteGroups(defs, opts.StatusDir); wErr != nil {
+				log.Error(wErr, "Failed to write status to group specs", "dir", opts.StatusDir)
+			}
+		}
+
+		if opts.StatusReport != "" {
+			if wErr := api.WriteStatusReport(defs, opts.StatusReport); wErr != nil {
+				log.Error(wErr, "Failed to write status report", "output", opts.StatusReport)
+			}
+		}
+
 		return err
 	}
 
@@ -252,13 +785,57 @@ func run() {
 	// Set the resync time in the past to force a resync immediately
 	nextResyncTime := time.Now().Add(-10 *time.Minute)
 
-	for ;; {
-		// Get the current content hash so we can see if its changed.
+	// How long to wait before retrying a failed sync; it doubles after each failure.
+	retryDelay := opts.SyncPeriod
+
+	// changed is signaled by the watcher whenever the input files may have changed.
+	changed := make(chan struct{}, 1)
+
+	if opts.Continuous {
+		w := &watcher.Watcher{
+			Glob:         opts.Input,
+			Debounce:     opts.Debounce,
+			PollPeriod:   opts.SyncPeriod,
+			ForcePolling: opts.UsePolling,
+			Log:          log,
+		}
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		if opts.MetricsAddr != "" {
+			go func() {
+				log.Info("Serving metrics", "addr", opts.MetricsAddr)
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+				if err := http.ListenAndServe(opts.MetricsAddr, mux); err != nil {
+					log.Error(err, "Metrics server exited", "addr", opts.MetricsAddr)
+				}
+			}()
+		}
+
+		go func() {
+			err := w.Run(stop, func() {
+				select {
+				case changed <- struct{}{}:
+				default:
+					// A sync is already pending.
+				}
+			})
+
+			if err != nil {
+				log.Error(err, "Watcher exited; only periodic resyncs will be performed", "glob", opts.Input)
+			}
+		}()
+	}
+
+	// contentHash computes a hash of the input files so we can see if they have changed.
+	contentHash := func() (string, error) {
 		log.Info("Reading glob", "directory", opts.Input)
 		matches, err := filepath.Glob(opts.Input)
 		if err != nil {
 			log.Error(err, "Error matching glob path", "glob", opts.Input)
-			return
+			return "", err
 		}
 
 		log.Info("Found files", "files", matches)
@@ -267,22 +844,49 @@ func run() {
 
 		if err != nil {
 			log.Error(err, "Could not hash the file contents")
+			return "", err
+		}
+
+		return string(hashBytes), nil
+	}
+
+	for ;; {
+		// Get the current content hash so we can see if its changed.
+		newHash, err := contentHash()
+
+		if err != nil {
 			return
 		}
 
-		newHash := string(hashBytes)
+		// How long to wait before checking again if no change is detected.
+		wait := time.Until(nextResyncTime)
 
 		if newHash != lastHash || time.Now().After(nextResyncTime) {
 			log.Info("Sync needed", "lastHash", lastHash, "newHash", newHash, "nextResyncTime", nextResyncTime)
 			err := runSync()
 
-			if err == nil {
-				// Only update the hash if the sync succeeded otherwise we want to try again.
-				// ToDO(jlewi): Should we do exponential backoff in the event of errors.
+			if sErr, ok := err.(*groups.SpecError); ok {
+				log.Info("Some groups have errors in their specs; they won't be synced again until the specs change or the forced resync", "groups", sErr.Groups)
+			}
+
+			if err == nil || groups.IsPermanent(err) {
+				// Only update the hash if the sync succeeded or syncing again can't help; otherwise we want to try again.
 				lastHash = newHash
+				retryDelay = opts.SyncPeriod
+
 				nextResyncTime = time.Now().Add(opts.ForcedResyncPreiod)
+				wait = opts.ForcedResyncPreiod
 
 				log.Info("Updated content hash and resync time", "lasthash", lastHash, "nextResyncTime", nextResyncTime)
+			} else {
+				// Back off so a persistent failure e.g. an exhausted quota isn't retried every sync period.
+				nextResyncTime = time.Now().Add(retryDelay)
+				wait = retryDelay
+				retryDelay *= 2
+				if retryDelay > opts.ForcedResyncPreiod {
+					retryDelay = opts.ForcedResyncPreiod
+				}
+				log.Info("Sync failed; retrying later", "nextResyncTime", nextResyncTime)
 			}
 		} else {
 			log.Info("No sync needed", "lastHash", lastHash, "newHash", newHash, "nextResyncTime", nextResyncTime)
@@ -292,14 +896,41 @@ func run() {
 			return
 		}
 
-		time.Sleep(opts.SyncPeriod)
+		select {
+		case <-changed:
+			log.Info("Change detected", "glob", opts.Input)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// checkStatusDir checks the directory the status is written to isn't the directory of the specs in input. Writing
+// there would modify the git-synced specs the watcher is monitoring and trigger another sync.
+func checkStatusDir(statusDir string, input string) error {
+	if statusDir == "" {
+		return fmt.Errorf("--write-status requires --status-dir")
+	}
+
+	dir, err := filepath.Abs(statusDir)
+	if err != nil {
+		return err
+	}
+
+	inputDir, err := filepath.Abs(filepath.Dir(input))
+	if err != nil {
+		return err
+	}
+
+	if rel, err := filepath.Rel(inputDir, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("--status-dir %v must be outside the directory of the specs %v", statusDir, inputDir)
 	}
+	return nil
 }
 
 func runImport() {
 	initLogger()
-	log.Info("Getting OAuth2 credential via webflow and local cache")
-	credsHelper := getWebFlowLocal()
+	scopes = groups.ImportScopes
+	credsHelper := getCredsHelper()
 
 	if credsHelper == nil {
 		return
@@ -314,56 +945,138 @@ func runImport() {
 	s := &groups.GroupImporter{
 		Client: client,
 		Log: log,
+		Groups: iOpts.Groups,
 	}
 
-	groups, err := s.Import(iOpts.Domain)
+	imported, err := s.Import(iOpts.Domain)
 
-	if err != nil {
+	importErr, partial := err.(*groups.ImportError)
+	if partial {
+		// Still write the groups that could be read.
+		log.Error(importErr, "Failed to import some groups; they weren't written")
+	} else if err != nil {
 		log.Error(err, "Failed to import group specs")
 		return
 	}
 
-	// This is a list of groups that are already in GitHub.
-	// We don't want to import members for groups that aren't already in GitHub
-	// because don't want to put emails into GitHub without people's consent.
-	// So they should be the ones to open the PR adding themselves.
-	// This should go away once we've completely migrated to using GitOps.
-	groupsToImportMembersFor := map[string]bool {
-		"calendar-admins@kubeflow.org": true,
-		"ci-team@kubeflow.org": true,
-		"ci-viewer@kubeflow.org": true,
-		"code-search-team@kubeflow.org": true,
-		"community-meeting-hosts@kubeflow.org":true,
-		"devrel-team@kubeflow.org": true,
-		"devstats@kubeflow.org": true,
-		"drive-content-managers@kubeflow.org": true,
-		"example-maintainers@kubeflow.org": true,
-		"feast-team@kubeflow.org": true,
-		"github-team@kubeflow.org": true,
-		"google-codelab-projects-owners@kubeflow.org": true,
-		"kf-demo-owners@kubeflow.org": true,
-		"kf-kcc-admins@kubeflow.org": true,
-		"release-team@kubeflow.org": true,
-	}
-
-	for _, g := range groups {
-		if _, ok := groupsToImportMembersFor[g.Spec.Email]; !ok {
-			log.Info("Removing members from group not in hardcoded allow list", "group", g.Spec.Email)
-			g.Spec.Members = []v1alpha1.Member{}
-
-			log.Info("Disabling autosync", "group", g.Spec.Email)
-			g.Spec.AutoSync = proto.Bool(false)
+	toWrite := imported
+	if iOpts.Merge {
+		existing := api.ReadGroups(filepath.Join(iOpts.Output, "*.yaml"))
+		added, diffs := api.MergeImported(existing, imported, time.Now())
+
+		for _, d := range diffs {
+			fmt.Printf("%v differs from Google Groups:\n", d.Group)
+			for _, l := range d.Lines() {
+				fmt.Printf("  %v\n", l)
+			}
 		}
+
+		log.Info("Merged imported groups", "imported", len(imported), "new", len(added), "differ", len(diffs))
+		toWrite = added
 	}
 
-	err = api.WriteGroups(groups, iOpts.Output)
+	importConfig := &api.ImportConfig{}
+	if iOpts.Config != "" {
+		importConfig, err = api.ReadImportConfig(iOpts.Config)
+
+		if err != nil {
+			log.Error(err, "Failed to read import config", "config", iOpts.Config)
+			return
+		}
+	}
+
+	importConfig.FilterMembers(toWrite)
+
+	err = api.WriteGroups(toWrite, iOpts.Output)
 
 	if err != nil {
 		log.Error(err, "Error writing groups")
 	}
+
+	if partial {
+		os.Exit(1)
+	}
+}
+
+func runController() {
+	initLogger()
+	scopes = groups.SyncScopes
+	ctrl.SetLogger(log)
+
+	credsHelper := getCredsHelper()
+
+	if credsHelper == nil {
+		return
+	}
+
+	client := getAdminClient(credsHelper)
+
+	if client == nil {
+		return
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		log.Error(err, "Failed to add client-go types to scheme")
+		return
+	}
+
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		log.Error(err, "Failed to add GoogleGroup types to scheme")
+		return
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:             scheme,
+		Namespace:          cOpts.Namespace,
+		MetricsBindAddress: cOpts.MetricsAddr,
+		LeaderElection:     cOpts.EnableLeaderElection,
+		LeaderElectionID:   "groups-sync.groups.kubeflow.org",
+	})
+
+	if err != nil {
+		log.Error(err, "Unable to create manager")
+		return
+	}
+
+	notifier, err := getNotifier()
+
+	if err != nil {
+		log.Error(err, "Failed to create notifier")
+		return
+	}
+
+	r := &controller.GoogleGroupReconciler{
+		Client: mgr.GetClient(),
+		Syncer: &groups.GroupSyncer{
+			Client:   client,
+			Log:      log,
+			Notifier: notifier,
+		},
+		Log:          log.WithName("controller").WithName("GoogleGroup"),
+		ResyncPeriod: cOpts.ResyncPeriod,
+	}
+
+	if err := r.SetupWithManager(mgr); err != nil {
+		log.Error(err, "Unable to create controller", "controller", "GoogleGroup")
+		return
+	}
+
+	log.Info("Starting manager", "namespace", cOpts.Namespace)
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		log.Error(err, "Problem running manager")
+	}
 }
 
 func upgrade() {
+	initLogger()
+	t, err := api.ReadTransformations(uOpts.Transformations)
+
+	if err != nil {
+		log.Error(err, "Failed to read transformations", "transformations", uOpts.Transformations)
+		return
+	}
+
 	grps := api.ReadGroups(opts.Input)
 
 	if len(grps) == 0 {
@@ -371,24 +1084,320 @@ func upgrade() {
 		return
 	}
 
-	requiredUsers := []*v1alpha1.Member{}
-	removeUsers := map[string]bool{
-		"kf-autobot@kf-infra-gitops.iam.gserviceaccount.com": true,
+	output := iOpts.Output
+	if output == "" {
+		output = filepath.Dir(opts.Input)
 	}
 
-	err := api.Upgrade(grps, requiredUsers, removeUsers)
+	changed, err := api.Upgrade(grps, t, os.Stdout)
 
 	if err != nil {
 		log.Error(err, "Failed to upgrade specs")
 		return
 	}
 
-	err = api.WriteGroups(grps, iOpts.Output)
+	if len(changed) == 0 {
+		log.Info("Transformations didn't change any groups")
+		return
+	}
+
+	if uOpts.DryRun {
+		log.Info("Dry run; not writing specs", "changed", len(changed))
+		return
+	}
+
+	// Only rewrite the groups that changed.
+	err = api.WriteGroups(changed, output)
 
 	if err != nil {
-		log.Error(err, "Failed to write specs", "output", iOpts.Output)
+		log.Error(err, "Failed to write specs", "output", output)
+		return
+	}
+}
+
+func validate() {
+	initLogger()
+	grps := api.ReadGroups(opts.Input)
+
+	if len(grps) == 0 {
+		log.Info("No groups matched glob", "glob", opts.Input)
 		return
 	}
+
+	validateOpts := api.ValidateOptions{
+		Now: time.Now(),
+		ExpiryWarning: vOpts.ExpiryWarning,
+	}
+
+	if vOpts.ImportConfig != "" {
+		c, err := api.ReadImportConfig(vOpts.ImportConfig)
+
+		if err != nil {
+			log.Error(err, "Failed to read import config", "config", vOpts.ImportConfig)
+			os.Exit(1)
+		}
+		validateOpts.ImportConfig = c
+	}
+
+	issues := api.Validate(grps, validateOpts)
+
+	for _, i := range issues {
+		fmt.Println(i.String())
+	}
+
+	iamIssues := []iam.Issue{}
+	if vOpts.IAMPolicies != "" {
+		files, err := iam.ReadPolicyFiles(vOpts.IAMPolicies)
+
+		if err != nil {
+			log.Error(err, "Failed to read IAM policy files", "glob", vOpts.IAMPolicies)
+			os.Exit(1)
+		}
+
+		iamIssues = iam.ValidateBindings(files, grps, iam.ValidateOptions{
+			Domain: vOpts.Domain,
+			Now: validateOpts.Now,
+		})
+	}
+
+	for _, i := range iamIssues {
+		fmt.Println(i.String())
+	}
+
+	if api.HasErrors(issues) || iam.HasErrors(iamIssues) {
+		os.Exit(1)
+	}
+}
+
+func expire() {
+	initLogger()
+	grps := api.ReadGroups(opts.Input)
+
+	if len(grps) == 0 {
+		log.Info("No groups matched glob", "glob", opts.Input)
+		return
+	}
+
+	output := iOpts.Output
+	if output == "" {
+		output = filepath.Dir(opts.Input)
+	}
+
+	removed := api.RemoveExpired(grps, time.Now())
+
+	if len(removed) == 0 {
+		log.Info("No expired memberships")
+		return
+	}
+
+	// Only rewrite the groups that changed.
+	changed := []*v1alpha1.GoogleGroup{}
+	for _, g := range grps {
+		if _, ok := removed[g.Spec.Email]; ok {
+			changed = append(changed, g)
+		}
+	}
+
+	err := api.WriteGroups(changed, output)
+
+	if err != nil {
+		log.Error(err, "Failed to write specs", "output", output)
+		return
+	}
+}
+
+func drift() {
+	initLogger()
+	scopes = groups.ImportScopes
+
+	// Check the format before the expensive import.
+	if err := api.ValidateFormat(dOpts.Format); err != nil {
+		log.Error(err, "Invalid --format")
+		os.Exit(2)
+	}
+
+	specs := api.ReadGroups(opts.Input)
+
+	if len(specs) == 0 {
+		log.Info("No groups matched glob", "glob", opts.Input)
+		os.Exit(2)
+	}
+
+	credsHelper := getCredsHelper()
+
+	if credsHelper == nil {
+		os.Exit(2)
+	}
+
+	client := getAdminClient(credsHelper)
+
+	if client == nil {
+		os.Exit(2)
+	}
+
+	importer := &groups.GroupImporter{
+		Client: client,
+		Log: log,
+	}
+
+	live, err := importer.Import(iOpts.Domain)
+
+	// Groups that couldn't be read are reported as failures rather than missing from Google Groups.
+	var failed map[string]error
+	if importErr, ok := err.(*groups.ImportError); ok {
+		failed = importErr.Failed
+	} else if err != nil {
+		log.Error(err, "Failed to list groups", "domain", iOpts.Domain)
+		os.Exit(2)
+	}
+
+	r := api.NewDriftReport(specs, live, failed, time.Now())
+
+	if err := r.Write(os.Stdout, dOpts.Format); err != nil {
+		log.Error(err, "Failed to write drift report")
+		os.Exit(2)
+	}
+
+	if r.HasFailures() {
+		os.Exit(2)
+	}
+
+	if r.HasDrift() {
+		os.Exit(1)
+	}
+}
+
+func diffSpecs() {
+	initLogger()
+	base, err := api.ReadGroupsAt(diffOpts.Base, diffOpts.Path)
+
+	if err != nil {
+		log.Error(err, "Failed to read base specs", "base", diffOpts.Base)
+		os.Exit(1)
+	}
+
+	head, err := api.ReadGroupsAt(diffOpts.Head, diffOpts.Path)
+
+	if err != nil {
+		log.Error(err, "Failed to read head specs", "head", diffOpts.Head)
+		os.Exit(1)
+	}
+
+	if err := api.WriteSpecDiffMarkdown(os.Stdout, api.DiffSpecs(base, head)); err != nil {
+		log.Error(err, "Failed to write diff")
+		os.Exit(1)
+	}
+}
+
+// getIAMClient returns a client for the service account if --service-account-key is set and one authorized
+// with Application Default Credentials, e.g. from gcloud auth application-default login, otherwise.
+// The cached OAuth2 token isn't used since it is minted for the Admin SDK scopes used to sync groups.
+func getIAMClient() *http.Client {
+	scopes = iam.Scopes
+
+	if opts.ServiceAccountKey != "" {
+		credsHelper := getCredsHelper()
+
+		if credsHelper == nil {
+			return nil
+		}
+		return getAdminClient(credsHelper)
+	}
+
+	ctx := context.Background()
+	ts, err := google.DefaultTokenSource(ctx, scopes...)
+
+	if err != nil {
+		log.Error(err, "Failed to get Application Default Credentials; run gcloud auth application-default login")
+		return nil
+	}
+	return newVerifiedClient(ctx, ts)
+}
+
+// syncIAM plans or applies the IAM policy files. It returns nil if the report couldn't be generated.
+func syncIAM(dryRun bool) *iam.Report {
+	// Check the format before any policy is applied; otherwise the plan couldn't be printed.
+	if err := api.ValidateFormat(iamOpts.Format); err != nil {
+		log.Error(err, "Invalid --format")
+		return nil
+	}
+
+	files, err := iam.ReadPolicyFiles(iamOpts.Input)
+
+	if err != nil {
+		log.Error(err, "Failed to read IAM policy files", "glob", iamOpts.Input)
+		return nil
+	}
+
+	if len(files) == 0 {
+		log.Info("No IAM policy files matched glob", "glob", iamOpts.Input)
+		return nil
+	}
+
+	client := getIAMClient()
+
+	if client == nil {
+		return nil
+	}
+
+	s := &iam.PolicySyncer{
+		Client: client,
+		Log: log,
+		DryRun: dryRun,
+	}
+
+	report, err := s.Sync(files)
+
+	if err != nil {
+		log.Error(err, "Failed to sync IAM policies")
+	}
+
+	if report == nil {
+		return nil
+	}
+
+	// Record the new etags so the next change can be applied.
+	for i, p := range report.Projects {
+		if p.Applied {
+			if wErr := files[i].Write(); wErr != nil {
+				log.Error(wErr, "Failed to write the new etag to the policy file; fetch the policy before the next change", "file", files[i].Path)
+			}
+		}
+	}
+
+	// Write the record of the applied changes first so it is kept even if printing the plan fails.
+	if iamOpts.Report != "" {
+		if wErr := report.WriteFile(iamOpts.Report); wErr != nil {
+			log.Error(wErr, "Failed to write report", "output", iamOpts.Report)
+		}
+	}
+
+	if err := report.Write(os.Stdout, iamOpts.Format); err != nil {
+		log.Error(err, "Failed to write IAM plan")
+	}
+	return report
+}
+
+func iamPlan() {
+	initLogger()
+	report := syncIAM(true)
+
+	if report == nil || report.HasErrors() {
+		os.Exit(2)
+	}
+
+	if report.HasChanges() {
+		os.Exit(1)
+	}
+}
+
+func iamApply() {
+	initLogger()
+	report := syncIAM(iamOpts.DryRun)
+
+	if report == nil || report.HasErrors() {
+		os.Exit(1)
+	}
 }
 
 func main() {
@@ -6,20 +6,29 @@ require (
 	cloud.google.com/go v0.70.0
 	cloud.google.com/go/storage v1.10.0
 	github.com/bradfitz/slice v0.0.0-20180809154707-2b758aa73013
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/ghodss/yaml v1.0.0
-	github.com/go-logr/logr v0.2.1
+	github.com/go-logr/logr v0.3.0
 	github.com/go-logr/zapr v0.2.0
 	github.com/gogo/protobuf v1.3.1
 	github.com/google/go-cmp v0.5.2
 	github.com/google/martian v2.1.0+incompatible
 	github.com/pkg/errors v0.9.1
-	github.com/sirupsen/logrus v1.2.0
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/client_golang v1.7.1
+	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/cobra v1.1.1
 	go.uber.org/zap v1.16.0
+	go.yaml.in/yaml/v3 v3.0.5
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/net v0.0.0-20201010224723-4f7140c49acb
 	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43
+	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e
 	google.golang.org/api v0.33.0
 	google.golang.org/genproto v0.0.0-20201019141844-1ed22bb0c154
 	google.golang.org/grpc v1.32.0
+	k8s.io/api v0.19.2
 	k8s.io/apimachinery v0.19.3
+	k8s.io/client-go v0.19.2
+	sigs.k8s.io/controller-runtime v0.7.0
 )
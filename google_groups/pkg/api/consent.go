@@ -0,0 +1,151 @@
+package api
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/go-logr/zapr"
+	"github.com/gogo/protobuf/proto"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// ImportConfig controls which members import is allowed to write to the group specs.
+//
+// We don't want to put people's emails into GitHub without their consent. Members are only imported for groups
+// on the allowlist or if there is a consent record for them. Otherwise people should open the PR adding
+// themselves.
+type ImportConfig struct {
+	// ImportMembers is the allowlist of groups whose members are all imported.
+	ImportMembers []string `json:"importMembers,omitempty"`
+	// Consents records the members who agreed to have their membership imported.
+	Consents []ConsentRecord `json:"consents,omitempty"`
+}
+
+// ConsentRecord records that a member agreed to have their membership in a group stored in GitHub.
+type ConsentRecord struct {
+	// Email of the member.
+	Email string `json:"email"`
+	// Group the consent applies to. If empty the consent applies to all groups.
+	Group string `json:"group,omitempty"`
+	// ConsentedBy is who gave the consent; usually the member.
+	ConsentedBy string `json:"consentedBy"`
+	// Date (YYYY-MM-DD) the consent was given.
+	Date string `json:"date"`
+	// Method is how the consent was given e.g. email, pull-request.
+	Method string `json:"method"`
+}
+
+// ReadImportConfig reads the import config from a YAML file.
+func ReadImportConfig(file string) (*ImportConfig, error) {
+	b, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading import config %v", file)
+	}
+
+	c := &ImportConfig{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing import config %v", file)
+	}
+	return c, nil
+}
+
+// CanImportMembers returns true if all members of the group can be imported.
+func (c *ImportConfig) CanImportMembers(group string) bool {
+	for _, g := range c.ImportMembers {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Consent returns the consent record for the member of the group or nil if there isn't one.
+func (c *ImportConfig) Consent(group string, member string) *ConsentRecord {
+	for i, r := range c.Consents {
+		if !strings.EqualFold(r.Email, member) {
+			continue
+		}
+		if r.Group == "" || strings.EqualFold(r.Group, group) {
+			return &c.Consents[i]
+		}
+	}
+	return nil
+}
+
+// FilterMembers removes the members that can't be imported from the groups.
+//
+// AutoSync is disabled for groups that aren't on the allowlist; otherwise syncing them would remove the
+// members that weren't imported.
+func (c *ImportConfig) FilterMembers(grps []*v1alpha1.GoogleGroup) {
+	log := zapr.NewLogger(zap.L())
+
+	for _, g := range grps {
+		if c.CanImportMembers(g.Spec.Email) {
+			continue
+		}
+
+		toKeep := []v1alpha1.Member{}
+		for _, m := range g.Spec.Members {
+			if c.Consent(g.Spec.Email, m.Email) == nil {
+				continue
+			}
+			toKeep = append(toKeep, m)
+		}
+
+		log.Info("Removing members without consent from group not in allowlist", "group", g.Spec.Email, "removed", len(g.Spec.Members)-len(toKeep))
+		g.Spec.Members = toKeep
+
+		log.Info("Disabling autosync", "group", g.Spec.Email)
+		g.Spec.AutoSync = proto.Bool(false)
+	}
+}
+
+// validateConsent checks the consent records and reports members of groups that aren't on the allowlist
+// who haven't consented.
+func validateConsent(grps []*v1alpha1.GoogleGroup, c *ImportConfig) []Issue {
+	issues := []Issue{}
+
+	for _, r := range c.Consents {
+		group := r.Group
+		if group == "" {
+			group = "*"
+		}
+
+		problems := []string{}
+		if r.Email == "" {
+			problems = append(problems, "email is required")
+		}
+		if r.ConsentedBy == "" {
+			problems = append(problems, "consentedBy is required")
+		}
+		if r.Method == "" {
+			problems = append(problems, "method is required")
+		}
+		if _, err := time.Parse(v1alpha1.DateFormat, r.Date); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid date %q; must be in the form YYYY-MM-DD", r.Date))
+		}
+
+		for _, p := range problems {
+			issues = append(issues, Issue{Severity: SeverityError, Group: group, Member: r.Email, Message: "consent record: " + p})
+		}
+	}
+
+	for _, g := range grps {
+		if c.CanImportMembers(g.Spec.Email) {
+			continue
+		}
+
+		for _, m := range g.Spec.Members {
+			if m.Email == "" || c.Consent(g.Spec.Email, m.Email) != nil {
+				continue
+			}
+			issues = append(issues, Issue{Severity: SeverityWarning, Group: g.Spec.Email, Member: m.Email, Message: "group isn't on the import allowlist and member has no consent record"})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"github.com/gogo/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"testing"
+	"time"
+)
+
+func testImportConfig() *ImportConfig {
+	return &ImportConfig{
+		ImportMembers: []string{"ci-team@kubeflow.org"},
+		Consents: []ConsentRecord{
+			{Email: "a@acme.com", Group: "events@kubeflow.org", ConsentedBy: "a@acme.com", Date: "2020-11-01", Method: "email"},
+			{Email: "b@acme.com", ConsentedBy: "jlewi@google.com", Date: "2020-11-01", Method: "pull-request"},
+		},
+	}
+}
+
+func TestFilterMembers(t *testing.T) {
+	grps := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "CI-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "c@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "events@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@acme.com", Role: "MEMBER"},
+					{Email: "b@acme.com", Role: "OWNER"},
+					{Email: "c@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "blog@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+	}
+
+	expected := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "CI-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "c@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				AutoSync: proto.Bool(false),
+				Email:    "events@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@acme.com", Role: "MEMBER"},
+					{Email: "b@acme.com", Role: "OWNER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				AutoSync: proto.Bool(false),
+				Email:    "blog@kubeflow.org",
+				Members:  []v1alpha1.Member{},
+			},
+		},
+	}
+
+	testImportConfig().FilterMembers(grps)
+
+	if d := cmp.Diff(expected, grps); d != "" {
+		t.Errorf("FilterMembers() mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestValidateConsent(t *testing.T) {
+	grps := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "c@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "events@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@acme.com", Role: "MEMBER"},
+					{Email: "c@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+	}
+
+	c := testImportConfig()
+	c.Consents = append(c.Consents, ConsentRecord{Email: "d@acme.com", Date: "11/01/2020"})
+
+	expected := []Issue{
+		{Severity: SeverityError, Group: "*", Member: "d@acme.com", Message: "consent record: consentedBy is required"},
+		{Severity: SeverityError, Group: "*", Member: "d@acme.com", Message: "consent record: method is required"},
+		{Severity: SeverityError, Group: "*", Member: "d@acme.com", Message: `consent record: invalid date "11/01/2020"; must be in the form YYYY-MM-DD`},
+		{Severity: SeverityWarning, Group: "events@kubeflow.org", Member: "c@acme.com", Message: "group isn't on the import allowlist and member has no consent record"},
+	}
+
+	actual := Validate(grps, ValidateOptions{Now: time.Now(), ImportConfig: c})
+
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Validate() mismatch (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/groups"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DriftReport describes where the live Google Groups differ from the group specs.
+type DriftReport struct {
+	// UnmanagedGroups exist in Google Groups but don't have a spec.
+	UnmanagedGroups []string `json:"unmanagedGroups"`
+	// MissingGroups have a spec but don't exist in Google Groups.
+	MissingGroups []string `json:"missingGroups"`
+	// AutoSyncDisabled are groups with autoSync: false. They aren't diffed since the syncer doesn't manage them.
+	AutoSyncDisabled []string `json:"autoSyncDisabled"`
+	// Groups are the differences for groups that have a spec and exist in Google Groups.
+	Groups []*groups.GroupDiff `json:"groups"`
+	// FailedGroups couldn't be read from Google Groups so they weren't compared to their specs.
+	FailedGroups []FailedGroup `json:"failedGroups"`
+}
+
+// FailedGroup is a group that couldn't be read from Google Groups.
+type FailedGroup struct {
+	Group string `json:"group"`
+	Error string `json:"error"`
+}
+
+// NewDriftReport compares the specs to the live groups e.g. as returned by GroupImporter. failed are the groups
+// the importer couldn't read, e.g. from groups.ImportError; they are reported as failures rather than missing.
+func NewDriftReport(specs []*v1alpha1.GoogleGroup, live []*v1alpha1.GoogleGroup, failed map[string]error, now time.Time) *DriftReport {
+	r := &DriftReport{
+		UnmanagedGroups:  []string{},
+		MissingGroups:    []string{},
+		AutoSyncDisabled: []string{},
+		Groups:           []*groups.GroupDiff{},
+		FailedGroups:     []FailedGroup{},
+	}
+
+	failedByEmail := map[string]bool{}
+	for g, err := range failed {
+		failedByEmail[strings.ToLower(g)] = true
+		r.FailedGroups = append(r.FailedGroups, FailedGroup{Group: g, Error: err.Error()})
+	}
+
+	liveByEmail := map[string]*v1alpha1.GoogleGroup{}
+	for _, g := range live {
+		liveByEmail[strings.ToLower(g.Spec.Email)] = g
+	}
+
+	managed := map[string]bool{}
+	for _, s := range specs {
+		key := strings.ToLower(s.Spec.Email)
+		managed[key] = true
+
+		if failedByEmail[key] {
+			continue
+		}
+
+		l, ok := liveByEmail[key]
+		if !ok {
+			r.MissingGroups = append(r.MissingGroups, s.Spec.Email)
+			continue
+		}
+
+		if s.Spec.AutoSync != nil && !*s.Spec.AutoSync {
+			r.AutoSyncDisabled = append(r.AutoSyncDisabled, s.Spec.Email)
+			continue
+		}
+
+		if d := groups.DiffGroup(s, l, now); !d.IsEmpty() {
+			r.Groups = append(r.Groups, d)
+		}
+	}
+
+	for _, g := range live {
+		if !managed[strings.ToLower(g.Spec.Email)] {
+			r.UnmanagedGroups = append(r.UnmanagedGroups, g.Spec.Email)
+		}
+	}
+
+	sort.Strings(r.UnmanagedGroups)
+	sort.Strings(r.MissingGroups)
+	sort.Strings(r.AutoSyncDisabled)
+	sort.Slice(r.Groups, func(i, j int) bool {
+		return r.Groups[i].Group < r.Groups[j].Group
+	})
+	sort.Slice(r.FailedGroups, func(i, j int) bool {
+		return r.FailedGroups[i].Group < r.FailedGroups[j].Group
+	})
+	return r
+}
+
+// HasDrift returns true if any group differs from its spec. Groups with autoSync disabled aren't drift.
+func (r *DriftReport) HasDrift() bool {
+	return len(r.UnmanagedGroups) > 0 || len(r.MissingGroups) > 0 || len(r.Groups) > 0
+}
+
+// HasFailures returns true if any group couldn't be read from Google Groups.
+func (r *DriftReport) HasFailures() bool {
+	return len(r.FailedGroups) > 0
+}
+
+// rows returns a row (group, kind, detail) for each difference.
+func (r *DriftReport) rows() [][3]string {
+	rows := [][3]string{}
+	for _, f := range r.FailedGroups {
+		rows = append(rows, [3]string{f.Group, "failed", fmt.Sprintf("couldn't read the group from Google Groups: %v", f.Error)})
+	}
+	for _, g := range r.UnmanagedGroups {
+		rows = append(rows, [3]string{g, "unmanaged", "group exists in Google Groups but has no spec"})
+	}
+	for _, g := range r.MissingGroups {
+		rows = append(rows, [3]string{g, "missing", "group has a spec but doesn't exist in Google Groups"})
+	}
+	for _, d := range r.Groups {
+		for _, m := range d.MissingMembers {
+			rows = append(rows, [3]string{d.Group, "member", fmt.Sprintf("%v (%v) is missing from Google Groups", m.Email, m.Role)})
+		}
+		for _, m := range d.ExtraMembers {
+			rows = append(rows, [3]string{d.Group, "member", fmt.Sprintf("%v (%v) isn't in the spec", m.Email, m.Role)})
+		}
+		for _, c := range d.RoleChanges {
+			rows = append(rows, [3]string{d.Group, "role", fmt.Sprintf("%v is %v in Google Groups; spec has %v", c.Email, c.Live, c.Spec)})
+		}
+		for _, s := range d.Settings {
+			rows = append(rows, [3]string{d.Group, "setting", fmt.Sprintf("%v is %q in Google Groups; spec has %q", s.Name, s.Live, s.Spec)})
+		}
+	}
+	for _, g := range r.AutoSyncDisabled {
+		rows = append(rows, [3]string{g, "autoSync", "autoSync is disabled; group isn't managed by the syncer"})
+	}
+	return rows
+}
+
+// Write writes the report in the given format; one of table, json or markdown.
+func (r *DriftReport) Write(w io.Writer, format string) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+
+	if format == FormatMarkdown && !r.HasDrift() && !r.HasFailures() {
+		fmt.Fprintln(w, "No drift between Google Groups and the group specs.")
+	}
+	return WriteReport(w, format, r, [3]string{"Group", "Kind", "Detail"}, r.rows())
+}
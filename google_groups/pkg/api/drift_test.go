@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gogo/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"testing"
+	"time"
+)
+
+func TestDriftReport(t *testing.T) {
+	specs := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "a@acme.com", Role: "OWNER"}},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "release-team@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "a@acme.com", Role: "OWNER"}},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:    "blog@kubeflow.org",
+				AutoSync: proto.Bool(false),
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "new-team@kubeflow.org",
+			},
+		},
+	}
+
+	live := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "a@acme.com", Role: "MEMBER"}, {Email: "b@acme.com", Role: "MEMBER"}},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "release-team@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "a@acme.com", Role: "OWNER"}},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "blog@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "c@acme.com", Role: "MEMBER"}},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "old-team@kubeflow.org",
+			},
+		},
+	}
+
+	r := NewDriftReport(specs, live, nil, time.Now())
+
+	if !r.HasDrift() {
+		t.Errorf("HasDrift() returned false; want true")
+	}
+
+	type testCase struct {
+		format   string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			format: FormatTable,
+			expected: `GROUP                  KIND       DETAIL
+old-team@kubeflow.org  unmanaged  group exists in Google Groups but has no spec
+new-team@kubeflow.org  missing    group has a spec but doesn't exist in Google Groups
+ci-team@kubeflow.org   member     b@acme.com (MEMBER) isn't in the spec
+ci-team@kubeflow.org   role       a@acme.com is MEMBER in Google Groups; spec has OWNER
+blog@kubeflow.org      autoSync   autoSync is disabled; group isn't managed by the syncer
+`,
+		},
+		{
+			format: FormatMarkdown,
+			expected: `| Group | Kind | Detail |
+| --- | --- | --- |
+| old-team@kubeflow.org | unmanaged | group exists in Google Groups but has no spec |
+| new-team@kubeflow.org | missing | group has a spec but doesn't exist in Google Groups |
+| ci-team@kubeflow.org | member | b@acme.com (MEMBER) isn't in the spec |
+| ci-team@kubeflow.org | role | a@acme.com is MEMBER in Google Groups; spec has OWNER |
+| blog@kubeflow.org | autoSync | autoSync is disabled; group isn't managed by the syncer |
+`,
+		},
+	}
+
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		if err := r.Write(buf, c.format); err != nil {
+			t.Errorf("Case %v: Write returned error; %v", c.format, err)
+			continue
+		}
+
+		if d := cmp.Diff(c.expected, buf.String()); d != "" {
+			t.Errorf("Case %v: report mismatch (-want +got):\n%s", c.format, d)
+		}
+	}
+
+	if err := r.Write(&bytes.Buffer{}, "xml"); err == nil {
+		t.Errorf("Write should reject unknown formats")
+	}
+
+	if NewDriftReport(specs[1:2], live[1:2], nil, time.Now()).HasDrift() {
+		t.Errorf("HasDrift() returned true for a group that matches its spec; want false")
+	}
+
+	// A group that couldn't be imported is a failure rather than missing from Google Groups.
+	failed := map[string]error{"ci-team@kubeflow.org": errors.New("permission denied")}
+	r = NewDriftReport(specs[:2], live[1:2], failed, time.Now())
+
+	if r.HasDrift() || !r.HasFailures() {
+		t.Errorf("HasDrift() = %v, HasFailures() = %v; want false and true", r.HasDrift(), r.HasFailures())
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.Write(buf, FormatTable); err != nil {
+		t.Fatalf("Write returned error; %v", err)
+	}
+
+	expected := `GROUP                 KIND    DETAIL
+ci-team@kubeflow.org  failed  couldn't read the group from Google Groups: permission denied
+`
+	if d := cmp.Diff(expected, buf.String()); d != "" {
+		t.Errorf("report with failures mismatch (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"github.com/go-logr/zapr"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"go.uber.org/zap"
+	"time"
+)
+
+// RemoveExpired removes expired memberships from the groups. It returns a map from group email to the
+// emails of the members that were removed; groups with no expired members aren't included.
+func RemoveExpired(groups []*v1alpha1.GoogleGroup, now time.Time) map[string][]string {
+	log := zapr.NewLogger(zap.L())
+	removed := map[string][]string{}
+
+	for _, g := range groups {
+		toKeep := []v1alpha1.Member{}
+		for _, m := range g.Spec.Members {
+			if m.IsExpired(now) {
+				log.Info("Removing expired member", "group", g.Spec.Email, "member", m.Email, "expires", m.Expires)
+				removed[g.Spec.Email] = append(removed[g.Spec.Email], m.Email)
+				continue
+			}
+			toKeep = append(toKeep, m)
+		}
+		g.Spec.Members = toKeep
+	}
+	return removed
+}
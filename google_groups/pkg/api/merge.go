@@ -0,0 +1,36 @@
+package api
+
+import (
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/groups"
+	"strings"
+	"time"
+)
+
+// MergeImported merges the groups imported from Google Groups into the existing specs.
+//
+// Groups that don't have a spec yet are returned in added. Existing specs aren't modified; instead the
+// differences between them and the imported groups are returned. Groups without differences aren't included.
+func MergeImported(existing []*v1alpha1.GoogleGroup, imported []*v1alpha1.GoogleGroup, now time.Time) (added []*v1alpha1.GoogleGroup, diffs []*groups.GroupDiff) {
+	byEmail := map[string]*v1alpha1.GoogleGroup{}
+	for _, g := range existing {
+		byEmail[strings.ToLower(g.Spec.Email)] = g
+	}
+
+	added = []*v1alpha1.GoogleGroup{}
+	diffs = []*groups.GroupDiff{}
+	for _, g := range imported {
+		spec, ok := byEmail[strings.ToLower(g.Spec.Email)]
+
+		if !ok {
+			added = append(added, g)
+			continue
+		}
+
+		d := groups.DiffGroup(spec, g, now)
+		if !d.IsEmpty() {
+			diffs = append(diffs, d)
+		}
+	}
+	return added, diffs
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"testing"
+	"time"
+)
+
+func TestMergeImported(t *testing.T) {
+	existing := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "a@acme.com", Role: "OWNER"}},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "blog@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "a@acme.com", Role: "MEMBER"}},
+			},
+		},
+	}
+
+	imported := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "CI-team@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "a@acme.com", Role: "OWNER"}, {Email: "b@acme.com", Role: "MEMBER"}},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "blog@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "a@acme.com", Role: "MEMBER"}},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "events@kubeflow.org",
+			},
+		},
+	}
+
+	added, diffs := MergeImported(existing, imported, time.Now())
+
+	if d := cmp.Diff([]*v1alpha1.GoogleGroup{imported[2]}, added); d != "" {
+		t.Errorf("added mismatch (-want +got):\n%s", d)
+	}
+
+	lines := map[string][]string{}
+	for _, d := range diffs {
+		lines[d.Group] = d.Lines()
+	}
+
+	expected := map[string][]string{
+		"ci-team@kubeflow.org": {"member b@acme.com (MEMBER) is in Google Groups but not in the spec"},
+	}
+
+	if d := cmp.Diff(expected, lines); d != "" {
+		t.Errorf("diffs mismatch (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats of the reports written by WriteReport.
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+// ValidateFormat returns an error if format isn't one of table, json or markdown.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatTable, FormatJSON, FormatMarkdown:
+		return nil
+	default:
+		return errors.Errorf("Unknown format %q; must be one of %v, %v or %v", format, FormatTable, FormatJSON, FormatMarkdown)
+	}
+}
+
+// WriteReport writes a report in the given format. JSON is the marshaled report; table and markdown are a table
+// of the rows with the given column names. The last column is escaped for Markdown since it holds free text.
+func WriteReport(w io.Writer, format string, report interface{}, columns [3]string, rows [][3]string) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatJSON:
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns[:], "\t")))
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%v\t%v\t%v\n", row[0], row[1], row[2])
+		}
+		return tw.Flush()
+	case FormatMarkdown:
+		fmt.Fprintf(w, "| %v |\n", strings.Join(columns[:], " | "))
+		fmt.Fprintln(w, "| --- | --- | --- |")
+		for _, row := range rows {
+			_, err := fmt.Fprintf(w, "| %v | %v | %v |\n", row[0], row[1], strings.Replace(row[2], "|", "\\|", -1))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
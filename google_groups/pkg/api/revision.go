@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ParseError is returned by ReadGroupsAt when some spec files can't be read or parsed. Reporting them instead of
+// skipping them keeps a broken spec from looking like a removed group.
+type ParseError struct {
+	// Files maps each file that couldn't be parsed to the error.
+	Files map[string]error
+}
+
+func (e *ParseError) Error() string {
+	files := []string{}
+	for f := range e.Files {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	msgs := []string{}
+	for _, f := range files {
+		msgs = append(msgs, fmt.Sprintf("%v: %v", f, e.Files[f]))
+	}
+	return fmt.Sprintf("failed to parse group specs: %v", strings.Join(msgs, "; "))
+}
+
+// ReadGroupsAt reads the group specs from a directory or a git revision.
+//
+// If ref is a directory the YAML files in it are read. Otherwise ref is treated as a git revision (e.g. origin/master)
+// and the YAML files in dir at that revision are read; dir is relative to the current directory.
+//
+// Unlike ReadGroups, files that can't be parsed aren't skipped; a *ParseError listing them is returned.
+func ReadGroupsAt(ref string, dir string) ([]*v1alpha1.GoogleGroup, error) {
+	results := []*v1alpha1.GoogleGroup{}
+	failed := map[string]error{}
+
+	parse := func(f string, b []byte) {
+		g := &v1alpha1.GoogleGroup{}
+		if err := yaml.Unmarshal(b, g); err != nil {
+			failed[f] = err
+			return
+		}
+		results = append(results, g)
+	}
+
+	if info, err := os.Stat(ref); err == nil && info.IsDir() {
+		matches, err := filepath.Glob(filepath.Join(ref, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range matches {
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				failed[f] = err
+				continue
+			}
+			parse(f, b)
+		}
+	} else {
+		out, err := exec.Command("git", "ls-tree", "--name-only", ref, "--", dir+"/").Output()
+		if err != nil {
+			return nil, errors.Wrapf(gitError(err), "%v is neither a directory nor a git revision", ref)
+		}
+
+		files := 0
+		for _, f := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if filepath.Ext(f) != ".yaml" {
+				continue
+			}
+
+			b, err := exec.Command("git", "show", ref+":./"+f).Output()
+			if err != nil {
+				return nil, errors.Wrapf(gitError(err), "Error reading %v at %v", f, ref)
+			}
+			parse(f, b)
+			files++
+		}
+
+		if files == 0 {
+			return nil, errors.Errorf("No YAML files in %v at revision %v", dir, ref)
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, &ParseError{Files: failed}
+	}
+	return results, nil
+}
+
+// gitError includes the output of git on stderr in the error.
+func gitError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return errors.Wrapf(err, "git failed: %v", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const ciTeamSpec = `apiVersion: kubeflow.org/v1alpha1
+kind: GoogleGroup
+metadata:
+  name: ci-team
+spec:
+  email: ci-team@kubeflow.org
+  members:
+  - email: a@acme.com
+    role: OWNER
+`
+
+const ciTeamSpecEdited = `apiVersion: kubeflow.org/v1alpha1
+kind: GoogleGroup
+metadata:
+  name: ci-team
+spec:
+  email: ci-team@kubeflow.org
+  members:
+  - email: a@acme.com
+    role: OWNER
+  - email: b@acme.com
+    role: MEMBER
+`
+
+const releaseTeamSpec = `apiVersion: kubeflow.org/v1alpha1
+kind: GoogleGroup
+metadata:
+  name: release-team
+spec:
+  email: release-team@kubeflow.org
+`
+
+func TestReadGroupsAt(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git isn't installed; %v", err)
+	}
+
+	repo, err := ioutil.TempDir("", "revisionTest")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(repo)
+
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@kubeflow.org", "-c", "commit.gpgsign=false"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed; %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	write := func(name string, contents string) {
+		p := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory; %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %v; %v", name, err)
+		}
+	}
+
+	git("init", "-q")
+	write("groups/ci-team.yaml", ciTeamSpec)
+	write("groups/README.md", "Files that aren't YAML are ignored.")
+	git("add", "-A")
+	git("commit", "-q", "-m", "first")
+	git("tag", "first")
+
+	write("groups/ci-team.yaml", ciTeamSpecEdited)
+	write("groups/release-team.yaml", releaseTeamSpec)
+	git("add", "-A")
+	git("commit", "-q", "-m", "second")
+
+	// Uncommitted changes are only seen when reading the directory.
+	write("groups/uncommitted.yaml", strings.Replace(releaseTeamSpec, "release-team", "uncommitted", -1))
+
+	// ReadGroupsAt reads dir relative to the current directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory; %v", err)
+	}
+	if err := os.Chdir(repo); err != nil {
+		t.Fatalf("Failed to change directory; %v", err)
+	}
+	defer os.Chdir(wd)
+
+	// summarize maps the email of each group to its members.
+	summarize := func(groups []*v1alpha1.GoogleGroup) map[string][]string {
+		s := map[string][]string{}
+		for _, g := range groups {
+			s[g.Spec.Email] = []string{}
+			for _, m := range g.Spec.Members {
+				s[g.Spec.Email] = append(s[g.Spec.Email], m.Email+" "+m.Role)
+			}
+		}
+		return s
+	}
+
+	type testCase struct {
+		name     string
+		ref      string
+		expected map[string][]string
+	}
+
+	cases := []testCase{
+		{
+			name: "first",
+			ref:  "first",
+			expected: map[string][]string{
+				"ci-team@kubeflow.org": {"a@acme.com OWNER"},
+			},
+		},
+		{
+			name: "head",
+			ref:  "HEAD",
+			expected: map[string][]string{
+				"ci-team@kubeflow.org":      {"a@acme.com OWNER", "b@acme.com MEMBER"},
+				"release-team@kubeflow.org": {},
+			},
+		},
+		{
+			name: "relative-revision",
+			ref:  "HEAD~1",
+			expected: map[string][]string{
+				"ci-team@kubeflow.org": {"a@acme.com OWNER"},
+			},
+		},
+		{
+			name: "directory",
+			ref:  "groups",
+			expected: map[string][]string{
+				"ci-team@kubeflow.org":      {"a@acme.com OWNER", "b@acme.com MEMBER"},
+				"release-team@kubeflow.org": {},
+				"uncommitted@kubeflow.org":  {},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		actual, err := ReadGroupsAt(c.ref, "groups")
+		if err != nil {
+			t.Errorf("Case %v: ReadGroupsAt returned error; %v", c.name, err)
+			continue
+		}
+
+		if d := cmp.Diff(c.expected, summarize(actual)); d != "" {
+			t.Errorf("Case %v: groups mismatch (-want +got):\n%s", c.name, d)
+		}
+	}
+
+	// A spec that can't be parsed is reported rather than skipped; otherwise it would look like the group was removed.
+	write("groups/ci-team.yaml", "spec:\n  email: [ci-team@kubeflow.org\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "third")
+
+	for _, ref := range []string{"HEAD", "groups"} {
+		_, err := ReadGroupsAt(ref, "groups")
+		pErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("ReadGroupsAt(%v) with a malformed spec returned %v; want a ParseError", ref, err)
+			continue
+		}
+
+		if len(pErr.Files) != 1 {
+			t.Errorf("ReadGroupsAt(%v) returned %v; want only ci-team.yaml to fail", ref, pErr)
+		}
+
+		for f := range pErr.Files {
+			if filepath.Base(f) != "ci-team.yaml" {
+				t.Errorf("ReadGroupsAt(%v) reported %v; want ci-team.yaml", ref, f)
+			}
+		}
+	}
+
+	if _, err := ReadGroupsAt("HEAD~1", "groups"); err != nil {
+		t.Errorf("ReadGroupsAt(HEAD~1) returned error; %v", err)
+	}
+
+	if _, err := ReadGroupsAt("no-such-revision", "groups"); err == nil {
+		t.Errorf("ReadGroupsAt should fail for an unknown revision")
+	}
+
+	if _, err := ReadGroupsAt("HEAD", "missing"); err == nil {
+		t.Errorf("ReadGroupsAt should fail for a directory without YAML files")
+	}
+}
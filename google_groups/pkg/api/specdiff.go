@@ -0,0 +1,250 @@
+package api
+
+import (
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/groups"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ChangeType is how a group changed between two revisions of the specs.
+type ChangeType string
+
+const (
+	GroupAdded    ChangeType = "added"
+	GroupRemoved  ChangeType = "removed"
+	GroupModified ChangeType = "modified"
+
+	// massRemovalThreshold is the number of members that can be removed from a group before it is flagged.
+	massRemovalThreshold = 5
+)
+
+// GroupChange describes how a group's spec changed between two revisions.
+type GroupChange struct {
+	Group          string            `json:"group"`
+	Type           ChangeType        `json:"type"`
+	MembersAdded   []v1alpha1.Member `json:"membersAdded,omitempty"`
+	MembersRemoved []v1alpha1.Member `json:"membersRemoved,omitempty"`
+	// MemberChanges are changes to the role or expiration of existing members.
+	MemberChanges []FieldChange `json:"memberChanges,omitempty"`
+	Settings      []FieldChange `json:"settings,omitempty"`
+	// Risks are changes reviewers should look at carefully.
+	Risks []string `json:"risks,omitempty"`
+}
+
+// FieldChange is a change to a single field.
+type FieldChange struct {
+	// Member is the email of the member the field belongs to. It is empty for settings.
+	Member string `json:"member,omitempty"`
+	Field  string `json:"field"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// DiffSpecs compares two revisions of the group specs. It returns the groups that changed sorted by email.
+func DiffSpecs(base []*v1alpha1.GoogleGroup, head []*v1alpha1.GoogleGroup) []*GroupChange {
+	baseByEmail := map[string]*v1alpha1.GoogleGroup{}
+	for _, g := range base {
+		baseByEmail[strings.ToLower(g.Spec.Email)] = g
+	}
+
+	changes := []*GroupChange{}
+	seen := map[string]bool{}
+	for _, h := range head {
+		key := strings.ToLower(h.Spec.Email)
+		seen[key] = true
+
+		b, ok := baseByEmail[key]
+		if !ok {
+			b = &v1alpha1.GoogleGroup{}
+		}
+
+		c := diffSpec(b, h)
+		if !ok {
+			c.Type = GroupAdded
+		}
+
+		if c.Type == GroupAdded || !c.isEmpty() {
+			c.Risks = risks(b, h, c)
+			changes = append(changes, c)
+		}
+	}
+
+	for _, b := range base {
+		if seen[strings.ToLower(b.Spec.Email)] {
+			continue
+		}
+		c := diffSpec(b, &v1alpha1.GoogleGroup{Spec: v1alpha1.GoogleGroupSpec{Email: b.Spec.Email}})
+		c.Type = GroupRemoved
+		c.Settings = []FieldChange{}
+		c.Risks = risks(b, &v1alpha1.GoogleGroup{}, c)
+		changes = append(changes, c)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Group < changes[j].Group
+	})
+	return changes
+}
+
+func diffSpec(base *v1alpha1.GoogleGroup, head *v1alpha1.GoogleGroup) *GroupChange {
+	c := &GroupChange{
+		Group:          head.Spec.Email,
+		Type:           GroupModified,
+		MembersAdded:   []v1alpha1.Member{},
+		MembersRemoved: []v1alpha1.Member{},
+		MemberChanges:  []FieldChange{},
+		Settings:       []FieldChange{},
+	}
+
+	baseMembers := map[string]v1alpha1.Member{}
+	for _, m := range base.Spec.Members {
+		baseMembers[strings.ToLower(m.Email)] = m
+	}
+
+	headMembers := map[string]bool{}
+	for _, m := range head.Spec.Members {
+		key := strings.ToLower(m.Email)
+		headMembers[key] = true
+
+		b, ok := baseMembers[key]
+		if !ok {
+			c.MembersAdded = append(c.MembersAdded, m)
+			continue
+		}
+
+		if b.Role != m.Role {
+			c.MemberChanges = append(c.MemberChanges, FieldChange{Member: m.Email, Field: "role", From: b.Role, To: m.Role})
+		}
+		if b.Expires != m.Expires {
+			c.MemberChanges = append(c.MemberChanges, FieldChange{Member: m.Email, Field: "expires", From: b.Expires, To: m.Expires})
+		}
+	}
+
+	for _, m := range base.Spec.Members {
+		if !headMembers[strings.ToLower(m.Email)] {
+			c.MembersRemoved = append(c.MembersRemoved, m)
+		}
+	}
+
+	settings := []FieldChange{
+		{Field: "autoSync", From: autoSync(base), To: autoSync(head)},
+		{Field: "name", From: base.Spec.Name, To: head.Spec.Name},
+		{Field: "description", From: base.Spec.Description, To: head.Spec.Description},
+		{Field: "whoCanJoin", From: base.Spec.WhoCanJoin, To: head.Spec.WhoCanJoin},
+		{Field: "whoCanPostMessage", From: base.Spec.WhoCanPostMessage, To: head.Spec.WhoCanPostMessage},
+		{Field: "allowExternalMembers", From: base.Spec.AllowExternalMembers, To: head.Spec.AllowExternalMembers},
+	}
+
+	for _, s := range settings {
+		if s.From != s.To {
+			c.Settings = append(c.Settings, s)
+		}
+	}
+	return c
+}
+
+// autoSync returns the effective value of autoSync; groups are synced unless it is explicitly false.
+func autoSync(g *v1alpha1.GoogleGroup) string {
+	if g.Spec.AutoSync != nil && !*g.Spec.AutoSync {
+		return "false"
+	}
+	return "true"
+}
+
+func (c *GroupChange) isEmpty() bool {
+	return len(c.MembersAdded) == 0 && len(c.MembersRemoved) == 0 && len(c.MemberChanges) == 0 && len(c.Settings) == 0
+}
+
+// risks returns the changes that reviewers should look at carefully.
+func risks(base *v1alpha1.GoogleGroup, head *v1alpha1.GoogleGroup, c *GroupChange) []string {
+	r := []string{}
+
+	if c.Type == GroupAdded {
+		r = append(r, "new group")
+	}
+
+	owner := string(groups.OwnerRole)
+	for _, m := range c.MembersAdded {
+		if m.Role == owner {
+			r = append(r, fmt.Sprintf("owner added: %v", m.Email))
+		}
+	}
+	for _, m := range c.MembersRemoved {
+		if m.Role == owner {
+			r = append(r, fmt.Sprintf("owner removed: %v", m.Email))
+		}
+	}
+	for _, m := range c.MemberChanges {
+		if m.Field == "role" && (m.From == owner || m.To == owner) {
+			r = append(r, fmt.Sprintf("owner change: %v role changed from %v to %v", m.Member, m.From, m.To))
+		}
+	}
+
+	domain := emailDomain(c.Group)
+	for _, m := range c.MembersAdded {
+		if d := emailDomain(m.Email); d != "" && d != domain {
+			r = append(r, fmt.Sprintf("external member added: %v", m.Email))
+		}
+	}
+
+	// The syncer doesn't delete groups whose spec is removed so their members aren't removed either.
+	removed := len(c.MembersRemoved)
+	if c.Type != GroupRemoved && (removed >= massRemovalThreshold || (removed >= 2 && removed*2 > len(base.Spec.Members))) {
+		r = append(r, fmt.Sprintf("mass removal: %v of %v members removed", removed, len(base.Spec.Members)))
+	}
+
+	for _, s := range c.Settings {
+		if s.Field == "autoSync" && s.To == "true" && c.Type == GroupModified {
+			r = append(r, "autoSync enabled: members of the live group that aren't in the spec will be removed")
+		}
+	}
+	return r
+}
+
+func emailDomain(email string) string {
+	pieces := strings.Split(strings.ToLower(email), "@")
+	if len(pieces) != 2 {
+		return ""
+	}
+	return pieces[1]
+}
+
+// WriteSpecDiffMarkdown writes the changes as Markdown suitable for a comment on a pull request.
+func WriteSpecDiffMarkdown(w io.Writer, changes []*GroupChange) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "No changes to the group specs.")
+		return err
+	}
+
+	risky := 0
+	for _, c := range changes {
+		risky += len(c.Risks)
+	}
+
+	fmt.Fprintf(w, "**Groups changed: %v; risky changes: %v**\n", len(changes), risky)
+
+	for _, c := range changes {
+		fmt.Fprintf(w, "\n### `%v` (%v)\n\n", c.Group, c.Type)
+		for _, r := range c.Risks {
+			fmt.Fprintf(w, "- :warning: **%v**\n", r)
+		}
+		for _, m := range c.MembersAdded {
+			fmt.Fprintf(w, "- Added member `%v` (%v)\n", m.Email, m.Role)
+		}
+		for _, m := range c.MembersRemoved {
+			fmt.Fprintf(w, "- Removed member `%v` (%v)\n", m.Email, m.Role)
+		}
+		for _, m := range c.MemberChanges {
+			fmt.Fprintf(w, "- Changed %v of `%v` from `%v` to `%v`\n", m.Field, m.Member, m.From, m.To)
+		}
+		for _, s := range c.Settings {
+			if _, err := fmt.Fprintf(w, "- Changed setting `%v` from `%v` to `%v`\n", s.Field, s.From, s.To); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"github.com/gogo/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"testing"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	base := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:    "ci-team@kubeflow.org",
+				AutoSync: proto.Bool(false),
+				Members: []v1alpha1.Member{
+					{Email: "owner@kubeflow.org", Role: "OWNER"},
+					{Email: "a@kubeflow.org", Role: "MEMBER"},
+					{Email: "b@kubeflow.org", Role: "MEMBER", Expires: "2021-01-01"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "release-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@kubeflow.org", Role: "MEMBER"},
+					{Email: "b@kubeflow.org", Role: "MEMBER"},
+					{Email: "c@kubeflow.org", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "blog@kubeflow.org",
+			},
+		},
+	}
+
+	head := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:             "ci-team@kubeflow.org",
+				WhoCanPostMessage: "ALL_MEMBERS_CAN_POST",
+				Members: []v1alpha1.Member{
+					{Email: "owner@kubeflow.org", Role: "MEMBER"},
+					{Email: "a@kubeflow.org", Role: "MEMBER"},
+					{Email: "b@kubeflow.org", Role: "MEMBER", Expires: "2021-06-30"},
+					{Email: "someone@gmail.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "release-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@kubeflow.org", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:   "events@kubeflow.org",
+				Members: []v1alpha1.Member{{Email: "owner@kubeflow.org", Role: "OWNER"}},
+			},
+		},
+	}
+
+	changes := DiffSpecs(base, head)
+
+	type summary struct {
+		Group   string
+		Type    ChangeType
+		Added   int
+		Removed int
+		Changes []FieldChange
+		Risks   []string
+	}
+
+	actual := []summary{}
+	for _, c := range changes {
+		actual = append(actual, summary{
+			Group:   c.Group,
+			Type:    c.Type,
+			Added:   len(c.MembersAdded),
+			Removed: len(c.MembersRemoved),
+			Changes: append(c.MemberChanges, c.Settings...),
+			Risks:   c.Risks,
+		})
+	}
+
+	expectedSummary := []summary{
+		{
+			Group:   "blog@kubeflow.org",
+			Type:    GroupRemoved,
+			Changes: []FieldChange{},
+			Risks:   []string{},
+		},
+		{
+			Group: "ci-team@kubeflow.org",
+			Type:  GroupModified,
+			Added: 1,
+			Changes: []FieldChange{
+				{Member: "owner@kubeflow.org", Field: "role", From: "OWNER", To: "MEMBER"},
+				{Member: "b@kubeflow.org", Field: "expires", From: "2021-01-01", To: "2021-06-30"},
+				{Field: "autoSync", From: "false", To: "true"},
+				{Field: "whoCanPostMessage", From: "", To: "ALL_MEMBERS_CAN_POST"},
+			},
+			Risks: []string{
+				"owner change: owner@kubeflow.org role changed from OWNER to MEMBER",
+				"external member added: someone@gmail.com",
+				"autoSync enabled: members of the live group that aren't in the spec will be removed",
+			},
+		},
+		{
+			Group:   "events@kubeflow.org",
+			Type:    GroupAdded,
+			Added:   1,
+			Changes: []FieldChange{},
+			Risks: []string{
+				"new group",
+				"owner added: owner@kubeflow.org",
+			},
+		},
+		{
+			Group:   "release-team@kubeflow.org",
+			Type:    GroupModified,
+			Removed: 2,
+			Changes: []FieldChange{},
+			Risks: []string{
+				"mass removal: 2 of 3 members removed",
+			},
+		},
+	}
+
+	if d := cmp.Diff(expectedSummary, actual); d != "" {
+		t.Errorf("DiffSpecs() mismatch (-want +got):\n%s", d)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteSpecDiffMarkdown(buf, changes[2:3]); err != nil {
+		t.Fatalf("WriteSpecDiffMarkdown returned error; %v", err)
+	}
+
+	expectedMarkdown := "**Groups changed: 1; risky changes: 2**\n" +
+		"\n" +
+		"### `events@kubeflow.org` (added)\n" +
+		"\n" +
+		"- :warning: **new group**\n" +
+		"- :warning: **owner added: owner@kubeflow.org**\n" +
+		"- Added member `owner@kubeflow.org` (OWNER)\n"
+
+	if d := cmp.Diff(expectedMarkdown, buf.String()); d != "" {
+		t.Errorf("WriteSpecDiffMarkdown() mismatch (-want +got):\n%s", d)
+	}
+}
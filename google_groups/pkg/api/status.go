@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/ghodss/yaml"
+	"github.com/go-logr/zapr"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StatusReport reports the observed state of a set of groups. It is intended to be consumed by
+// dashboards and bots which want to show the live state next to the desired state.
+type StatusReport struct {
+	Groups []GroupStatus `json:"groups"`
+}
+
+// GroupStatus is the observed state of a single group.
+type GroupStatus struct {
+	Email  string                      `json:"email"`
+	Status *v1alpha1.GoogleGroupStatus `json:"status,omitempty"`
+}
+
+// NewStatusReport builds a report of the status of the groups sorted by email.
+func NewStatusReport(groups []*v1alpha1.GoogleGroup) *StatusReport {
+	r := &StatusReport{
+		Groups: []GroupStatus{},
+	}
+
+	for _, g := range groups {
+		r.Groups = append(r.Groups, GroupStatus{
+			Email:  g.Spec.Email,
+			Status: g.Status,
+		})
+	}
+
+	sort.Slice(r.Groups, func(i, j int) bool {
+		return r.Groups[i].Email < r.Groups[j].Email
+	})
+	return r
+}
+
+// WriteStatusReport writes a status report for the groups to output. The report is written as JSON if output
+// ends in .json and as YAML otherwise.
+func WriteStatusReport(groups []*v1alpha1.GoogleGroup, output string) error {
+	log := zapr.NewLogger(zap.L())
+	r := NewStatusReport(groups)
+
+	var b []byte
+	var err error
+	if strings.ToLower(filepath.Ext(output)) == ".json" {
+		b, err = json.MarshalIndent(r, "", "  ")
+	} else {
+		b, err = yaml.Marshal(r)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := ensureDirExists(filepath.Dir(output)); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(output, b, 0644); err != nil {
+		log.Error(err, "Error writing status report", "output", output)
+		return err
+	}
+
+	log.Info("Wrote status report", "output", output)
+	return nil
+}
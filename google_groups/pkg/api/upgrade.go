@@ -1,66 +1,297 @@
 package api
 
 import (
+	"fmt"
+	"github.com/ghodss/yaml"
 	"github.com/go-logr/zapr"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/groups"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
 	"go.uber.org/zap"
-	"sort"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
 )
 
-
 const (
 	expectedSuffix = ".members.txt"
 )
 
-// Upgrade all specs. addUsers a list of users to ensure are present in all groups
-func Upgrade(groups []*v1alpha1.GoogleGroup, addUsers []*v1alpha1.Member, removeUsers map[string]bool) error {
-	log := zapr.NewLogger(zap.L())
+// Transformations is a file of bulk changes to apply to the group specs with upgrade. e.g.
+//
+//	transformations:
+//	- name: remove-autobot
+//	  selector:
+//	    email: "*@kubeflow.org"
+//	  operations:
+//	  - removeMember:
+//	      email: kf-autobot@kf-infra-gitops.iam.gserviceaccount.com
+type Transformations struct {
+	// Transformations are applied in order.
+	Transformations []Transformation `json:"transformations"`
+}
+
+// Transformation applies a list of operations to the groups picked by its selector.
+type Transformation struct {
+	Name       string      `json:"name,omitempty"`
+	Selector   Selector    `json:"selector,omitempty"`
+	Operations []Operation `json:"operations"`
+}
+
+// Selector picks the groups a transformation applies to. A group must match all the criteria that are set;
+// an empty selector matches all groups.
+type Selector struct {
+	// Email is a glob matched against the email of the group e.g. "*-team@kubeflow.org".
+	Email string `json:"email,omitempty"`
+	// Labels are matched against the labels in the group's metadata.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Groups is an explicit list of group emails.
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Operation is a single change. Exactly one of the fields must be set.
+type Operation struct {
+	EnsureMember *EnsureMember `json:"ensureMember,omitempty"`
+	RemoveMember *RemoveMember `json:"removeMember,omitempty"`
+	RenameEmail  *RenameEmail  `json:"renameEmail,omitempty"`
+	SetSetting   *SetSetting   `json:"setSetting,omitempty"`
+}
+
+// EnsureMember adds the member with the role or changes the role of an existing member.
+type EnsureMember struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// RemoveMember removes the member.
+type RemoveMember struct {
+	Email string `json:"email"`
+}
+
+// RenameEmail changes the email of a member e.g. because someone changed their address.
+type RenameEmail struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// SetSetting sets one of the group's settings.
+type SetSetting struct {
+	// Name is the name of the setting in the spec e.g. whoCanPostMessage.
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// settings are the fields of the spec that SetSetting can change.
+var settings = map[string]func(s *v1alpha1.GoogleGroupSpec) *string{
+	"description":          func(s *v1alpha1.GoogleGroupSpec) *string { return &s.Description },
+	"whoCanPostMessage":    func(s *v1alpha1.GoogleGroupSpec) *string { return &s.WhoCanPostMessage },
+	"whoCanJoin":           func(s *v1alpha1.GoogleGroupSpec) *string { return &s.WhoCanJoin },
+	"allowExternalMembers": func(s *v1alpha1.GoogleGroupSpec) *string { return &s.AllowExternalMembers },
+}
+
+// ReadTransformations reads and validates transformations from a YAML file.
+func ReadTransformations(file string) (*Transformations, error) {
+	b, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading transformations %v", file)
+	}
 
-	initMissing := func() map[string]*v1alpha1.Member{
-		r := map[string]*v1alpha1.Member {}
-		for _, a := range addUsers{
-			r[a.Email] = a
+	t := &Transformations{}
+	if err := yaml.Unmarshal(b, t); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing transformations %v", file)
+	}
+
+	if err := t.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "Invalid transformations %v", file)
+	}
+	return t, nil
+}
+
+// Validate returns an error if any of the transformations are invalid.
+func (t *Transformations) Validate() error {
+	for i, tr := range t.Transformations {
+		name := tr.Name
+		if name == "" {
+			name = fmt.Sprintf("%v", i)
+		}
+
+		if tr.Selector.Email != "" {
+			if _, err := path.Match(tr.Selector.Email, ""); err != nil {
+				return errors.Wrapf(err, "transformation %v: invalid email glob %q", name, tr.Selector.Email)
+			}
+		}
+
+		for j, o := range tr.Operations {
+			if err := o.validate(); err != nil {
+				return errors.Wrapf(err, "transformation %v: operation %v", name, j)
+			}
 		}
-		return r
 	}
+	return nil
+}
 
-	for _, g := range groups {
-		missing := initMissing()
+func (o *Operation) validate() error {
+	set := 0
+	if o.EnsureMember != nil {
+		set++
+		if o.EnsureMember.Email == "" {
+			return errors.New("ensureMember requires an email")
+		}
+		if !groups.IsValidGroupRole(groups.GroupRole(o.EnsureMember.Role)) {
+			return errors.Errorf("ensureMember has invalid role %q", o.EnsureMember.Role)
+		}
+	}
+	if o.RemoveMember != nil {
+		set++
+		if o.RemoveMember.Email == "" {
+			return errors.New("removeMember requires an email")
+		}
+	}
+	if o.RenameEmail != nil {
+		set++
+		if o.RenameEmail.From == "" || o.RenameEmail.To == "" {
+			return errors.New("renameEmail requires from and to")
+		}
+	}
+	if o.SetSetting != nil {
+		set++
+		if _, ok := settings[o.SetSetting.Name]; !ok {
+			return errors.Errorf("setSetting has unknown setting %q", o.SetSetting.Name)
+		}
+	}
 
+	if set != 1 {
+		return errors.Errorf("exactly one operation must be set; got %v", set)
+	}
+	return nil
+}
+
+// Matches returns true if the group is selected.
+func (s *Selector) Matches(g *v1alpha1.GoogleGroup) bool {
+	email := strings.ToLower(g.Spec.Email)
+
+	if s.Email != "" {
+		if ok, _ := path.Match(strings.ToLower(s.Email), email); !ok {
+			return false
+		}
+	}
+
+	for k, v := range s.Labels {
+		if actual, ok := g.Labels[k]; !ok || actual != v {
+			return false
+		}
+	}
+
+	if len(s.Groups) > 0 {
+		found := false
+		for _, e := range s.Groups {
+			if strings.ToLower(e) == email {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// apply applies the operation to the group.
+func (o *Operation) apply(g *v1alpha1.GoogleGroup) {
+	members := g.Spec.Members
+
+	switch {
+	case o.EnsureMember != nil:
+		found := false
+		for i := range members {
+			if strings.EqualFold(members[i].Email, o.EnsureMember.Email) {
+				members[i].Role = o.EnsureMember.Role
+				found = true
+			}
+		}
+		if !found {
+			g.Spec.Members = append(members, v1alpha1.Member{Email: o.EnsureMember.Email, Role: o.EnsureMember.Role})
+		}
+	case o.RemoveMember != nil:
 		toKeep := []v1alpha1.Member{}
-		for _, m := range g.Spec.Members {
-			if _, ok := removeUsers[m.Email]; ok {
-				log.Info("Removing member", "group" ,g.Spec.Email , "member", m.Email)
-				continue
+		for _, m := range members {
+			if !strings.EqualFold(m.Email, o.RemoveMember.Email) {
+				toKeep = append(toKeep, m)
 			}
+		}
+		g.Spec.Members = toKeep
+	case o.RenameEmail != nil:
+		for i := range members {
+			if strings.EqualFold(members[i].Email, o.RenameEmail.From) {
+				members[i].Email = o.RenameEmail.To
+			}
+		}
+	case o.SetSetting != nil:
+		*settings[o.SetSetting.Name](&g.Spec) = o.SetSetting.Value
+	}
+}
 
-			toKeep = append(toKeep, m)
+// Upgrade applies the transformations to the groups. A diff of each group changed by a transformation is
+// written to preview. It returns the groups that were changed in the order they were passed in.
+func Upgrade(grps []*v1alpha1.GoogleGroup, t *Transformations, preview io.Writer) ([]*v1alpha1.GoogleGroup, error) {
+	log := zapr.NewLogger(zap.L())
+	changed := map[*v1alpha1.GoogleGroup]bool{}
 
-			desired, ok := missing[m.Email]
+	for i, tr := range t.Transformations {
+		name := tr.Name
+		if name == "" {
+			name = fmt.Sprintf("%v", i)
+		}
 
-			if !ok {
+		for _, g := range grps {
+			if !tr.Selector.Matches(g) {
 				continue
 			}
 
-			log.Info("Group already has member", "group",g.Spec.Email , "member", m.Email)
+			before, err := MarshalGroup(g, nil)
+			if err != nil {
+				return nil, err
+			}
 
-			m.Role = desired.Role
+			for _, o := range tr.Operations {
+				o.apply(g)
+			}
 
-			delete(missing, m.Email)
-		}
+			after, err := MarshalGroup(g, nil)
+			if err != nil {
+				return nil, err
+			}
 
-		g.Spec.Members = toKeep
-		for _, m := range missing {
-			log.Info("Adding member to group", "group", g.Spec.Email, "member", m.Email)
+			if string(before) == string(after) {
+				continue
+			}
 
-			g.Spec.Members = append(g.Spec.Members, *m)
-		}
+			log.Info("Transformation changed group", "transformation", name, "group", g.Spec.Email)
+			changed[g] = true
 
-		// Sort the members
-		sort.Slice(g.Spec.Members[:], func(i, j int) bool {
-			return g.Spec.Members[i].Email < g.Spec.Members[j].Email
-		})
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(string(before)),
+				B:        difflib.SplitLines(string(after)),
+				FromFile: g.Spec.Email,
+				ToFile:   fmt.Sprintf("%v (%v)", g.Spec.Email, name),
+				Context:  3,
+			})
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprint(preview, diff)
+		}
 	}
 
-	return nil
+	results := []*v1alpha1.GoogleGroup{}
+	for _, g := range grps {
+		if changed[g] {
+			results = append(results, g)
+		}
+	}
+	return results, nil
 }
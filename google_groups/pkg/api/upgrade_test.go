@@ -1,60 +1,242 @@
 package api
 
 import (
+	"bytes"
 	"github.com/google/go-cmp/cmp"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"io/ioutil"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"strings"
 	"testing"
 )
 
+func testGroups() []*v1alpha1.GoogleGroup {
+	return []*v1alpha1.GoogleGroup{
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "ci-team", Labels: map[string]string{"team": "infra"}},
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "kf-autobot@kf-infra-gitops.iam.gserviceaccount.com", Role: "MEMBER"},
+					{Email: "jlewi@google.com", Role: "OWNER"},
+					{Email: "old@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "release-team"},
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "release-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "jlewi@google.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "blog"},
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "blog@kubeflow.org",
+			},
+		},
+	}
+}
+
 func TestUpgrade(t *testing.T) {
 	type testCase struct {
-		filename string
-		contents string
-		expected v1alpha1.GoogleGroup
+		name            string
+		transformations Transformations
+		// expected maps the email of each changed group to its members.
+		expected         map[string][]v1alpha1.Member
+		expectedSettings map[string]string
 	}
 
-	cases := []testCase {
+	cases := []testCase{
 		{
-			filename: "calendar-admins.members.txt",
-			contents: `
-
-abe@acme.com
-joe@gmail.net
-
-`,
-			expected: v1alpha1.GoogleGroup{
-				ObjectMeta: v1.ObjectMeta{
-					Name: "calendar-admins@kubeflow.org",
-				},
-				Spec:       v1alpha1.GoogleGroupSpec{
-					Members: []v1alpha1.Member{
-						{
-							Principal: v1alpha1.Principal{
-								User:"abe@acme.com",
-							},
+			name: "remove-member-everywhere",
+			transformations: Transformations{
+				Transformations: []Transformation{
+					{
+						Operations: []Operation{
+							{RemoveMember: &RemoveMember{Email: "KF-autobot@kf-infra-gitops.iam.gserviceaccount.com"}},
 						},
-						{
-							Principal: v1alpha1.Principal{
-								User:"joe@gmail.net",
-							},
+					},
+				},
+			},
+			expected: map[string][]v1alpha1.Member{
+				"ci-team@kubeflow.org": {
+					{Email: "jlewi@google.com", Role: "OWNER"},
+					{Email: "old@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			name: "ensure-member-by-glob",
+			transformations: Transformations{
+				Transformations: []Transformation{
+					{
+						Selector: Selector{Email: "*-team@kubeflow.org"},
+						Operations: []Operation{
+							{EnsureMember: &EnsureMember{Email: "jlewi@google.com", Role: "OWNER"}},
 						},
 					},
 				},
 			},
+			expected: map[string][]v1alpha1.Member{
+				"release-team@kubeflow.org": {
+					{Email: "jlewi@google.com", Role: "OWNER"},
+				},
+			},
+		},
+		{
+			name: "rename-by-label-and-list",
+			transformations: Transformations{
+				Transformations: []Transformation{
+					{
+						Name:     "rename",
+						Selector: Selector{Labels: map[string]string{"team": "infra"}},
+						Operations: []Operation{
+							{RenameEmail: &RenameEmail{From: "old@acme.com", To: "new@acme.com"}},
+						},
+					},
+					{
+						Name:     "add-to-blog",
+						Selector: Selector{Groups: []string{"blog@kubeflow.org"}},
+						Operations: []Operation{
+							{EnsureMember: &EnsureMember{Email: "new@acme.com", Role: "MEMBER"}},
+							{SetSetting: &SetSetting{Name: "whoCanPostMessage", Value: "ALL_MEMBERS_CAN_POST"}},
+						},
+					},
+				},
+			},
+			expected: map[string][]v1alpha1.Member{
+				"ci-team@kubeflow.org": {
+					{Email: "kf-autobot@kf-infra-gitops.iam.gserviceaccount.com", Role: "MEMBER"},
+					{Email: "jlewi@google.com", Role: "OWNER"},
+					{Email: "new@acme.com", Role: "MEMBER"},
+				},
+				"blog@kubeflow.org": {
+					{Email: "new@acme.com", Role: "MEMBER"},
+				},
+			},
+			expectedSettings: map[string]string{
+				"blog@kubeflow.org": "ALL_MEMBERS_CAN_POST",
+			},
 		},
 	}
 
 	for _, c := range cases {
-		actual, err := ConvertTextToGroup(c.filename, c.contents)
+		if err := c.transformations.Validate(); err != nil {
+			t.Errorf("Case %v: Validate returned error; %v", c.name, err)
+			continue
+		}
+
+		preview := &bytes.Buffer{}
+		changed, err := Upgrade(testGroups(), &c.transformations, preview)
 
 		if err != nil {
-			t.Errorf("Failed to convert text %v", err)
+			t.Errorf("Case %v: Upgrade returned error; %v", c.name, err)
 			continue
 		}
 
-		if diff := cmp.Diff(c.expected, *actual); diff != "" {
-			t.Errorf("ConvertTextToGroup() mismatch (-want +got):\n%s", diff)
+		actual := map[string][]v1alpha1.Member{}
+		settings := map[string]string{}
+		for _, g := range changed {
+			actual[g.Spec.Email] = g.Spec.Members
+			if g.Spec.WhoCanPostMessage != "" {
+				settings[g.Spec.Email] = g.Spec.WhoCanPostMessage
+			}
+
+			if !strings.Contains(preview.String(), "--- "+g.Spec.Email) {
+				t.Errorf("Case %v: preview doesn't include a diff for %v:\n%v", c.name, g.Spec.Email, preview.String())
+			}
+		}
+
+		if d := cmp.Diff(c.expected, actual); d != "" {
+			t.Errorf("Case %v: members mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		if c.expectedSettings == nil {
+			c.expectedSettings = map[string]string{}
+		}
+
+		if d := cmp.Diff(c.expectedSettings, settings); d != "" {
+			t.Errorf("Case %v: settings mismatch (-want +got):\n%s", c.name, d)
+		}
+	}
+}
+
+func TestReadTransformations(t *testing.T) {
+	type testCase struct {
+		name     string
+		contents string
+		valid    bool
+	}
+
+	cases := []testCase{
+		{
+			name: "valid",
+			contents: `transformations:
+- name: remove-autobot
+  selector:
+    email: "*@kubeflow.org"
+  operations:
+  - removeMember:
+      email: kf-autobot@kf-infra-gitops.iam.gserviceaccount.com
+  - setSetting:
+      name: whoCanJoin
+      value: INVITED_CAN_JOIN
+`,
+			valid: true,
+		},
+		{
+			name: "two-operations-in-one",
+			contents: `transformations:
+- operations:
+  - removeMember:
+      email: a@acme.com
+    renameEmail:
+      from: a@acme.com
+      to: b@acme.com
+`,
+		},
+		{
+			name: "invalid-role",
+			contents: `transformations:
+- operations:
+  - ensureMember:
+      email: a@acme.com
+      role: ADMIN
+`,
+		},
+		{
+			name: "unknown-setting",
+			contents: `transformations:
+- operations:
+  - setSetting:
+      name: color
+      value: blue
+`,
+		},
+	}
+
+	for _, c := range cases {
+		f, err := ioutil.TempFile("", "transformations*.yaml")
+		if err != nil {
+			t.Fatalf("Could not create temporary file; error %v", err)
+		}
+		f.WriteString(c.contents)
+		f.Close()
+
+		_, err = ReadTransformations(f.Name())
+		os.Remove(f.Name())
+
+		if c.valid && err != nil {
+			t.Errorf("Case %v: ReadTransformations returned error; %v", c.name, err)
+		}
+
+		if !c.valid && err == nil {
+			t.Errorf("Case %v: ReadTransformations should have returned an error", c.name)
 		}
 	}
 }
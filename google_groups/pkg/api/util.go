@@ -62,7 +62,8 @@ func ensureDirExists(dir string) error {
 	return nil
 }
 
-// WriterGroups serializes the groups as YAML to the specified directory
+// WriterGroups serializes the groups as YAML to the specified directory.
+// Existing files are patched in place; see MarshalGroup.
 func WriteGroups(groups []*v1alpha1.GoogleGroup, output string) error {
 	log := zapr.NewLogger(zap.L())
 
@@ -75,16 +76,24 @@ func WriteGroups(groups []*v1alpha1.GoogleGroup, output string) error {
 
 
 	for _, g := range groups {
-		gBytes, err := yaml.Marshal(g)
+		fileName := strings.Split(g.Spec.Email, "@")[0]
+		yamlFile := filepath.Join(output, fileName+".yaml")
+
+		// Patch the existing file so comments and formatting are preserved.
+		existing, err := ioutil.ReadFile(yamlFile)
+
+		if err != nil && !os.IsNotExist(err) {
+			log.Error(err, "Error reading existing file", "target", yamlFile)
+			continue
+		}
+
+		gBytes, err := MarshalGroup(g, existing)
 
 		if err != nil {
 			log.Error(err, "Error marshling group", "group", g)
 			continue
 		}
 
-		fileName := strings.Split(g.Spec.Email, "@")[0]
-		yamlFile := filepath.Join(output, fileName+".yaml")
-
 		err = ioutil.WriteFile(yamlFile, gBytes, 0644)
 
 		if err != nil {
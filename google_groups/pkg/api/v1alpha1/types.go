@@ -1,6 +1,24 @@
 package v1alpha1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+const (
+	// DateFormat is the format of dates in the spec e.g. Member.Expires
+	DateFormat = "2006-01-02"
+
+	// SyncedCondition is the condition type indicating whether the group is in sync with its spec.
+	SyncedCondition = "Synced"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Email",type=string,JSONPath=`.spec.email`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="Members",type=integer,JSONPath=`.status.memberCount`
+// +kubebuilder:printcolumn:name="Last Sync",type=date,JSONPath=`.status.lastSyncTime`
 
 // GoogleGroup defines a google group.
 type GoogleGroup struct {
@@ -8,6 +26,16 @@ type GoogleGroup struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec   GoogleGroupSpec   `json:"spec,omitempty"`
+	Status *GoogleGroupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// GoogleGroupList contains a list of GoogleGroup
+type GoogleGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GoogleGroup `json:"items"`
 }
 
 type GoogleGroupSpec struct {
@@ -17,10 +45,26 @@ type GoogleGroupSpec struct {
 	Name string `json:"name,omitempty"`
 	Description string `json:"description,omitempty"`
 	// https://developers.google.com/admin-sdk/groups-settings/v1/reference/groups#json
-	WhoCanPostMessage string `json:"whoCanPostMessage",omitempty`
-	WhoCanJoin string `json:"whoCanJoin",omitempty`
-	AllowExternalMembers string `json:"allowExternalMembers",omitempty`
+	WhoCanPostMessage string `json:"whoCanPostMessage,omitempty"`
+	WhoCanJoin string `json:"whoCanJoin,omitempty"`
+	AllowExternalMembers string `json:"allowExternalMembers,omitempty"`
 	Members []Member `json:"members,omitempty"`
+	// Notifications controls who is told when the syncer changes the group. If not set no notifications are sent.
+	Notifications *NotificationSettings `json:"notifications,omitempty"`
+}
+
+// NotificationSettings controls the notifications sent when the syncer changes a group.
+type NotificationSettings struct {
+	// Webhook posts the changes to the configured webhook e.g. a Slack channel.
+	Webhook bool `json:"webhook,omitempty"`
+	// NotifyOwners emails the owners of the group.
+	NotifyOwners bool `json:"notifyOwners,omitempty"`
+	// NotifyMembers emails the members who were added or removed.
+	NotifyMembers bool `json:"notifyMembers,omitempty"`
+	// Recipients are additional email addresses to notify.
+	Recipients []string `json:"recipients,omitempty"`
+	// Events restricts notifications to these event types e.g. MemberAdded. If empty all events are sent.
+	Events []string `json:"events,omitempty"`
 }
 
 type Member struct {
@@ -30,4 +74,67 @@ type Member struct {
 	// Role of the member
 	// see https://developers.google.com/admin-sdk/directory/v1/reference/members/insert
 	Role string `json:"role,omitempty"`
+
+	// Expires is an optional date (YYYY-MM-DD) after which the member is removed from the group.
+	// The membership is valid through the end of that day (UTC).
+	// +kubebuilder:validation:Pattern=`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`
+	Expires string `json:"expires,omitempty"`
+}
+
+// ExpiresAt returns the time at which the membership expires. ok is false if the membership doesn't expire.
+func (m Member) ExpiresAt() (t time.Time, ok bool, err error) {
+	if m.Expires == "" {
+		return time.Time{}, false, nil
+	}
+
+	d, err := time.Parse(DateFormat, m.Expires)
+
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return d.Add(24 * time.Hour), true, nil
+}
+
+// IsExpired returns true if the membership has expired. Memberships with an invalid expiration date are
+// never considered expired; validation reports them instead so a typo can't remove someone's access.
+func (m Member) IsExpired(now time.Time) bool {
+	t, ok, err := m.ExpiresAt()
+
+	if err != nil || !ok {
+		return false
+	}
+
+	return !now.Before(t)
+}
+
+// GoogleGroupStatus is the observed state of the group. It is set by the syncer and the controller.
+type GoogleGroupStatus struct {
+	// GroupID is the unique ID of the group in the Directory API.
+	GroupID string `json:"groupId,omitempty"`
+
+	// MemberCount is the number of members observed in the group after the last sync.
+	MemberCount int `json:"memberCount,omitempty"`
+
+	// InSync is true if the last sync succeeded i.e. the live group matches the spec.
+	InSync bool `json:"inSync"`
+
+	// LastError is the error from the last sync. It is empty if the last sync succeeded.
+	LastError string `json:"lastError,omitempty"`
+
+	// ObservedGeneration is the generation of the spec that was last synced.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastSyncTime is the last time a sync was attempted.
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// LastSuccessfulSyncTime is the last time a sync succeeded.
+	LastSuccessfulSyncTime *metav1.Time `json:"lastSuccessfulSyncTime,omitempty"`
+
+	// Conditions describe the current state of the group e.g. whether it is Synced.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GoogleGroup{}, &GoogleGroupList{})
 }
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/groups"
+	"time"
+)
+
+// Severity of a validation issue.
+type Severity string
+
+const (
+	// SeverityError issues mean the spec is invalid and shouldn't be applied.
+	SeverityError Severity = "ERROR"
+	// SeverityWarning issues should be looked at but don't block applying the spec.
+	SeverityWarning Severity = "WARNING"
+)
+
+// Issue is a problem found while validating the group specs.
+type Issue struct {
+	Severity Severity
+	Group    string
+	// Member is the email of the member the issue relates to, if any.
+	Member  string
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Member != "" {
+		return fmt.Sprintf("%v %v: member %v: %v", i.Severity, i.Group, i.Member, i.Message)
+	}
+	return fmt.Sprintf("%v %v: %v", i.Severity, i.Group, i.Message)
+}
+
+// ValidateOptions controls validation.
+type ValidateOptions struct {
+	// Now is the time used to check expiration dates.
+	Now time.Time
+	// ExpiryWarning is how far in advance to warn about memberships that are about to expire.
+	ExpiryWarning time.Duration
+	// ImportConfig is used to check the consent records. If nil consent isn't checked.
+	ImportConfig *ImportConfig
+}
+
+// Validate checks the group specs for problems.
+func Validate(grps []*v1alpha1.GoogleGroup, opts ValidateOptions) []Issue {
+	issues := []Issue{}
+	seenGroups := map[string]bool{}
+
+	for _, g := range grps {
+		email := g.Spec.Email
+		if email == "" {
+			issues = append(issues, Issue{Severity: SeverityError, Group: g.Name, Message: "group has no email"})
+			continue
+		}
+
+		if seenGroups[email] {
+			issues = append(issues, Issue{Severity: SeverityError, Group: email, Message: "group is defined more than once"})
+		}
+		seenGroups[email] = true
+
+		seenMembers := map[string]bool{}
+		for i, m := range g.Spec.Members {
+			if m.Email == "" {
+				issues = append(issues, Issue{Severity: SeverityError, Group: email, Message: fmt.Sprintf("member %v has no email", i)})
+				continue
+			}
+
+			if seenMembers[m.Email] {
+				issues = append(issues, Issue{Severity: SeverityError, Group: email, Member: m.Email, Message: "member is listed more than once"})
+			}
+			seenMembers[m.Email] = true
+
+			if !groups.IsValidGroupRole(groups.GroupRole(m.Role)) {
+				issues = append(issues, Issue{Severity: SeverityError, Group: email, Member: m.Email, Message: fmt.Sprintf("invalid role %q", m.Role)})
+			}
+
+			issues = append(issues, validateExpiry(email, m, opts)...)
+		}
+	}
+
+	if opts.ImportConfig != nil {
+		issues = append(issues, validateConsent(grps, opts.ImportConfig)...)
+	}
+	return issues
+}
+
+func validateExpiry(group string, m v1alpha1.Member, opts ValidateOptions) []Issue {
+	expiresAt, ok, err := m.ExpiresAt()
+
+	if err != nil {
+		return []Issue{{Severity: SeverityError, Group: group, Member: m.Email, Message: fmt.Sprintf("invalid expiration date %q; must be in the form YYYY-MM-DD", m.Expires)}}
+	}
+
+	if !ok {
+		return nil
+	}
+
+	if m.IsExpired(opts.Now) {
+		return []Issue{{Severity: SeverityWarning, Group: group, Member: m.Email, Message: fmt.Sprintf("membership expired on %v; run expire to remove it", m.Expires)}}
+	}
+
+	if expiresAt.Sub(opts.Now) <= opts.ExpiryWarning {
+		days := int(expiresAt.Sub(opts.Now).Hours() / 24)
+		return []Issue{{Severity: SeverityWarning, Group: group, Member: m.Email, Message: fmt.Sprintf("membership expires on %v (in %v days)", m.Expires, days)}}
+	}
+	return nil
+}
+
+// HasErrors returns true if any of the issues is an error.
+func HasErrors(issues []Issue) bool {
+	for _, i := range issues {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	grps := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "release-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@acme.com", Role: "MEMBER"},
+					{Email: "expired@acme.com", Role: "MEMBER", Expires: "2020-10-31"},
+					{Email: "lastday@acme.com", Role: "MEMBER", Expires: "2020-11-01"},
+					{Email: "soon@acme.com", Role: "MEMBER", Expires: "2020-11-10"},
+					{Email: "later@acme.com", Role: "MEMBER", Expires: "2021-06-30"},
+					{Email: "typo@acme.com", Role: "MEMBER", Expires: "06/30/2021"},
+					{Email: "a@acme.com", Role: "OWNER"},
+					{Email: "b@acme.com", Role: "ADMIN"},
+					{Role: "MEMBER"},
+				},
+			},
+		},
+	}
+
+	expected := []Issue{
+		{Severity: SeverityWarning, Group: "release-team@kubeflow.org", Member: "expired@acme.com", Message: "membership expired on 2020-10-31; run expire to remove it"},
+		{Severity: SeverityWarning, Group: "release-team@kubeflow.org", Member: "lastday@acme.com", Message: "membership expires on 2020-11-01 (in 0 days)"},
+		{Severity: SeverityWarning, Group: "release-team@kubeflow.org", Member: "soon@acme.com", Message: "membership expires on 2020-11-10 (in 9 days)"},
+		{Severity: SeverityError, Group: "release-team@kubeflow.org", Member: "typo@acme.com", Message: `invalid expiration date "06/30/2021"; must be in the form YYYY-MM-DD`},
+		{Severity: SeverityError, Group: "release-team@kubeflow.org", Member: "a@acme.com", Message: "member is listed more than once"},
+		{Severity: SeverityError, Group: "release-team@kubeflow.org", Member: "b@acme.com", Message: `invalid role "ADMIN"`},
+		{Severity: SeverityError, Group: "release-team@kubeflow.org", Message: "member 8 has no email"},
+	}
+
+	actual := Validate(grps, ValidateOptions{Now: now, ExpiryWarning: 14 * 24 * time.Hour})
+
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Validate() mismatch (-want +got):\n%s", d)
+	}
+
+	if !HasErrors(actual) {
+		t.Errorf("HasErrors() returned false; want true")
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	grps := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "summit-2018@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@acme.com", Role: "MEMBER", Expires: "2018-12-31"},
+					{Email: "b@acme.com", Role: "OWNER"},
+					{Email: "c@acme.com", Role: "MEMBER", Expires: "2020-11-01"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "d@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+	}
+
+	removed := RemoveExpired(grps, now)
+
+	expectedRemoved := map[string][]string{
+		"summit-2018@kubeflow.org": {"a@acme.com"},
+	}
+
+	if d := cmp.Diff(expectedRemoved, removed); d != "" {
+		t.Errorf("RemoveExpired() removed mismatch (-want +got):\n%s", d)
+	}
+
+	expectedMembers := []v1alpha1.Member{
+		{Email: "b@acme.com", Role: "OWNER"},
+		{Email: "c@acme.com", Role: "MEMBER", Expires: "2020-11-01"},
+	}
+
+	if d := cmp.Diff(expectedMembers, grps[0].Spec.Members); d != "" {
+		t.Errorf("RemoveExpired() members mismatch (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,471 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/pkg/errors"
+	yaml "go.yaml.in/yaml/v3"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MarshalGroup serializes the group as YAML.
+//
+// If existing is not empty it should be the current contents of the file containing the group. The group is
+// patched into the existing YAML so that comments, key order and formatting survive; e.g. comments explaining
+// why someone is a member of a group. Keys that aren't part of the API (e.g. typos) are left untouched so that
+// a human can fix them.
+//
+// If existing is empty the group is serialized in a canonical layout with sorted keys.
+func MarshalGroup(g *v1alpha1.GoogleGroup, existing []byte) ([]byte, error) {
+	desired, err := toNode(g)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &yaml.Node{}
+	if len(bytes.TrimSpace(existing)) > 0 {
+		if err := yaml.Unmarshal(existing, doc); err != nil {
+			return nil, errors.Wrapf(err, "Error parsing existing YAML for group %v", g.Spec.Email)
+		}
+	}
+
+	// Nodes that don't exist yet get the canonical layout.
+	sortKeys(desired)
+
+	p := newPatcher(existing)
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		doc = &yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{desired},
+		}
+	} else {
+		doc.Content[0] = p.patchNode(doc.Content[0], desired, reflect.TypeOf(g))
+	}
+
+	buf := &bytes.Buffer{}
+	e := yaml.NewEncoder(buf)
+	// Match the layout produced by ghodss/yaml which was used to create the existing files.
+	e.SetIndent(2)
+	e.CompactSeqIndent()
+
+	if err := e.Encode(doc); err != nil {
+		return nil, err
+	}
+
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return p.restore(buf.Bytes()), nil
+}
+
+// toNode converts the value to a YAML node using its JSON serialization so the json struct tags are respected.
+// Null values are dropped; they are produced by fields like metadata.creationTimestamp.
+func toNode(v interface{}) (*yaml.Node, error) {
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, err
+	}
+
+	n := doc.Content[0]
+	normalize(n)
+	return n, nil
+}
+
+// normalize clears the flow style produced by parsing JSON and removes null values and the mappings left
+// empty by removing them.
+func normalize(n *yaml.Node) {
+	n.Style = 0
+
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!str" {
+		// Let the encoder decide whether the string needs quotes.
+		return
+	}
+
+	for _, c := range n.Content {
+		normalize(c)
+	}
+
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+
+	content := []*yaml.Node{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		v := n.Content[i+1]
+		if v.ShortTag() == "!!null" || (v.Kind == yaml.MappingNode && len(v.Content) == 0) {
+			continue
+		}
+		content = append(content, n.Content[i], v)
+	}
+	n.Content = content
+}
+
+// sortKeys sorts the keys of all mappings.
+func sortKeys(n *yaml.Node) {
+	for _, c := range n.Content {
+		sortKeys(c)
+	}
+
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+
+	pairs := [][2]*yaml.Node{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i][0].Value < pairs[j][0].Value
+	})
+
+	n.Content = []*yaml.Node{}
+	for _, p := range pairs {
+		n.Content = append(n.Content, p[0], p[1])
+	}
+}
+
+// patcher patches the nodes parsed from source.
+type patcher struct {
+	source []string
+	// preserved maps placeholders to the source text that replaces them after encoding.
+	preserved map[string]preservedText
+}
+
+type preservedText struct {
+	// prefix is the text preceding the scalar on its first line.
+	prefix string
+	text   string
+	value  string
+}
+
+func newPatcher(source []byte) *patcher {
+	return &patcher{
+		source:    strings.Split(string(source), "\n"),
+		preserved: map[string]preservedText{},
+	}
+}
+
+// preserve handles unchanged plain scalars that are wrapped across several lines; e.g. long descriptions.
+// The encoder doesn't let us set the line width so it would join them into a single line. Instead the scalar is
+// replaced with a placeholder which restore replaces with the original text.
+func (p *patcher) preserve(n *yaml.Node) *yaml.Node {
+	if n.Style != 0 || n.Line < 1 || n.Line > len(p.source) {
+		return n
+	}
+
+	line := p.source[n.Line-1]
+	start := n.Column - 1
+	if start < 0 || start > len(line) {
+		return n
+	}
+
+	first := strings.TrimRight(line[start:], " \t\r")
+	if strings.Contains(first, " #") {
+		return n
+	}
+
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	parts := []string{strings.TrimSpace(first)}
+	raw := []string{first}
+	for _, l := range p.source[n.Line:] {
+		t := strings.TrimSpace(l)
+		if t == "" || strings.HasPrefix(t, "#") || strings.Contains(t, " #") {
+			break
+		}
+		if len(l)-len(strings.TrimLeft(l, " ")) <= indent {
+			break
+		}
+		parts = append(parts, t)
+		raw = append(raw, strings.TrimRight(l, " \t\r"))
+	}
+
+	// Only use the original text if it is a wrapped scalar with the same value.
+	if len(parts) < 2 || strings.Join(parts, " ") != n.Value {
+		return n
+	}
+
+	placeholder := fmt.Sprintf("yamlpatch-preserved-%d", len(p.preserved))
+	p.preserved[placeholder] = preservedText{
+		prefix: line[:start],
+		text:   strings.Join(raw, "\n"),
+		value:  n.Value,
+	}
+
+	placeholderNode := *n
+	placeholderNode.Value = placeholder
+	return &placeholderNode
+}
+
+// restore replaces the placeholders in the encoded YAML. The original text is only used if the scalar is at
+// the same position on its line; otherwise the scalar is emitted on a single line.
+func (p *patcher) restore(out []byte) []byte {
+	if len(p.preserved) == 0 {
+		return out
+	}
+
+	lines := strings.Split(string(out), "\n")
+	for i, l := range lines {
+		for placeholder, t := range p.preserved {
+			if !strings.HasSuffix(l, placeholder) {
+				continue
+			}
+			prefix := strings.TrimSuffix(l, placeholder)
+			if prefix == t.prefix {
+				lines[i] = prefix + t.text
+			} else {
+				lines[i] = prefix + t.value
+			}
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// patchNode returns a node with the value of desired that reuses the nodes in current where possible.
+// t is the Go type the nodes are serialized from; it is used to find unknown keys in mappings.
+func (p *patcher) patchNode(current *yaml.Node, desired *yaml.Node, t reflect.Type) *yaml.Node {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if current.Kind != desired.Kind {
+		copyComments(current, desired)
+		return desired
+	}
+
+	switch desired.Kind {
+	case yaml.ScalarNode:
+		if sameScalar(current, desired) {
+			return p.preserve(current)
+		}
+		copyComments(current, desired)
+		return desired
+	case yaml.MappingNode:
+		return p.patchMapping(current, desired, t)
+	case yaml.SequenceNode:
+		return p.patchSequence(current, desired, t)
+	default:
+		return desired
+	}
+}
+
+// sameScalar returns true if the two scalars have the same value.
+func sameScalar(current *yaml.Node, desired *yaml.Node) bool {
+	if current.Value != desired.Value {
+		return false
+	}
+
+	if current.ShortTag() == desired.ShortTag() {
+		return true
+	}
+
+	// Unquoted dates (e.g. expires: 2021-06-30) are parsed as timestamps but are strings in the API.
+	return desired.ShortTag() == "!!str" && current.ShortTag() == "!!timestamp"
+}
+
+func (p *patcher) patchMapping(current *yaml.Node, desired *yaml.Node, t reflect.Type) *yaml.Node {
+	desiredValues := map[string]*yaml.Node{}
+	desiredKeys := []*yaml.Node{}
+	for i := 0; i+1 < len(desired.Content); i += 2 {
+		desiredValues[desired.Content[i].Value] = desired.Content[i+1]
+		desiredKeys = append(desiredKeys, desired.Content[i])
+	}
+
+	known, isStruct := knownFields(t)
+
+	content := []*yaml.Node{}
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(current.Content); i += 2 {
+		k := current.Content[i]
+		v := current.Content[i+1]
+
+		d, ok := desiredValues[k.Value]
+
+		if !ok {
+			// Keep keys that aren't part of the API so we don't silently delete data; e.g. a misspelled field.
+			// Null values are kept as well since they are equivalent to the key being absent;
+			// e.g. creationTimestamp: null in files created with ghodss/yaml.
+			if (isStruct && !known[k.Value]) || v.ShortTag() == "!!null" {
+				content = append(content, k, v)
+			}
+			continue
+		}
+
+		seen[k.Value] = true
+		content = append(content, k, p.patchNode(v, d, fieldType(t, k.Value)))
+	}
+
+	for _, k := range desiredKeys {
+		if seen[k.Value] {
+			continue
+		}
+		content = append(content, k, desiredValues[k.Value])
+	}
+
+	current.Content = content
+	return current
+}
+
+// patchSequence patches a sequence. Items are matched by their identity (see itemKey) so that the comments on an
+// item move with it even if items are added, removed or reordered. Items that can't be identified are matched
+// in order. The order of desired is used.
+func (p *patcher) patchSequence(current *yaml.Node, desired *yaml.Node, t reflect.Type) *yaml.Node {
+	var elemType reflect.Type
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		elemType = t.Elem()
+	}
+
+	byKey := map[string]*yaml.Node{}
+	unidentified := []*yaml.Node{}
+	for _, c := range current.Content {
+		k := itemKey(c)
+		if k == "" {
+			unidentified = append(unidentified, c)
+			continue
+		}
+		if _, ok := byKey[k]; !ok {
+			byKey[k] = c
+		}
+	}
+
+	content := []*yaml.Node{}
+	for _, d := range desired.Content {
+		k := itemKey(d)
+		if k == "" && len(unidentified) > 0 {
+			content = append(content, p.patchNode(unidentified[0], d, elemType))
+			unidentified = unidentified[1:]
+			continue
+		}
+
+		c, ok := byKey[k]
+		if k == "" || !ok {
+			content = append(content, d)
+			continue
+		}
+		delete(byKey, k)
+		content = append(content, p.patchNode(c, d, elemType))
+	}
+
+	current.Content = content
+	return current
+}
+
+// itemKey returns a key identifying an item in a sequence. Mappings are identified by their email; scalars by
+// their value. An empty string means the item can't be identified.
+func itemKey(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return "value:" + n.Value
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == "email" {
+				return "email:" + strings.ToLower(n.Content[i+1].Value)
+			}
+		}
+	}
+	return ""
+}
+
+func copyComments(from *yaml.Node, to *yaml.Node) {
+	to.HeadComment = from.HeadComment
+	to.LineComment = from.LineComment
+	to.FootComment = from.FootComment
+}
+
+// knownFields returns the JSON names of the fields of a struct type. isStruct is false if t isn't a struct; in
+// which case all keys are treated as known.
+func knownFields(t reflect.Type) (known map[string]bool, isStruct bool) {
+	known = map[string]bool{}
+	if t == nil || t.Kind() != reflect.Struct {
+		return known, false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, inline := jsonName(f)
+
+		if inline {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			embedded, _ := knownFields(ft)
+			for k := range embedded {
+				known[k] = true
+			}
+			continue
+		}
+
+		if name != "" {
+			known[name] = true
+		}
+	}
+	return known, true
+}
+
+// fieldType returns the type of the struct field with the given JSON name or nil if there isn't one.
+func fieldType(t reflect.Type, name string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+
+	if t.Kind() == reflect.Map {
+		return t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		n, inline := jsonName(f)
+
+		if inline {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if r := fieldType(ft, name); r != nil {
+				return r
+			}
+			continue
+		}
+
+		if n == name {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+// jsonName returns the name of the field in JSON and whether it is inlined into its parent.
+func jsonName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+
+	if tag == "-" {
+		return "", false
+	}
+
+	name := strings.Split(tag, ",")[0]
+
+	if name == "" && (f.Anonymous || strings.Contains(tag, "inline")) {
+		return "", true
+	}
+
+	if name == "" {
+		return f.Name, false
+	}
+	return name, false
+}
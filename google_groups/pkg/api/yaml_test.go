@@ -0,0 +1,128 @@
+package api
+
+import (
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"testing"
+)
+
+const existingGroup = `# Members of the CI team.
+apiVersion: kubeflow.org/v1alpha1
+kind: GoogleGroup
+metadata:
+  creationTimestamp: null
+  name: ci-team
+spec:
+  description: Folks in charge of kubeflow releases. This group is use to grant access to test
+    infrastructure.
+  email: ci-team@kubeflow.org
+  members:
+  # jlewi needs access for ACM management
+  - email: jlewi@google.com
+    role: OWNER
+  - email: a@acme.com # On call
+    role: MEMBER
+  - eamil: typo@acme.com
+    role: MEMBER
+  name: ci-team
+`
+
+func TestMarshalGroup(t *testing.T) {
+	type testCase struct {
+		name     string
+		existing string
+		modify   func(g *v1alpha1.GoogleGroup)
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			name:     "unchanged",
+			existing: existingGroup,
+			modify:   func(g *v1alpha1.GoogleGroup) {},
+			expected: existingGroup,
+		},
+		{
+			name:     "edit-members",
+			existing: existingGroup,
+			modify: func(g *v1alpha1.GoogleGroup) {
+				// Remove a@acme.com, change a role and add a member.
+				g.Spec.Members = []v1alpha1.Member{
+					{Email: "jlewi@google.com", Role: "MANAGER"},
+					g.Spec.Members[2],
+					{Email: "b@acme.com", Role: "MEMBER", Expires: "2021-06-30"},
+				}
+				g.Spec.Description = "CI team"
+			},
+			expected: `# Members of the CI team.
+apiVersion: kubeflow.org/v1alpha1
+kind: GoogleGroup
+metadata:
+  creationTimestamp: null
+  name: ci-team
+spec:
+  description: CI team
+  email: ci-team@kubeflow.org
+  members:
+  # jlewi needs access for ACM management
+  - email: jlewi@google.com
+    role: MANAGER
+  - eamil: typo@acme.com
+    role: MEMBER
+  - email: b@acme.com
+    expires: "2021-06-30"
+    role: MEMBER
+  name: ci-team
+`,
+		},
+		{
+			name: "new-file",
+			modify: func(g *v1alpha1.GoogleGroup) {
+				g.Spec.Members = g.Spec.Members[:1]
+				g.Spec.Description = ""
+			},
+			expected: `apiVersion: kubeflow.org/v1alpha1
+kind: GoogleGroup
+metadata:
+  name: ci-team
+spec:
+  email: ci-team@kubeflow.org
+  members:
+  - email: jlewi@google.com
+    role: OWNER
+  name: ci-team
+`,
+		},
+	}
+
+	for _, c := range cases {
+		g := &v1alpha1.GoogleGroup{}
+		if err := yaml.Unmarshal([]byte(existingGroup), g); err != nil {
+			t.Fatalf("Could not parse group; error %v", err)
+		}
+
+		c.modify(g)
+
+		actual, err := MarshalGroup(g, []byte(c.existing))
+		if err != nil {
+			t.Errorf("Case %v: MarshalGroup returned error; %v", c.name, err)
+			continue
+		}
+
+		if d := cmp.Diff(c.expected, string(actual)); d != "" {
+			t.Errorf("Case %v: YAML mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		// The output should parse back to the same group.
+		roundTrip := &v1alpha1.GoogleGroup{}
+		if err := yaml.Unmarshal(actual, roundTrip); err != nil {
+			t.Errorf("Case %v: Could not parse output; error %v", c.name, err)
+			continue
+		}
+
+		if d := cmp.Diff(g, roundTrip); d != "" {
+			t.Errorf("Case %v: Round trip mismatch (-want +got):\n%s", c.name, d)
+		}
+	}
+}
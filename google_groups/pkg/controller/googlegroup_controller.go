@@ -0,0 +1,164 @@
+// Package controller implements a Kubernetes controller that reconciles GoogleGroup resources.
+package controller
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/groups"
+	"golang.org/x/time/rate"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"time"
+)
+
+const (
+	// Reasons used for the Synced condition.
+	ReasonSynced           = "Synced"
+	ReasonSyncFailed       = "SyncFailed"
+	ReasonInvalidSpec      = "InvalidSpec"
+	ReasonAutoSyncDisabled = "AutoSyncDisabled"
+)
+
+// Syncer syncs group specs to Google Groups. It is implemented by groups.GroupSyncer.
+type Syncer interface {
+	Sync(groupSpecs []*v1alpha1.GoogleGroup) error
+}
+
+// GoogleGroupReconciler reconciles GoogleGroup objects by syncing them to Google Groups.
+type GoogleGroupReconciler struct {
+	Client client.Client
+	Syncer Syncer
+	Log    logr.Logger
+
+	// ResyncPeriod is how often to resync a group even if it hasn't changed; this corrects drift
+	// caused by changes made outside the controller.
+	ResyncPeriod time.Duration
+
+	// BaseDelay and MaxDelay control the per item exponential backoff after a failed sync.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// QPS and Burst limit the overall rate of syncs to avoid exceeding the Directory API quota.
+	QPS   float64
+	Burst int
+}
+
+// +kubebuilder:rbac:groups=groups.kubeflow.org,resources=googlegroups,verbs=get;list;watch
+// +kubebuilder:rbac:groups=groups.kubeflow.org,resources=googlegroups/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile syncs a single GoogleGroup and records the result in its status.
+func (r *GoogleGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("googlegroup", req.NamespacedName)
+
+	g := &v1alpha1.GoogleGroup{}
+	if err := r.Client.Get(ctx, req.NamespacedName, g); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Deleting the resource doesn't delete the Google Group.
+			log.Info("GoogleGroup not found; it was deleted")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if g.Status == nil {
+		g.Status = &v1alpha1.GoogleGroupStatus{}
+	}
+
+	condition := metav1.Condition{
+		Type:               v1alpha1.SyncedCondition,
+		ObservedGeneration: g.Generation,
+	}
+
+	var syncErr error
+	if g.Spec.AutoSync != nil && !*g.Spec.AutoSync {
+		log.Info("AutoSync not enabled for group", "group", g.Spec.Email)
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = ReasonAutoSyncDisabled
+		condition.Message = "autoSync is false; the group is not managed"
+	} else {
+		// The syncer records the observed state of the group e.g. the member count in the status.
+		syncErr = r.Syncer.Sync([]*v1alpha1.GoogleGroup{g})
+
+		if syncErr != nil {
+			log.Error(syncErr, "Failed to sync group", "group", g.Spec.Email)
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = ReasonSyncFailed
+			if groups.IsPermanent(syncErr) {
+				condition.Reason = ReasonInvalidSpec
+			}
+			condition.Message = syncErr.Error()
+
+			if g.Status.LastError != "" {
+				condition.Message = g.Status.LastError
+			}
+		} else {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = ReasonSynced
+			condition.Message = "Group is in sync with its spec"
+		}
+	}
+
+	g.Status.ObservedGeneration = g.Generation
+	meta.SetStatusCondition(&g.Status.Conditions, condition)
+
+	if err := r.Client.Status().Update(ctx, g); err != nil {
+		log.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+
+	if groups.IsPermanent(syncErr) {
+		// Syncing again fails the same way; changing the spec bumps the generation which triggers a new reconcile.
+		log.Info("Not retrying the group until its spec changes", "group", g.Spec.Email)
+		return ctrl.Result{}, nil
+	}
+
+	if syncErr != nil {
+		// Returning the error requeues the item using the rate limiter's backoff.
+		return ctrl.Result{}, syncErr
+	}
+
+	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+}
+
+// SetupWithManager registers the reconciler with the manager.
+func (r *GoogleGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.BaseDelay == 0 {
+		r.BaseDelay = 5 * time.Second
+	}
+
+	if r.MaxDelay == 0 {
+		r.MaxDelay = 30 * time.Minute
+	}
+
+	if r.QPS == 0 {
+		r.QPS = 1
+	}
+
+	if r.Burst == 0 {
+		r.Burst = 10
+	}
+
+	rateLimiter := workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(r.BaseDelay, r.MaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(r.QPS), r.Burst)},
+	)
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.GoogleGroup{}).
+		// Ignore updates to the status; we only need to sync when the spec changes.
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: 1,
+			RateLimiter:             rateLimiter,
+		}).
+		Complete(r)
+}
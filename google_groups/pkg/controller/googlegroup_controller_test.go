@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/zapr"
+	"github.com/gogo/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/groups"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+// fakeSyncer records the groups it was asked to sync.
+type fakeSyncer struct {
+	synced []string
+	err    error
+	now    metav1.Time
+}
+
+func (s *fakeSyncer) Sync(groupSpecs []*v1alpha1.GoogleGroup) error {
+	for _, g := range groupSpecs {
+		s.synced = append(s.synced, g.Spec.Email)
+		g.Status.LastSyncTime = &s.now
+		g.Status.InSync = s.err == nil
+		g.Status.MemberCount = 2
+		if s.err != nil {
+			g.Status.LastError = s.err.Error()
+		}
+	}
+	return s.err
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	lastSync := metav1.NewTime(now)
+
+	type testCase struct {
+		name           string
+		autoSync       *bool
+		syncErr        error
+		expectedSynced []string
+		expectedErr    bool
+		// expectedRequeue is the RequeueAfter expected when Reconcile doesn't return an error.
+		expectedRequeue time.Duration
+		expected        *v1alpha1.GoogleGroupStatus
+	}
+
+	cases := []testCase{
+		{
+			name:            "success",
+			expectedSynced:  []string{"ci-team@kubeflow.org"},
+			expectedRequeue: time.Hour,
+			expected: &v1alpha1.GoogleGroupStatus{
+				MemberCount:        2,
+				InSync:             true,
+				ObservedGeneration: 3,
+				LastSyncTime:       &lastSync,
+				Conditions: []metav1.Condition{
+					{
+						Type:               v1alpha1.SyncedCondition,
+						Status:             metav1.ConditionTrue,
+						ObservedGeneration: 3,
+						Reason:             ReasonSynced,
+						Message:            "Group is in sync with its spec",
+					},
+				},
+			},
+		},
+		{
+			name:           "sync-error",
+			syncErr:        fmt.Errorf("quota exceeded"),
+			expectedSynced: []string{"ci-team@kubeflow.org"},
+			expectedErr:    true,
+			expected: &v1alpha1.GoogleGroupStatus{
+				MemberCount:        2,
+				LastError:          "quota exceeded",
+				ObservedGeneration: 3,
+				LastSyncTime:       &lastSync,
+				Conditions: []metav1.Condition{
+					{
+						Type:               v1alpha1.SyncedCondition,
+						Status:             metav1.ConditionFalse,
+						ObservedGeneration: 3,
+						Reason:             ReasonSyncFailed,
+						Message:            "quota exceeded",
+					},
+				},
+			},
+		},
+		{
+			// Errors in the spec aren't retried; fixing the spec triggers the next reconcile.
+			name:           "spec-error",
+			syncErr:        &groups.SpecError{Groups: []string{"ci-team@kubeflow.org"}},
+			expectedSynced: []string{"ci-team@kubeflow.org"},
+			expected: &v1alpha1.GoogleGroupStatus{
+				MemberCount:        2,
+				LastError:          "failed to sync groups because of errors in their specs: ci-team@kubeflow.org",
+				ObservedGeneration: 3,
+				LastSyncTime:       &lastSync,
+				Conditions: []metav1.Condition{
+					{
+						Type:               v1alpha1.SyncedCondition,
+						Status:             metav1.ConditionFalse,
+						ObservedGeneration: 3,
+						Reason:             ReasonInvalidSpec,
+						Message:            "failed to sync groups because of errors in their specs: ci-team@kubeflow.org",
+					},
+				},
+			},
+		},
+		{
+			name:            "autosync-disabled",
+			autoSync:        proto.Bool(false),
+			expectedRequeue: time.Hour,
+			expected: &v1alpha1.GoogleGroupStatus{
+				ObservedGeneration: 3,
+				Conditions: []metav1.Condition{
+					{
+						Type:               v1alpha1.SyncedCondition,
+						Status:             metav1.ConditionFalse,
+						ObservedGeneration: 3,
+						Reason:             ReasonAutoSyncDisabled,
+						Message:            "autoSync is false; the group is not managed",
+					},
+				},
+			},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to build scheme; error %v", err)
+	}
+
+	for _, c := range cases {
+		g := &v1alpha1.GoogleGroup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "ci-team",
+				Namespace:  "groups",
+				Generation: 3,
+			},
+			Spec: v1alpha1.GoogleGroupSpec{
+				AutoSync: c.autoSync,
+				Email:    "ci-team@kubeflow.org",
+			},
+		}
+
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(g).Build()
+		syncer := &fakeSyncer{err: c.syncErr, now: lastSync}
+
+		r := &GoogleGroupReconciler{
+			Client:       k8sClient,
+			Syncer:       syncer,
+			Log:          zapr.NewLogger(zap.L()),
+			ResyncPeriod: time.Hour,
+		}
+
+		name := types.NamespacedName{Namespace: "groups", Name: "ci-team"}
+		result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: name})
+
+		if c.expectedErr != (err != nil) {
+			t.Errorf("Case %v: Reconcile returned error %v; want error %v", c.name, err, c.expectedErr)
+		}
+
+		if err == nil && result.RequeueAfter != c.expectedRequeue {
+			t.Errorf("Case %v: Got RequeueAfter %v; want %v", c.name, result.RequeueAfter, c.expectedRequeue)
+		}
+
+		if d := cmp.Diff(c.expectedSynced, syncer.synced); d != "" {
+			t.Errorf("Case %v: synced groups mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		actual := &v1alpha1.GoogleGroup{}
+		if err := k8sClient.Get(context.Background(), name, actual); err != nil {
+			t.Errorf("Case %v: Failed to get GoogleGroup; error %v", c.name, err)
+			continue
+		}
+
+		// LastTransitionTime is set by SetStatusCondition using the real clock.
+		ignoreTransition := cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")
+		timeCmp := cmp.Comparer(func(a, b metav1.Time) bool {
+			return a.Equal(&b)
+		})
+		if d := cmp.Diff(c.expected, actual.Status, ignoreTransition, timeCmp); d != "" {
+			t.Errorf("Case %v: status mismatch (-want +got):\n%s", c.name, d)
+		}
+	}
+}
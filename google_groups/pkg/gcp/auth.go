@@ -0,0 +1,233 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// GoogleRevokeURL is Google's token revocation endpoint.
+	GoogleRevokeURL = "https://oauth2.googleapis.com/revoke"
+	// GoogleTokenInfoURL is Google's endpoint for describing an access token.
+	GoogleTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+)
+
+// AuthManager manages the lifecycle of the OAuth2 credential stored in a TokenCache.
+type AuthManager struct {
+	WebFlow *WebFlowHelper
+	Cache   TokenCache
+	Log     logr.Logger
+
+	// RevokeURL is the token revocation endpoint. Defaults to GoogleRevokeURL.
+	RevokeURL string
+	// TokenInfoURL is used to look up the scopes of a token. Defaults to GoogleTokenInfoURL.
+	TokenInfoURL string
+	// RequiredScopes are the scopes the token should carry. Status reports the ones that are missing.
+	RequiredScopes []string
+}
+
+// TokenStatus describes the credential in a TokenCache.
+type TokenStatus struct {
+	// Cached is false if there is no cached token.
+	Cached bool
+	// Expiry is when the access token expires; after a successful refresh it is the expiry of the new token.
+	Expiry time.Time
+	// Scopes are the scopes granted to the token. They are only known if the token could be refreshed.
+	Scopes []string
+	// MissingScopes are the required scopes the token doesn't carry.
+	MissingScopes []string
+	// ScopeError is why the scopes of the refreshed token couldn't be looked up. The scopes weren't checked if
+	// it is set.
+	ScopeError string
+	// Email is the account the token belongs to if the token has the email scope.
+	Email string
+	// RefreshError is why the token couldn't be refreshed. It is empty if the refresh succeeded.
+	RefreshError string
+	// Revoked is true if the refresh failed because the credential was revoked or expired.
+	Revoked bool
+}
+
+// Login runs the OAuth2 flow, asking the user to consent again, and saves the new token to the cache;
+// replacing any cached token.
+func (m *AuthManager) Login(ctx context.Context) (*oauth2.Token, error) {
+	m.WebFlow.ForceConsent = true
+	ts, err := m.WebFlow.GetTokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := ts.Token()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error getting token")
+	}
+
+	// Read the cache first so the save isn't rejected as a conflict by caches with optimistic concurrency.
+	if _, err := m.Cache.GetToken(); err != nil {
+		m.Log.Info("Ignoring the existing cached token", "reason", err.Error())
+	}
+
+	if err := m.Cache.Save(tok); err != nil {
+		return nil, errors.Wrapf(err, "Error saving token")
+	}
+	return tok, nil
+}
+
+// Status reports on the cached token. It refreshes the token to check that the refresh token still works;
+// the refreshed token is saved to the cache.
+func (m *AuthManager) Status(ctx context.Context) (*TokenStatus, error) {
+	tok, err := m.Cache.GetToken()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading cached token")
+	}
+
+	status := &TokenStatus{}
+	if tok == nil {
+		return status, nil
+	}
+
+	status.Cached = true
+	status.Expiry = tok.Expiry
+
+	if tok.RefreshToken == "" {
+		status.RefreshError = "the cached token has no refresh token"
+		return status, nil
+	}
+
+	// Drop the access token so the token source has to refresh it.
+	src := m.WebFlow.GetOAuthConfig().TokenSource(ctx, &oauth2.Token{RefreshToken: tok.RefreshToken})
+	refreshed, err := NewCachingTokenSource(src, m.Cache, tok, m.Log).Token()
+	if err != nil {
+		status.RefreshError = err.Error()
+		status.Revoked = IsRevoked(err)
+		return status, nil
+	}
+
+	status.Expiry = refreshed.Expiry
+
+	info, err := getTokenInfo(ctx, m.TokenInfoURL, refreshed.AccessToken)
+	if err != nil {
+		m.Log.Error(err, "Could not look up the token's scopes")
+		status.ScopeError = err.Error()
+		return status, nil
+	}
+
+	status.Scopes = strings.Fields(info.Scope)
+	status.Email = info.Email
+	status.MissingScopes = MissingScopes(status.Scopes, m.RequiredScopes)
+	return status, nil
+}
+
+// Revoke revokes the cached credential and clears the cache. A credential that was already revoked or expired
+// is only removed from the cache.
+func (m *AuthManager) Revoke(ctx context.Context) error {
+	tok, err := m.Cache.GetToken()
+	if err != nil {
+		return errors.Wrapf(err, "Error reading cached token")
+	}
+
+	if tok != nil {
+		// Revoking the refresh token also revokes the access tokens issued from it.
+		t := tok.RefreshToken
+		if t == "" {
+			t = tok.AccessToken
+		}
+
+		if err := m.revoke(ctx, t); err != nil {
+			return err
+		}
+	}
+
+	return m.Cache.Clear()
+}
+
+func (m *AuthManager) revoke(ctx context.Context, token string) error {
+	revokeURL := m.RevokeURL
+	if revokeURL == "" {
+		revokeURL = GoogleRevokeURL
+	}
+
+	req, err := http.NewRequest(http.MethodPost, revokeURL, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Error revoking token")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		m.Log.Info("Revoked token")
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	result := struct {
+		Error string `json:"error"`
+	}{}
+	json.Unmarshal(body, &result)
+
+	// Google returns invalid_token if the token was already revoked or has expired.
+	if result.Error == "invalid_token" {
+		m.Log.Info("Token was already revoked or has expired")
+		return nil
+	}
+	return errors.Errorf("Error revoking token; status %v: %s", resp.Status, body)
+}
+
+// Write writes the status in a human readable form.
+func (s *TokenStatus) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	if !s.Cached {
+		fmt.Fprintf(tw, "Token:\tnot cached; run auth login\n")
+		return tw.Flush()
+	}
+
+	fmt.Fprintf(tw, "Token:\tcached\n")
+	if s.Email != "" {
+		fmt.Fprintf(tw, "Account:\t%v\n", s.Email)
+	}
+	fmt.Fprintf(tw, "Expiry:\t%v\n", s.Expiry.Format(time.RFC3339))
+
+	switch {
+	case s.RefreshError == "":
+		fmt.Fprintf(tw, "Refresh:\tok\n")
+	case s.Revoked:
+		fmt.Fprintf(tw, "Refresh:\tfailed; the credential was revoked or expired, run auth login\n")
+	default:
+		fmt.Fprintf(tw, "Refresh:\tfailed; %v\n", s.RefreshError)
+	}
+
+	if len(s.Scopes) > 0 {
+		fmt.Fprintf(tw, "Scopes:\t%v\n", strings.Join(s.Scopes, "\n\t"))
+	}
+
+	if len(s.MissingScopes) > 0 {
+		fmt.Fprintf(tw, "Missing scopes:\t%v\n", strings.Join(s.MissingScopes, "\n\t"))
+	}
+
+	if s.ScopeError != "" {
+		fmt.Fprintf(tw, "Scopes:\tunknown; %v\n", s.ScopeError)
+	}
+	return tw.Flush()
+}
+
+// OK returns true if the token is cached, can be refreshed and is known to carry the required scopes.
+func (s *TokenStatus) OK() bool {
+	return s.Cached && s.RefreshError == "" && s.ScopeError == "" && len(s.MissingScopes) == 0
+}
@@ -0,0 +1,185 @@
+package gcp
+
+import (
+	"context"
+	"github.com/go-logr/zapr"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAuthManager(f *fakeOAuthServer, cache TokenCache) *AuthManager {
+	log := zapr.NewLogger(zap.L())
+	return &AuthManager{
+		WebFlow: &WebFlowHelper{
+			config: f.config(),
+			Log:    log,
+			Out:    ioutil.Discard,
+			OpenBrowser: func(authURL string) error {
+				go http.Get(authURL)
+				return nil
+			},
+		},
+		Cache:        cache,
+		Log:          log,
+		RevokeURL:    f.server.URL + "/revoke",
+		TokenInfoURL: f.server.URL + "/tokeninfo",
+	}
+}
+
+func TestAuthLogin(t *testing.T) {
+	f := newFakeOAuthServer()
+	defer f.server.Close()
+
+	cache := &memoryTokenCache{token: &oauth2.Token{AccessToken: "old", RefreshToken: "old-refresh"}}
+	m := newAuthManager(f, cache)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := m.Login(ctx); err != nil {
+		t.Fatalf("Login returned error; %v", err)
+	}
+
+	if f.prompt != "consent" {
+		t.Errorf("Login didn't force consent; prompt = %q", f.prompt)
+	}
+
+	if d := cmp.Diff([]string{"loopback-token/refresh-1"}, cache.saved); d != "" {
+		t.Errorf("Saved tokens mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestAuthStatus(t *testing.T) {
+	type testCase struct {
+		name    string
+		token   *oauth2.Token
+		revoked bool
+		// noTokenInfo makes looking up the scopes fail.
+		noTokenInfo bool
+		expected    *TokenStatus
+		expectedOK  bool
+	}
+
+	cases := []testCase{
+		{
+			name:     "not-cached",
+			expected: &TokenStatus{},
+		},
+		{
+			name:  "ok",
+			token: &oauth2.Token{AccessToken: "cached", RefreshToken: "refresh-1"},
+			expected: &TokenStatus{
+				Cached: true,
+				Scopes: []string{"scope-a", "scope-b"},
+				Email:  "autobot@kubeflow.org",
+			},
+			expectedOK: true,
+		},
+		{
+			// The token isn't OK if its scopes couldn't be checked.
+			name:        "scopes-unknown",
+			token:       &oauth2.Token{AccessToken: "cached", RefreshToken: "refresh-1"},
+			noTokenInfo: true,
+			expected: &TokenStatus{
+				Cached:     true,
+				ScopeError: "set",
+			},
+		},
+		{
+			name:    "revoked",
+			token:   &oauth2.Token{AccessToken: "cached", RefreshToken: "refresh-1"},
+			revoked: true,
+			expected: &TokenStatus{
+				Cached:  true,
+				Revoked: true,
+			},
+		},
+		{
+			name:  "no-refresh-token",
+			token: &oauth2.Token{AccessToken: "cached"},
+			expected: &TokenStatus{
+				Cached:       true,
+				RefreshError: "the cached token has no refresh token",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		f := newFakeOAuthServer()
+		f.revoked["refresh-1"] = c.revoked
+
+		m := newAuthManager(f, &memoryTokenCache{token: c.token})
+		if c.noTokenInfo {
+			m.TokenInfoURL = f.server.URL + "/missing"
+		}
+		actual, err := m.Status(context.Background())
+		f.server.Close()
+
+		if err != nil {
+			t.Errorf("Case %v: Status returned error; %v", c.name, err)
+			continue
+		}
+
+		if actual.Revoked && actual.RefreshError == "" {
+			t.Errorf("Case %v: revoked status has no refresh error", c.name)
+		}
+
+		if actual.OK() != c.expectedOK {
+			t.Errorf("Case %v: OK() = %v; want %v", c.name, actual.OK(), c.expectedOK)
+		}
+
+		// The expiry and the error messages from the server aren't deterministic.
+		actual.Expiry = time.Time{}
+		if actual.Revoked {
+			actual.RefreshError = ""
+		}
+		if actual.ScopeError != "" {
+			actual.ScopeError = "set"
+		}
+
+		if d := cmp.Diff(c.expected, actual); d != "" {
+			t.Errorf("Case %v: status mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		out := &strings.Builder{}
+		if err := actual.Write(out); err != nil {
+			t.Errorf("Case %v: Write returned error; %v", c.name, err)
+		}
+	}
+}
+
+func TestAuthRevoke(t *testing.T) {
+	f := newFakeOAuthServer()
+	defer f.server.Close()
+
+	cache := &memoryTokenCache{token: &oauth2.Token{AccessToken: "cached", RefreshToken: "refresh-1"}}
+	m := newAuthManager(f, cache)
+
+	if err := m.Revoke(context.Background()); err != nil {
+		t.Fatalf("Revoke returned error; %v", err)
+	}
+
+	if !f.revoked["refresh-1"] {
+		t.Errorf("The refresh token wasn't revoked")
+	}
+
+	if cache.token != nil {
+		t.Errorf("The cache wasn't cleared; it contains %+v", cache.token)
+	}
+
+	// Revoking an already revoked token only clears the cache.
+	cache.token = &oauth2.Token{AccessToken: "cached", RefreshToken: "refresh-1"}
+	if err := m.Revoke(context.Background()); err != nil {
+		t.Errorf("Revoking an already revoked token returned error; %v", err)
+	}
+
+	if cache.token != nil {
+		t.Errorf("The cache wasn't cleared; it contains %+v", cache.token)
+	}
+}
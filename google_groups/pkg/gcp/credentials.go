@@ -2,10 +2,8 @@
 package gcp
 
 import (
-	"cloud.google.com/go/storage"
 	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/gcp/gcs"
@@ -13,10 +11,10 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 const (
@@ -37,40 +35,28 @@ type CredentialHelper interface {
 type WebFlowHelper struct {
 	config *oauth2.Config
 	Log logr.Logger
+
+	// Flow is the OAuth2 flow to use. Defaults to LoopbackFlow.
+	Flow AuthFlow
+	// DeviceAuthURL is the device authorization endpoint used by DeviceFlow. Defaults to GoogleDeviceAuthURL.
+	DeviceAuthURL string
+	// Out is where instructions for the user are printed. Defaults to stdout.
+	Out io.Writer
+	// OpenBrowser is called with the URL the user should visit in LoopbackFlow e.g. to open a browser. It may be nil.
+	OpenBrowser func(authURL string) error
+	// ForceConsent makes LoopbackFlow ask the user to approve access again so a new refresh token is issued.
+	ForceConsent bool
 }
 
 // NewWebFlowHelper constructs a new web flow helper. oAuthClientFile should be the path to a credentials.json
 // downloaded from the API console.
 func NewWebFlowHelper(oAuthClientFile string, scopes []string) (*WebFlowHelper, error) {
-	var fHelper gcs.FileHelper
-
-	if strings.HasPrefix(oAuthClientFile, "gs://") {
-		ctx := context.Background()
-		client, err := storage.NewClient(ctx)
-
-		if err != nil {
-			return nil, err
-		}
-
-		fHelper = &gcs.GcsHelper {
-			Ctx: ctx,
-			Client: client,
-		}
-	} else {
-		fHelper = &gcs.LocalFileHelper{}
-	}
-
-	reader, err := fHelper.NewReader(oAuthClientFile)
+	b, err := readFile(oAuthClientFile)
 
 	if err != nil {
 		return nil, err
-
 	}
-	b, err := ioutil.ReadAll(reader)
 
-	if err != nil {
-		return nil, err
-	}
 	// If modifying these scopes, delete your previously saved token.json.
 	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
@@ -88,29 +74,49 @@ func (h *WebFlowHelper) GetOAuthConfig() (*oauth2.Config) {
 
 // GetTokenSource requests a token from the web, then returns the retrieved token.
 func (h *WebFlowHelper) GetTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
-	authURL := h.config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+	var tok *oauth2.Token
+	var err error
+
+	switch h.Flow {
+	case "", LoopbackFlow:
+		tok, err = h.loopbackToken(ctx)
+	case DeviceFlow:
+		tok, err = h.deviceToken(ctx)
+	default:
+		return nil, errors.Errorf("Unknown auth flow %q; must be %v or %v", h.Flow, LoopbackFlow, DeviceFlow)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to retrieve token from web")
+	}
+
+	return h.config.TokenSource(ctx, tok), nil
+}
 
-	// TODO(jlewi): How to open it automatically?
-	fmt.Printf("Go to the following link in your browser then type the "+
-		"authorization code: \n%v\n", authURL)
+// readFile reads a local file or a URI of any scheme registered with gcs.RegisterScheme; e.g. gs://bucket/path
+// or https://host/path.
+func readFile(uri string) ([]byte, error) {
+	fHelper, err := gcs.NewFileHelper(context.Background(), uri)
 
-	var authCode string
-	if _, err := fmt.Scan(&authCode); err != nil {
-		return nil, errors.Wrapf(err, "Unable to read authorization code")
+	if err != nil {
+		return nil, err
 	}
 
-	tok, err := h.config.Exchange(context.TODO(), authCode)
+	reader, err := fHelper.NewReader(uri)
+
 	if err != nil {
-		return nil, errors.Wrapf(err, "Unable to retrieve token from web: %v")
+		return nil, err
 	}
 
-	return h.config.TokenSource(ctx, tok), nil
+	return ioutil.ReadAll(reader)
 }
 
 // TokenCache defines an interface for caching tokens
 type TokenCache interface {
 	GetToken() (*oauth2.Token, error)
 	Save(token *oauth2.Token) error
+	// Clear removes the cached token.
+	Clear() error
 }
 
 // FileTokenCache implements caching to a file.
@@ -163,6 +169,15 @@ func (c *FileTokenCache) Save(token *oauth2.Token) error {
 	return nil
 }
 
+// Clear removes the cache file.
+func (c *FileTokenCache) Clear() error {
+	c.Log.Info("Removing cached credential", "file", c.CacheFile)
+	if err := os.Remove(c.CacheFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // CachedCredentialHelper is a credential helper that will cache the credential.
 type CachedCredentialHelper struct {
 	CredentialHelper CredentialHelper
@@ -205,6 +220,11 @@ func (c *CachedCredentialHelper) GetTokenSource(ctx context.Context) (oauth2.Tok
 		}
 	}
 
-	ts := c.CredentialHelper.GetOAuthConfig().TokenSource(ctx, tok)
-	return ts, nil
+	// Wrap the token source so refreshed and rotated tokens are written back to the cache.
+	config := c.CredentialHelper.GetOAuthConfig()
+	cts := NewCachingTokenSource(config.TokenSource(ctx, tok), c.TokenCache, tok, log)
+	cts.NewSource = func(t *oauth2.Token) oauth2.TokenSource {
+		return config.TokenSource(ctx, t)
+	}
+	return cts, nil
 }
\ No newline at end of file
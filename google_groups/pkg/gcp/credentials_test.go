@@ -0,0 +1,33 @@
+package gcp
+
+import (
+	"context"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/gcp/gcs"
+	"testing"
+)
+
+func TestNewWebFlowHelperReadsRegisteredScheme(t *testing.T) {
+	files := gcs.NewMemoryFileHelper()
+	gcs.RegisterScheme("mem", func(ctx context.Context) (gcs.FileHelper, error) {
+		return files, nil
+	})
+
+	const uri = "mem://secrets/client_secret.json"
+	w, err := files.NewWriter(uri)
+	if err != nil {
+		t.Fatalf("NewWriter returned error; %v", err)
+	}
+	w.Write([]byte(`{"installed": {"client_id": "some-client", "client_secret": "some-secret", "auth_uri": "https://accounts.google.com/o/oauth2/auth", "token_uri": "https://oauth2.googleapis.com/token", "redirect_uris": ["http://localhost"]}}`))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error; %v", err)
+	}
+
+	h, err := NewWebFlowHelper(uri, []string{"scope-a"})
+	if err != nil {
+		t.Fatalf("NewWebFlowHelper returned error; %v", err)
+	}
+
+	if h.GetOAuthConfig().ClientID != "some-client" {
+		t.Errorf("Got client id %v; want some-client", h.GetOAuthConfig().ClientID)
+	}
+}
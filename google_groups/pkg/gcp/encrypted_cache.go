@@ -0,0 +1,276 @@
+package gcp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// encryptedTokenFormat identifies files written by EncryptedFileTokenCache.
+	encryptedTokenFormat = "kubeflow.org/encrypted-token/v1"
+
+	kdfNone   = "none"
+	kdfScrypt = "scrypt"
+
+	keySize  = 32
+	saltSize = 16
+)
+
+// TokenKey is a key used to encrypt cached tokens. It is either a raw 256 bit key or a passphrase from which a key
+// is derived using scrypt.
+type TokenKey struct {
+	raw        []byte
+	passphrase []byte
+}
+
+// NewTokenKey creates a key from 32 raw bytes.
+func NewTokenKey(raw []byte) (*TokenKey, error) {
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("key must be %v bytes; got %v", keySize, len(raw))
+	}
+	return &TokenKey{raw: raw}, nil
+}
+
+// NewPassphraseKey creates a key derived from a passphrase.
+func NewPassphraseKey(passphrase string) (*TokenKey, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase can't be empty")
+	}
+	return &TokenKey{passphrase: []byte(passphrase)}, nil
+}
+
+// ParseTokenKey creates a key from a specification of the form:
+//
+//  * file:PATH - a file containing 32 bytes or the base64 encoding of 32 bytes
+//  * env:VAR - an environment variable containing the base64 encoding of 32 bytes
+//  * passphrase:VAR - an environment variable containing a passphrase
+func ParseTokenKey(spec string) (*TokenKey, error) {
+	pieces := strings.SplitN(spec, ":", 2)
+	if len(pieces) != 2 || pieces[1] == "" {
+		return nil, fmt.Errorf("key %v is not in the form file:PATH, env:VAR or passphrase:VAR", spec)
+	}
+
+	switch pieces[0] {
+	case "file":
+		b, err := ioutil.ReadFile(pieces[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error reading key file %v", pieces[1])
+		}
+
+		if len(b) == keySize {
+			return NewTokenKey(b)
+		}
+		return decodeKey(strings.TrimSpace(string(b)), "key file "+pieces[1])
+	case "env":
+		v, ok := os.LookupEnv(pieces[1])
+		if !ok {
+			return nil, fmt.Errorf("environment variable %v isn't set", pieces[1])
+		}
+		return decodeKey(strings.TrimSpace(v), "environment variable "+pieces[1])
+	case "passphrase":
+		v, ok := os.LookupEnv(pieces[1])
+		if !ok {
+			return nil, fmt.Errorf("environment variable %v isn't set", pieces[1])
+		}
+		return NewPassphraseKey(v)
+	default:
+		return nil, fmt.Errorf("key %v has unknown type %v; must be file, env or passphrase", spec, pieces[0])
+	}
+}
+
+func decodeKey(encoded string, source string) (*TokenKey, error) {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error decoding %v; it should contain a base64 encoded key", source)
+	}
+	k, err := NewTokenKey(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid key in %v", source)
+	}
+	return k, nil
+}
+
+func (k *TokenKey) kdf() string {
+	if k.passphrase != nil {
+		return kdfScrypt
+	}
+	return kdfNone
+}
+
+// aead returns the cipher for the key given the salt stored with the ciphertext.
+func (k *TokenKey) aead(salt []byte) (cipher.AEAD, error) {
+	key := k.raw
+	if k.passphrase != nil {
+		// Parameters recommended by https://godoc.org/golang.org/x/crypto/scrypt#Key
+		derived, err := scrypt.Key(k.passphrase, salt, 32768, 8, 1, keySize)
+		if err != nil {
+			return nil, err
+		}
+		key = derived
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedToken is the format of an encrypted token cache.
+type encryptedToken struct {
+	Format string `json:"format"`
+	KDF    string `json:"kdf"`
+	Salt   []byte `json:"salt,omitempty"`
+	Nonce  []byte `json:"nonce"`
+	Data   []byte `json:"data"`
+}
+
+// EncryptedFileTokenCache caches the token in a file encrypted with AES-256-GCM.
+//
+// Files written by FileTokenCache are migrated; the plaintext token is read and the file is rewritten encrypted.
+// To rotate the key set Key to the new key and OldKeys to the previous keys; a file encrypted with an old key is
+// rewritten with Key the next time it is read.
+type EncryptedFileTokenCache struct {
+	CacheFile string
+	// Key is used to encrypt the token.
+	Key *TokenKey
+	// OldKeys are only used to decrypt files written with a previous key.
+	OldKeys []*TokenKey
+	Log     logr.Logger
+}
+
+func (c *EncryptedFileTokenCache) GetToken() (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(c.CacheFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	e := &encryptedToken{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing token cache %v", c.CacheFile)
+	}
+
+	if e.Format != encryptedTokenFormat {
+		// The file was written by FileTokenCache.
+		tok := &oauth2.Token{}
+		if err := json.Unmarshal(b, tok); err != nil {
+			return nil, errors.Wrapf(err, "Error parsing token cache %v", c.CacheFile)
+		}
+		c.Log.Info("Encrypting plaintext token cache", "file", c.CacheFile)
+		return tok, c.Save(tok)
+	}
+
+	for i, k := range append([]*TokenKey{c.Key}, c.OldKeys...) {
+		if k.kdf() != e.KDF {
+			continue
+		}
+
+		aead, err := k.aead(e.Salt)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err := aead.Open(nil, e.Nonce, e.Data, nil)
+		if err != nil {
+			// Encrypted with a different key.
+			continue
+		}
+
+		tok := &oauth2.Token{}
+		if err := json.Unmarshal(plaintext, tok); err != nil {
+			return nil, errors.Wrapf(err, "Error parsing decrypted token cache %v", c.CacheFile)
+		}
+
+		if i > 0 {
+			c.Log.Info("Re-encrypting token cache with the new key", "file", c.CacheFile)
+			return tok, c.Save(tok)
+		}
+		return tok, nil
+	}
+
+	return nil, fmt.Errorf("token cache %v couldn't be decrypted with any of the configured keys", c.CacheFile)
+}
+
+// Save encrypts the token and writes it to the file.
+func (c *EncryptedFileTokenCache) Save(token *oauth2.Token) error {
+	c.Log.Info("Saving encrypted credential", "file", c.CacheFile)
+
+	plaintext, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	e := &encryptedToken{
+		Format: encryptedTokenFormat,
+		KDF:    c.Key.kdf(),
+	}
+
+	if e.KDF == kdfScrypt {
+		e.Salt = make([]byte, saltSize)
+		if _, err := rand.Read(e.Salt); err != nil {
+			return err
+		}
+	}
+
+	aead, err := c.Key.aead(e.Salt)
+	if err != nil {
+		return err
+	}
+
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return err
+	}
+	e.Data = aead.Seal(nil, e.Nonce, plaintext, nil)
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.CacheFile)
+	if err := os.MkdirAll(dir, CredentialDirPermMode); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so a failed write doesn't destroy the existing cache.
+	f, err := ioutil.TempFile(dir, filepath.Base(c.CacheFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.CacheFile)
+}
+
+// Clear removes the cache file.
+func (c *EncryptedFileTokenCache) Clear() error {
+	c.Log.Info("Removing encrypted credential", "file", c.CacheFile)
+	if err := os.Remove(c.CacheFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package gcp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedFileTokenCache(t *testing.T) {
+	oldKey, _ := NewTokenKey(bytes.Repeat([]byte{1}, 32))
+	newKey, _ := NewTokenKey(bytes.Repeat([]byte{2}, 32))
+	passphrase, _ := NewPassphraseKey("correct horse battery staple")
+
+	type testCase struct {
+		name string
+		// write writes the existing cache file.
+		write   func(file string) error
+		key     *TokenKey
+		oldKeys []*TokenKey
+		// expectErr is true if reading the cache should fail.
+		expectErr bool
+	}
+
+	tok := &oauth2.Token{AccessToken: "access", RefreshToken: "super-secret-refresh", TokenType: "Bearer"}
+	log := zapr.NewLogger(zap.L())
+
+	cases := []testCase{
+		{
+			name: "raw-key",
+			write: func(file string) error {
+				return (&EncryptedFileTokenCache{CacheFile: file, Key: newKey, Log: log}).Save(tok)
+			},
+			key: newKey,
+		},
+		{
+			name: "passphrase",
+			write: func(file string) error {
+				return (&EncryptedFileTokenCache{CacheFile: file, Key: passphrase, Log: log}).Save(tok)
+			},
+			key: passphrase,
+		},
+		{
+			name: "migrate-plaintext",
+			write: func(file string) error {
+				return (&FileTokenCache{CacheFile: file, Log: log}).Save(tok)
+			},
+			key: newKey,
+		},
+		{
+			name: "rotate-key",
+			write: func(file string) error {
+				return (&EncryptedFileTokenCache{CacheFile: file, Key: oldKey, Log: log}).Save(tok)
+			},
+			key:     newKey,
+			oldKeys: []*TokenKey{passphrase, oldKey},
+		},
+		{
+			name: "wrong-key",
+			write: func(file string) error {
+				return (&EncryptedFileTokenCache{CacheFile: file, Key: oldKey, Log: log}).Save(tok)
+			},
+			key:       newKey,
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "tokenCache")
+		if err != nil {
+			t.Fatalf("Could not create temporary directory; error %v", err)
+		}
+
+		file := filepath.Join(dir, "cache", "token")
+		if err := c.write(file); err != nil {
+			t.Fatalf("Case %v: could not write cache; error %v", c.name, err)
+		}
+
+		cache := &EncryptedFileTokenCache{CacheFile: file, Key: c.key, OldKeys: c.oldKeys, Log: log}
+		actual, err := cache.GetToken()
+
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("Case %v: GetToken should have returned an error", c.name)
+			}
+			os.RemoveAll(dir)
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Case %v: GetToken returned error; %v", c.name, err)
+			os.RemoveAll(dir)
+			continue
+		}
+
+		if actual.AccessToken != tok.AccessToken || actual.RefreshToken != tok.RefreshToken {
+			t.Errorf("Case %v: got token %+v; want %+v", c.name, actual, tok)
+		}
+
+		// After reading, the file should be encrypted with the current key only.
+		b, _ := ioutil.ReadFile(file)
+		if strings.Contains(string(b), tok.RefreshToken) {
+			t.Errorf("Case %v: cache contains the plaintext refresh token:\n%s", c.name, b)
+		}
+
+		if _, err := (&EncryptedFileTokenCache{CacheFile: file, Key: c.key, Log: log}).GetToken(); err != nil {
+			t.Errorf("Case %v: cache can't be read with only the current key; error %v", c.name, err)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestParseTokenKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{7}, 32)
+	encoded := base64.StdEncoding.EncodeToString(raw)
+
+	dir, err := ioutil.TempDir("", "tokenKey")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rawFile := filepath.Join(dir, "raw.key")
+	ioutil.WriteFile(rawFile, raw, 0600)
+	encodedFile := filepath.Join(dir, "encoded.key")
+	ioutil.WriteFile(encodedFile, []byte(encoded+"\n"), 0600)
+
+	os.Setenv("TEST_TOKEN_KEY", encoded)
+	defer os.Unsetenv("TEST_TOKEN_KEY")
+	os.Setenv("TEST_TOKEN_PASSPHRASE", "hunter2")
+	defer os.Unsetenv("TEST_TOKEN_PASSPHRASE")
+
+	type testCase struct {
+		spec       string
+		raw        []byte
+		passphrase string
+		expectErr  bool
+	}
+
+	cases := []testCase{
+		{spec: "file:" + rawFile, raw: raw},
+		{spec: "file:" + encodedFile, raw: raw},
+		{spec: "env:TEST_TOKEN_KEY", raw: raw},
+		{spec: "passphrase:TEST_TOKEN_PASSPHRASE", passphrase: "hunter2"},
+		{spec: "env:TEST_TOKEN_PASSPHRASE", expectErr: true},
+		{spec: "env:UNSET_TOKEN_KEY", expectErr: true},
+		{spec: "vault:secret", expectErr: true},
+		{spec: "file:", expectErr: true},
+	}
+
+	for _, c := range cases {
+		k, err := ParseTokenKey(c.spec)
+
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("Case %v: ParseTokenKey should have returned an error", c.spec)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Case %v: ParseTokenKey returned error; %v", c.spec, err)
+			continue
+		}
+
+		if !bytes.Equal(k.raw, c.raw) || string(k.passphrase) != c.passphrase {
+			t.Errorf("Case %v: got key %+v; want raw %v passphrase %v", c.spec, k, c.raw, c.passphrase)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package gcs
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/internal/apitest"
+	"google.golang.org/api/option"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeObject is an object stored by fakeGCSServer.
+type fakeObject struct {
+	data       []byte
+	generation int64
+}
+
+// fakeGCSServer is a minimal in memory implementation of the parts of the GCS JSON API used by GcsHelper.
+type fakeGCSServer struct {
+	mu sync.Mutex
+	// buckets maps bucket names to the objects in the bucket.
+	buckets map[string]map[string]*fakeObject
+	// failures maps "{bucket}" or "{bucket}/{object}" to a status code returned for any request for it.
+	failures map[string]int
+	// generation is the last generation assigned to an object.
+	generation int64
+	server     *httptest.Server
+}
+
+// newFakeGCSServer starts a fake GCS server and returns a storage client that talks to it.
+func newFakeGCSServer(t *testing.T) (*fakeGCSServer, *storage.Client) {
+	f := &fakeGCSServer{
+		buckets:  map[string]map[string]*fakeObject{},
+		failures: map[string]int{},
+	}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(f.handle))
+
+	client, err := storage.NewClient(context.Background(),
+		option.WithEndpoint(f.server.URL+"/storage/v1/"),
+		option.WithHTTPClient(f.server.Client()))
+	if err != nil {
+		f.server.Close()
+		t.Fatalf("Error creating storage client; %v", err)
+	}
+	return f, client
+}
+
+// addObject adds an object; creating the bucket if needed. An empty name only creates the bucket.
+func (f *fakeGCSServer) addObject(bucket string, name string, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.putObject(bucket, name, []byte(data))
+}
+
+// object returns the contents of an object and whether it exists.
+func (f *fakeGCSServer) object(bucket string, name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	o, ok := f.buckets[bucket][name]
+	if !ok {
+		return "", false
+	}
+	return string(o.data), true
+}
+
+func (f *fakeGCSServer) putObject(bucket string, name string, data []byte) *fakeObject {
+	if _, ok := f.buckets[bucket]; !ok {
+		f.buckets[bucket] = map[string]*fakeObject{}
+	}
+	if name == "" {
+		return nil
+	}
+	f.generation++
+	o := &fakeObject{data: data, generation: f.generation}
+	f.buckets[bucket][name] = o
+	return o
+}
+
+func (f *fakeGCSServer) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Object names are escaped so split the escaped path.
+	p := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+
+	if strings.HasPrefix(p, "upload/storage/v1/b/") {
+		pieces := strings.Split(strings.TrimPrefix(p, "upload/storage/v1/b/"), "/")
+		if len(pieces) != 2 || pieces[1] != "o" || r.Method != http.MethodPost {
+			http.Error(w, fmt.Sprintf("%v %v isn't supported by the fake", r.Method, r.URL), http.StatusNotImplemented)
+			return
+		}
+		f.upload(w, r, pieces[0])
+		return
+	}
+
+	if strings.HasPrefix(p, "storage/v1/b/") {
+		pieces := strings.SplitN(strings.TrimPrefix(p, "storage/v1/b/"), "/", 3)
+		bucket := pieces[0]
+		switch {
+		case len(pieces) == 1 && r.Method == http.MethodGet:
+			f.getBucket(w, bucket)
+		case len(pieces) == 2 && pieces[1] == "o" && r.Method == http.MethodGet:
+			f.listObjects(w, bucket, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+		case len(pieces) == 3 && pieces[1] == "o" && r.Method == http.MethodGet:
+			f.getObject(w, bucket, unescape(pieces[2]), false)
+		case len(pieces) == 3 && pieces[1] == "o" && r.Method == http.MethodDelete:
+			f.deleteObject(w, bucket, unescape(pieces[2]))
+		default:
+			http.Error(w, fmt.Sprintf("%v %v isn't supported by the fake", r.Method, r.URL), http.StatusNotImplemented)
+		}
+		return
+	}
+
+	// Reads of the object's contents are sent to /{bucket}/{object}.
+	pieces := strings.SplitN(p, "/", 2)
+	if len(pieces) != 2 || r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("%v %v isn't supported by the fake", r.Method, r.URL), http.StatusNotImplemented)
+		return
+	}
+	f.getObject(w, pieces[0], unescape(pieces[1]), true)
+}
+
+func (f *fakeGCSServer) getBucket(w http.ResponseWriter, bucket string) {
+	if code, ok := f.failures[bucket]; ok {
+		apitest.WriteError(w, code, "")
+		return
+	}
+	if _, ok := f.buckets[bucket]; !ok {
+		apitest.WriteError(w, http.StatusNotFound, "")
+		return
+	}
+	apitest.WriteJSON(w, map[string]interface{}{"name": bucket})
+}
+
+// listObjects lists the objects in a single page.
+func (f *fakeGCSServer) listObjects(w http.ResponseWriter, bucket string, prefix string, delimiter string) {
+	if code, ok := f.failures[bucket]; ok {
+		apitest.WriteError(w, code, "")
+		return
+	}
+
+	objects, ok := f.buckets[bucket]
+	if !ok {
+		apitest.WriteError(w, http.StatusNotFound, "")
+		return
+	}
+
+	names := []string{}
+	for n := range objects {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	items := []interface{}{}
+	prefixes := []string{}
+	seen := map[string]bool{}
+	for _, n := range names {
+		if !strings.HasPrefix(n, prefix) {
+			continue
+		}
+
+		if delimiter != "" {
+			if i := strings.Index(n[len(prefix):], delimiter); i >= 0 {
+				p := n[:len(prefix)+i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					prefixes = append(prefixes, p)
+				}
+				continue
+			}
+		}
+
+		items = append(items, objectJSON(bucket, n, objects[n]))
+	}
+
+	apitest.WriteJSON(w, map[string]interface{}{
+		"kind":     "storage#objects",
+		"items":    items,
+		"prefixes": prefixes,
+	})
+}
+
+func (f *fakeGCSServer) getObject(w http.ResponseWriter, bucket string, name string, media bool) {
+	if f.fail(w, bucket, name) {
+		return
+	}
+
+	o, ok := f.buckets[bucket][name]
+	if !ok {
+		apitest.WriteError(w, http.StatusNotFound, "")
+		return
+	}
+
+	if media {
+		w.Write(o.data)
+		return
+	}
+	apitest.WriteJSON(w, objectJSON(bucket, name, o))
+}
+
+func (f *fakeGCSServer) deleteObject(w http.ResponseWriter, bucket string, name string) {
+	if f.fail(w, bucket, name) {
+		return
+	}
+
+	if _, ok := f.buckets[bucket][name]; !ok {
+		apitest.WriteError(w, http.StatusNotFound, "")
+		return
+	}
+	delete(f.buckets[bucket], name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upload handles multipart uploads; the client uses them for objects smaller than the writer's chunk size.
+func (f *fakeGCSServer) upload(w http.ResponseWriter, r *http.Request, bucket string) {
+	if r.URL.Query().Get("uploadType") != "multipart" {
+		http.Error(w, "Only multipart uploads are supported by the fake", http.StatusNotImplemented)
+		return
+	}
+
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	parts := [][]byte{}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, err := ioutil.ReadAll(part)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parts = append(parts, b)
+	}
+
+	if len(parts) != 2 {
+		http.Error(w, fmt.Sprintf("Expected 2 parts got %v", len(parts)), http.StatusBadRequest)
+		return
+	}
+
+	metadata := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(parts[0], &metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if f.fail(w, bucket, metadata.Name) {
+		return
+	}
+
+	if _, ok := f.buckets[bucket]; !ok {
+		apitest.WriteError(w, http.StatusNotFound, "")
+		return
+	}
+
+	if v := r.URL.Query().Get("ifGenerationMatch"); v != "" {
+		want, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var actual int64
+		if o, ok := f.buckets[bucket][metadata.Name]; ok {
+			actual = o.generation
+		}
+
+		if actual != want {
+			apitest.WriteError(w, http.StatusPreconditionFailed, "")
+			return
+		}
+	}
+
+	o := f.putObject(bucket, metadata.Name, parts[1])
+	apitest.WriteJSON(w, objectJSON(bucket, metadata.Name, o))
+}
+
+// fail writes the injected failure for the bucket or object if there is one.
+func (f *fakeGCSServer) fail(w http.ResponseWriter, bucket string, name string) bool {
+	for _, k := range []string{bucket, bucket + "/" + name} {
+		if code, ok := f.failures[k]; ok {
+			apitest.WriteError(w, code, "")
+			return true
+		}
+	}
+	return false
+}
+
+func objectJSON(bucket string, name string, o *fakeObject) map[string]interface{} {
+	return map[string]interface{}{
+		"bucket":     bucket,
+		"name":       name,
+		"size":       fmt.Sprintf("%v", len(o.data)),
+		"generation": fmt.Sprintf("%v", o.generation),
+	}
+}
+
+func unescape(s string) string {
+	u, err := url.PathUnescape(s)
+	if err != nil {
+		return s
+	}
+	return u
+}
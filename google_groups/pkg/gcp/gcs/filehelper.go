@@ -1,6 +1,7 @@
 package gcs
 
 import (
+	"github.com/pkg/errors"
 	"io"
 )
 
@@ -11,5 +12,47 @@ import (
 type FileHelper interface {
 	Exists(path string) (bool, error)
 	NewReader(path string) (io.Reader, error)
-	NewWriter(path string) (io.Writer, error)
+	// NewWriter creates a writer that fails if the path already exists; i.e. NewWriterWithOptions with CreateOnly.
+	NewWriter(path string) (io.WriteCloser, error)
+	// NewWriterWithOptions creates a writer for the path. Nothing is written to the path until the writer is
+	// closed and Close returns any error committing the write; e.g. ErrGenerationMismatch.
+	NewWriterWithOptions(path string, opts WriteOptions) (io.WriteCloser, error)
+	// Generation returns the generation of the path; it changes every time the path is written.
+	// It is 0 if the path doesn't exist.
+	Generation(path string) (int64, error)
+	// Delete deletes the path. Deleting a path that doesn't exist isn't an error.
+	Delete(path string) error
+	// List returns the paths of all files or objects that start with prefix.
+	List(prefix string) ([]string, error)
+	// Glob returns the paths matching the pattern. See Match for the syntax.
+	Glob(pattern string) ([]string, error)
+}
+
+// WriteMode controls what happens when the target of a write already exists.
+type WriteMode int
+
+const (
+	// CreateOnly fails the write if the target already exists.
+	CreateOnly WriteMode = iota
+	// Overwrite replaces the target if it exists.
+	Overwrite
+	// IfGenerationMatch only writes the target if its generation is WriteOptions.Generation. A generation of 0
+	// means the target must not exist. Use it to update a file read earlier without clobbering concurrent writes.
+	IfGenerationMatch
+)
+
+// WriteOptions are options for FileHelper.NewWriterWithOptions.
+type WriteOptions struct {
+	Mode WriteMode
+	// Generation is the expected generation of the target if Mode is IfGenerationMatch.
+	Generation int64
+}
+
+// ErrGenerationMismatch is the cause of the error returned when a write is rejected because the target already
+// exists (CreateOnly) or has a different generation (IfGenerationMatch).
+var ErrGenerationMismatch = errors.New("the target already exists or its generation doesn't match")
+
+// IsGenerationMismatch returns true if the write failed because of the write mode's precondition.
+func IsGenerationMismatch(err error) bool {
+	return errors.Cause(err) == ErrGenerationMismatch
 }
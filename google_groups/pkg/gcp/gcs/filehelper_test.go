@@ -0,0 +1,209 @@
+package gcs
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// write writes data to the path with the given options; errors from NewWriterWithOptions and Close are returned.
+func write(h FileHelper, path string, data string, opts WriteOptions) error {
+	w, err := h.NewWriterWithOptions(path, opts)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write([]byte(data)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func read(t *testing.T, h FileHelper, path string) string {
+	r, err := h.NewReader(path)
+	if err != nil {
+		t.Fatalf("NewReader(%v) returned error; %v", path, err)
+	}
+
+	if c, ok := r.(interface{ Close() error }); ok {
+		defer c.Close()
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Error reading %v; %v", path, err)
+	}
+	return string(b)
+}
+
+func generation(t *testing.T, h FileHelper, path string) int64 {
+	g, err := h.Generation(path)
+	if err != nil {
+		t.Fatalf("Generation(%v) returned error; %v", path, err)
+	}
+	return g
+}
+
+// testFileHelperWrites exercises the write modes, Delete and List of a FileHelper. root is the directory or
+// bucket to work in and must be empty.
+func testFileHelperWrites(t *testing.T, h FileHelper, root string) {
+	a := root + "/a.txt"
+
+	if g := generation(t, h, a); g != 0 {
+		t.Errorf("Generation of a missing file is %v; want 0", g)
+	}
+
+	if err := write(h, a, "v1", WriteOptions{Mode: CreateOnly}); err != nil {
+		t.Fatalf("Creating %v returned error; %v", a, err)
+	}
+
+	if err := write(h, a, "v1-again", WriteOptions{Mode: CreateOnly}); !IsGenerationMismatch(err) {
+		t.Errorf("Creating %v when it exists returned %v; want a generation mismatch", a, err)
+	}
+
+	g1 := generation(t, h, a)
+
+	if err := write(h, a, "v2", WriteOptions{Mode: Overwrite}); err != nil {
+		t.Fatalf("Overwriting %v returned error; %v", a, err)
+	}
+
+	g2 := generation(t, h, a)
+	if g2 == g1 {
+		t.Errorf("Overwriting %v didn't change the generation %v", a, g1)
+	}
+
+	// g1 is stale so the write should be rejected.
+	if err := write(h, a, "v3-stale", WriteOptions{Mode: IfGenerationMatch, Generation: g1}); !IsGenerationMismatch(err) {
+		t.Errorf("Writing %v with a stale generation returned %v; want a generation mismatch", a, err)
+	}
+
+	if err := write(h, a, "v3", WriteOptions{Mode: IfGenerationMatch, Generation: g2}); err != nil {
+		t.Errorf("Writing %v with the current generation returned error; %v", a, err)
+	}
+
+	if actual := read(t, h, a); actual != "v3" {
+		t.Errorf("%v contains %q; want %q", a, actual, "v3")
+	}
+
+	b := root + "/sub/b.txt"
+	if err := write(h, b, "b", WriteOptions{Mode: IfGenerationMatch}); err != nil {
+		t.Errorf("Writing %v with generation 0 returned error; %v", b, err)
+	}
+
+	if err := write(h, b, "b-again", WriteOptions{Mode: IfGenerationMatch}); !IsGenerationMismatch(err) {
+		t.Errorf("Writing %v with generation 0 when it exists returned %v; want a generation mismatch", b, err)
+	}
+
+	for prefix, expected := range map[string][]string{
+		root + "/":    {a, b},
+		root + "/su":  {b},
+		root + "/sub": {b},
+		root + "/x":   {},
+	} {
+		actual, err := h.List(prefix)
+		if err != nil {
+			t.Errorf("List(%v) returned error; %v", prefix, err)
+			continue
+		}
+
+		if d := cmp.Diff(expected, actual); d != "" {
+			t.Errorf("List(%v) mismatch (-want +got):\n%s", prefix, d)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		// Deleting a missing file isn't an error.
+		if err := h.Delete(a); err != nil {
+			t.Errorf("Delete(%v) returned error; %v", a, err)
+		}
+	}
+
+	if exists, err := h.Exists(a); err != nil || exists {
+		t.Errorf("Exists(%v) after Delete = %v, %v; want false, nil", a, exists, err)
+	}
+}
+
+func TestLocalFileHelperWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testLocalWrites")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("Error creating directory; %v", err)
+	}
+
+	testFileHelperWrites(t, &LocalFileHelper{}, dir)
+
+	// The temporary files should have been cleaned up.
+	matches, err := filepath.Glob(filepath.Join(dir, "sub", ".*"))
+	if err != nil {
+		t.Fatalf("Glob returned error; %v", err)
+	}
+
+	if len(matches) != 0 {
+		t.Errorf("Temporary files weren't removed; %v", matches)
+	}
+}
+
+func TestLocalFileHelperFailedWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testLocalFailedWrite")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := &LocalFileHelper{}
+	target := filepath.Join(dir, "a.txt")
+
+	if err := write(h, target, "original", WriteOptions{Mode: CreateOnly}); err != nil {
+		t.Fatalf("Error writing %v; %v", target, err)
+	}
+
+	w, err := h.NewWriterWithOptions(target, WriteOptions{Mode: Overwrite})
+	if err != nil {
+		t.Fatalf("NewWriterWithOptions returned error; %v", err)
+	}
+
+	if _, err := w.Write([]byte("partial")); err != nil {
+		t.Fatalf("Write returned error; %v", err)
+	}
+
+	// Closing the temporary file makes the next write fail.
+	w.(*atomicWriter).f.Close()
+
+	if _, err := w.Write([]byte("rest")); err == nil {
+		t.Fatalf("Write to a closed file should fail")
+	}
+
+	if err := w.Close(); err == nil {
+		t.Errorf("Close after a failed write should return an error")
+	}
+
+	if actual := read(t, h, target); actual != "original" {
+		t.Errorf("Got %q; want the original file to be kept", actual)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, ".*"))
+	if err != nil {
+		t.Fatalf("Glob returned error; %v", err)
+	}
+
+	if len(matches) != 0 {
+		t.Errorf("Temporary files weren't removed; %v", matches)
+	}
+}
+
+func TestGcsHelperWrites(t *testing.T) {
+	f, client := newFakeGCSServer(t)
+	defer f.server.Close()
+
+	f.addObject("mybucket", "", "")
+
+	testFileHelperWrites(t, &GcsHelper{Ctx: context.Background(), Client: client}, "gs://mybucket")
+}
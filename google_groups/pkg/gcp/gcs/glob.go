@@ -0,0 +1,83 @@
+package gcs
+
+import (
+	"path"
+	"strings"
+)
+
+// globStar is the path element that matches zero or more path elements.
+const globStar = "**"
+
+// Match reports whether name matches the slash separated glob pattern.
+//
+// Each path element of the pattern is matched with path.Match, so * and ? don't match "/".
+// The element ** matches zero or more path elements; e.g. groups/**/*.yaml matches groups/a.yaml and groups/a/b.yaml.
+func Match(pattern string, name string) (bool, error) {
+	return matchElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElements(pattern []string, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == globStar {
+			// Collapse consecutive stars; they match the same thing as a single one.
+			for len(pattern) > 1 && pattern[1] == globStar {
+				pattern = pattern[1:]
+			}
+
+			// Try consuming zero or more elements of the name.
+			for i := 0; i <= len(name); i++ {
+				isMatch, err := matchElements(pattern[1:], name[i:])
+				if err != nil || isMatch {
+					return isMatch, err
+				}
+			}
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			return false, nil
+		}
+
+		isMatch, err := path.Match(pattern[0], name[0])
+		if err != nil || !isMatch {
+			return false, err
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// validatePattern returns path.ErrBadPattern if any path element of the pattern is malformed.
+func validatePattern(pattern string) error {
+	for _, e := range strings.Split(pattern, "/") {
+		if _, err := path.Match(e, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globPrefix splits a glob pattern into the leading path elements that don't contain any wildcards and the rest.
+// The prefix is returned with a trailing "/" if it isn't empty; e.g. groups/**/*.yaml returns "groups/" and "**/*.yaml".
+func globPrefix(pattern string) (string, string) {
+	elements := strings.Split(pattern, "/")
+
+	i := 0
+	for ; i < len(elements)-1; i++ {
+		if hasMeta(elements[i]) {
+			break
+		}
+	}
+
+	if i == 0 {
+		return "", pattern
+	}
+	return strings.Join(elements[:i], "/") + "/", strings.Join(elements[i:], "/")
+}
+
+// hasMeta reports whether the path element contains any of the characters path.Match treats specially.
+func hasMeta(element string) bool {
+	return strings.ContainsAny(element, `*?[\`)
+}
@@ -0,0 +1,141 @@
+package gcs
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	type testCase struct {
+		pattern  string
+		name     string
+		expected bool
+	}
+
+	cases := []testCase{
+		{pattern: "groups/*.yaml", name: "groups/ci-team.yaml", expected: true},
+		// . isn't a wildcard.
+		{pattern: "groups/*.yaml", name: "groups/ci-teamxyaml", expected: false},
+		// * doesn't match /.
+		{pattern: "groups/*.yaml", name: "groups/a/ci-team.yaml", expected: false},
+		{pattern: "groups/**/*.yaml", name: "groups/ci-team.yaml", expected: true},
+		{pattern: "groups/**/*.yaml", name: "groups/a/b/ci-team.yaml", expected: true},
+		{pattern: "groups/**/*.yaml", name: "other/ci-team.yaml", expected: false},
+		{pattern: "**", name: "a/b/c", expected: true},
+		{pattern: "groups/**", name: "groups", expected: true},
+		{pattern: "**/**/c", name: "a/b/c", expected: true},
+		{pattern: "a/?/c", name: "a/b/c", expected: true},
+		{pattern: "a/[a-c]/c", name: "a/d/c", expected: false},
+		{pattern: "a/b", name: "a/b/c", expected: false},
+	}
+
+	for _, c := range cases {
+		actual, err := Match(c.pattern, c.name)
+		if err != nil {
+			t.Errorf("Match(%v, %v) returned error; %v", c.pattern, c.name, err)
+			continue
+		}
+
+		if actual != c.expected {
+			t.Errorf("Match(%v, %v) = %v; want %v", c.pattern, c.name, actual, c.expected)
+		}
+	}
+
+	if _, err := Match("a/[b", "a/b"); err == nil {
+		t.Errorf("Match with a malformed pattern should return an error")
+	}
+}
+
+func TestGlobPrefix(t *testing.T) {
+	type testCase struct {
+		pattern      string
+		expectedDir  string
+		expectedRest string
+	}
+
+	cases := []testCase{
+		{pattern: "groups/**/*.yaml", expectedDir: "groups/", expectedRest: "**/*.yaml"},
+		{pattern: "groups/a/*.yaml", expectedDir: "groups/a/", expectedRest: "*.yaml"},
+		{pattern: "groups/a/file.yaml", expectedDir: "groups/a/", expectedRest: "file.yaml"},
+		{pattern: "*/file.yaml", expectedDir: "", expectedRest: "*/file.yaml"},
+		{pattern: "file.yaml", expectedDir: "", expectedRest: "file.yaml"},
+	}
+
+	for _, c := range cases {
+		dir, rest := globPrefix(c.pattern)
+		if dir != c.expectedDir || rest != c.expectedRest {
+			t.Errorf("globPrefix(%v) = %v, %v; want %v, %v", c.pattern, dir, rest, c.expectedDir, c.expectedRest)
+		}
+	}
+}
+
+func TestLocalFileHelperGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testLocalGlob")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range []string{"a.yaml", "b.txt", "sub/c.yaml", "sub/deeper/d.yaml"} {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Error creating directory; %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatalf("Error writing %v; %v", p, err)
+		}
+	}
+
+	type testCase struct {
+		pattern  string
+		expected []string
+	}
+
+	cases := []testCase{
+		{
+			pattern:  "*.yaml",
+			expected: []string{"a.yaml"},
+		},
+		{
+			pattern:  "**/*.yaml",
+			expected: []string{"a.yaml", "sub/c.yaml", "sub/deeper/d.yaml"},
+		},
+		{
+			pattern:  "sub/**/*.yaml",
+			expected: []string{"sub/c.yaml", "sub/deeper/d.yaml"},
+		},
+		{
+			pattern:  "missing/**/*.yaml",
+			expected: []string{},
+		},
+	}
+
+	h := &LocalFileHelper{}
+	for _, c := range cases {
+		actual, err := h.Glob(filepath.Join(dir, filepath.FromSlash(c.pattern)))
+		if err != nil {
+			t.Errorf("Glob(%v) returned error; %v", c.pattern, err)
+			continue
+		}
+
+		rel := []string{}
+		for _, a := range actual {
+			r, err := filepath.Rel(dir, a)
+			if err != nil {
+				t.Fatalf("Error computing relative path; %v", err)
+			}
+			rel = append(rel, filepath.ToSlash(r))
+		}
+
+		if d := cmp.Diff(c.expected, rel); d != "" {
+			t.Errorf("Glob(%v) mismatch (-want +got):\n%s", c.pattern, d)
+		}
+	}
+
+	if _, err := h.Glob(filepath.Join(dir, "**", "[a")); err == nil {
+		t.Errorf("Glob with a malformed pattern should return an error")
+	}
+}
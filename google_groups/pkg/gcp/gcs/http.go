@@ -0,0 +1,150 @@
+package gcs
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultHTTPTimeout}
+
+// DefaultHTTPTimeout bounds requests made by a HTTPFileHelper without a Client so an unresponsive server
+// can't block startup.
+const DefaultHTTPTimeout = 30 * time.Second
+
+// ErrReadOnly is the cause of the error returned by FileHelpers that don't support an operation because they
+// are read only.
+var ErrReadOnly = errors.New("the file helper is read only")
+
+// HTTPFileHelper is a read only FileHelper for https:// URLs; e.g. to fetch the OAuth client file from an
+// artifact server. Only https is registered by default; register http explicitly, e.g. in tests, to use it for
+// http:// URLs.
+//
+// Responses are cached by URL and revalidated with their ETag, so a file that hasn't changed isn't downloaded again.
+type HTTPFileHelper struct {
+	// Client is used to make requests. Defaults to a client with DefaultHTTPTimeout.
+	Client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*httpCacheEntry
+}
+
+type httpCacheEntry struct {
+	etag string
+	data []byte
+}
+
+// NewHTTPFileHelper creates a HTTPFileHelper with an empty cache.
+func NewHTTPFileHelper(client *http.Client) *HTTPFileHelper {
+	return &HTTPFileHelper{
+		Client: client,
+		cache:  map[string]*httpCacheEntry{},
+	}
+}
+
+func (h *HTTPFileHelper) client() *http.Client {
+	if h.Client == nil {
+		return defaultHTTPClient
+	}
+	return h.Client
+}
+
+// Exists checks whether the URL exists with a HEAD request. Any status other than 200 or 404 is an error.
+func (h *HTTPFileHelper) Exists(uri string) (bool, error) {
+	resp, err := h.client().Head(uri)
+	if err != nil {
+		return false, errors.WithStack(errors.Wrapf(err, "Could not check whether %v exists", uri))
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.WithStack(errors.Errorf("Could not check whether %v exists; status %v", uri, resp.Status))
+	}
+}
+
+// NewReader fetches the URL. If the server reports the cached copy is still current the cached copy is returned.
+func (h *HTTPFileHelper) NewReader(uri string) (io.Reader, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, errors.WithStack(errors.Wrapf(err, "Clould not read: %v", uri))
+	}
+
+	h.mu.Lock()
+	cached, ok := h.cache[uri]
+	h.mu.Unlock()
+
+	if ok {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return nil, errors.WithStack(errors.Wrapf(err, "Clould not read: %v", uri))
+	}
+	defer resp.Body.Close()
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		return bytes.NewReader(cached.data), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.WithStack(errors.Errorf("Clould not read: %v; status %v", uri, resp.Status))
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.WithStack(errors.Wrapf(err, "Clould not read: %v", uri))
+	}
+
+	h.mu.Lock()
+	if h.cache == nil {
+		h.cache = map[string]*httpCacheEntry{}
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		h.cache[uri] = &httpCacheEntry{etag: etag, data: data}
+	} else {
+		delete(h.cache, uri)
+	}
+	h.mu.Unlock()
+
+	return bytes.NewReader(data), nil
+}
+
+// NewWriter isn't supported.
+func (h *HTTPFileHelper) NewWriter(uri string) (io.WriteCloser, error) {
+	return nil, errors.WithStack(errors.Wrapf(ErrReadOnly, "Can't write %v", uri))
+}
+
+// NewWriterWithOptions isn't supported.
+func (h *HTTPFileHelper) NewWriterWithOptions(uri string, opts WriteOptions) (io.WriteCloser, error) {
+	return h.NewWriter(uri)
+}
+
+// Generation isn't supported.
+func (h *HTTPFileHelper) Generation(uri string) (int64, error) {
+	return 0, errors.WithStack(errors.Wrapf(ErrReadOnly, "Can't get the generation of %v", uri))
+}
+
+// Delete isn't supported.
+func (h *HTTPFileHelper) Delete(uri string) error {
+	return errors.WithStack(errors.Wrapf(ErrReadOnly, "Can't delete %v", uri))
+}
+
+// List isn't supported; HTTP has no way to list files.
+func (h *HTTPFileHelper) List(prefix string) ([]string, error) {
+	return nil, errors.WithStack(errors.Errorf("Can't list %v; listing isn't supported over HTTP", prefix))
+}
+
+// Glob isn't supported; HTTP has no way to list files.
+func (h *HTTPFileHelper) Glob(pattern string) ([]string, error) {
+	return nil, errors.WithStack(errors.Errorf("Can't match %v; globs aren't supported over HTTP", pattern))
+}
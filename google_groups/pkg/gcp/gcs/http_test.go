@@ -0,0 +1,78 @@
+package gcs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPFileHelper(t *testing.T) {
+	contents := "v1"
+	etag := `"1"`
+	downloads := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/client_secret.json" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			downloads++
+		}
+		w.Write([]byte(contents))
+	}))
+	defer server.Close()
+
+	h := NewHTTPFileHelper(server.Client())
+	uri := server.URL + "/client_secret.json"
+
+	if exists, err := h.Exists(uri); err != nil || !exists {
+		t.Errorf("Exists(%v) = %v, %v; want true, nil", uri, exists, err)
+	}
+
+	if exists, err := h.Exists(server.URL + "/missing.json"); err != nil || exists {
+		t.Errorf("Exists(missing) = %v, %v; want false, nil", exists, err)
+	}
+
+	type step struct {
+		contents  string
+		etag      string
+		downloads int
+	}
+
+	steps := []step{
+		{contents: "v1", etag: `"1"`, downloads: 1},
+		// The cached copy is still current so it shouldn't be downloaded again.
+		{contents: "v1", etag: `"1"`, downloads: 1},
+		{contents: "v2", etag: `"2"`, downloads: 2},
+	}
+
+	for i, s := range steps {
+		contents = s.contents
+		etag = s.etag
+
+		actual := read(t, h, uri)
+		if actual != s.contents {
+			t.Errorf("Step %v: got %q; want %q", i, actual, s.contents)
+		}
+
+		if downloads != s.downloads {
+			t.Errorf("Step %v: file was downloaded %v times; want %v", i, downloads, s.downloads)
+		}
+	}
+
+	if _, err := h.NewReader(server.URL + "/missing.json"); err == nil {
+		t.Errorf("Reading a missing URL should return an error")
+	}
+
+	if _, err := h.NewWriter(uri); err == nil {
+		t.Errorf("NewWriter should return an error")
+	}
+}
@@ -3,7 +3,12 @@ package gcs
 import (
 	"github.com/pkg/errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 type LocalFileHelper struct {}
@@ -19,30 +24,254 @@ func (h *LocalFileHelper) NewReader(uri string) (io.Reader, error) {
 	return reader, nil
 }
 
-// NewWriter creates a new Writer for the local file.
+// NewWriter creates a new Writer for the local file. It fails if the file already exists.
+func (h *LocalFileHelper) NewWriter(uri string) (io.WriteCloser, error) {
+	return h.NewWriterWithOptions(uri, WriteOptions{Mode: CreateOnly})
+}
+
+// NewWriterWithOptions creates a new Writer for the local file.
+//
+// The data is written to a temporary file in the same directory which is moved into place on Close, so readers
+// never see a partially written file. CreateOnly is atomic, but the generation check of IfGenerationMatch isn't
+// atomic with the rename. The generation of a file is its modification time in nanoseconds; writes through the
+// helper always advance it.
 //
 // TODO(jlewi): Can we add options to control filemode?
-func (h *LocalFileHelper) NewWriter(uri string) (io.Writer, error) {
-	_, err :=  os.Stat(uri)
+func (h *LocalFileHelper) NewWriterWithOptions(uri string, opts WriteOptions) (io.WriteCloser, error) {
+	switch opts.Mode {
+	case CreateOnly:
+		_, err :=  os.Stat(uri)
 
-	if err == nil || !os.IsNotExist(err) {
-		return nil, errors.WithStack(errors.Errorf("Can't write %v; It already exists", uri ))
+		if err == nil {
+			return nil, errors.WithStack(errors.Wrapf(ErrGenerationMismatch, "Can't write %v; It already exists", uri ))
+		}
+
+		if !os.IsNotExist(err) {
+			return nil, errors.WithStack(errors.Wrapf(err, "Could not stat %v", uri))
+		}
+	case Overwrite, IfGenerationMatch:
+	default:
+		return nil, errors.WithStack(errors.Errorf("Can't write %v; unknown write mode %v", uri, opts.Mode))
 	}
 
-	writer, err := os.Create(uri)
+	f, err := ioutil.TempFile(filepath.Dir(uri), "."+filepath.Base(uri)+".tmp")
 
 	if err != nil {
 		return nil, errors.WithStack(errors.Wrapf(err, "Clould not write: %v", uri))
 	}
 
-	return writer, nil
+	return &atomicWriter{f: f, uri: uri, opts: opts, h: h}, nil
+}
+
+// atomicWriter writes to a temporary file and moves it to uri when it is closed. If a write fails the file is
+// discarded on Close so a partial file never replaces uri.
+type atomicWriter struct {
+	f    *os.File
+	uri  string
+	opts WriteOptions
+	h    *LocalFileHelper
+	// err is the first write error.
+	err error
+}
+
+func (w *atomicWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.f.Write(p)
+	if err != nil {
+		w.err = errors.WithStack(errors.Wrapf(err, "Error writing %v", w.uri))
+		return n, w.err
+	}
+	return n, nil
+}
+
+func (w *atomicWriter) Close() error {
+	tmp := w.f.Name()
+	// The temporary file is gone after a successful commit.
+	defer os.Remove(tmp)
+
+	closeErr := w.f.Close()
+
+	if w.err != nil {
+		return errors.Wrapf(w.err, "Not writing %v because a write failed", w.uri)
+	}
+
+	if closeErr != nil {
+		return errors.WithStack(errors.Wrapf(closeErr, "Error writing %v", w.uri))
+	}
+
+	// TempFile creates files that are only readable by the owner.
+	if err := os.Chmod(tmp, 0644); err != nil {
+		return errors.WithStack(errors.Wrapf(err, "Error writing %v", w.uri))
+	}
+
+	// The generation is the modification time, so make sure it changes even if the clock hasn't advanced since
+	// the target was last written.
+	if prev, err := os.Stat(w.uri); err == nil {
+		info, err := os.Stat(tmp)
+		if err != nil {
+			return errors.WithStack(errors.Wrapf(err, "Error writing %v", w.uri))
+		}
+
+		if !info.ModTime().After(prev.ModTime()) {
+			t := prev.ModTime().Add(time.Nanosecond)
+			if err := os.Chtimes(tmp, t, t); err != nil {
+				return errors.WithStack(errors.Wrapf(err, "Error writing %v", w.uri))
+			}
+		}
+	}
+
+	mustNotExist := w.opts.Mode == CreateOnly
+
+	if w.opts.Mode == IfGenerationMatch {
+		if w.opts.Generation == 0 {
+			mustNotExist = true
+		} else {
+			gen, err := w.h.Generation(w.uri)
+			if err != nil {
+				return err
+			}
+
+			if gen != w.opts.Generation {
+				return errors.WithStack(errors.Wrapf(ErrGenerationMismatch, "Can't write %v; its generation is %v not %v", w.uri, gen, w.opts.Generation))
+			}
+		}
+	}
+
+	if mustNotExist {
+		// Link fails if the target exists so unlike checking for the file and renaming there is no race.
+		if err := os.Link(tmp, w.uri); err != nil {
+			if os.IsExist(err) {
+				return errors.WithStack(errors.Wrapf(ErrGenerationMismatch, "Can't write %v; It already exists", w.uri))
+			}
+			return errors.WithStack(errors.Wrapf(err, "Error writing %v", w.uri))
+		}
+		return nil
+	}
+
+	if err := os.Rename(tmp, w.uri); err != nil {
+		return errors.WithStack(errors.Wrapf(err, "Error writing %v", w.uri))
+	}
+	return nil
+}
+
+// Generation returns the modification time of the file in nanoseconds or 0 if it doesn't exist.
+func (h *LocalFileHelper) Generation(uri string) (int64, error) {
+	info, err := os.Stat(uri)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.WithStack(errors.Wrapf(err, "Could not stat %v", uri))
+	}
+	return info.ModTime().UnixNano(), nil
+}
+
+// Delete deletes the file. Deleting a file that doesn't exist isn't an error.
+func (h *LocalFileHelper) Delete(uri string) error {
+	if err := os.Remove(uri); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(errors.Wrapf(err, "Could not delete %v", uri))
+	}
+	return nil
+}
+
+// List returns the paths of all files, in any subdirectory, that start with prefix. If prefix ends in a
+// separator it lists the files in that directory.
+func (h *LocalFileHelper) List(prefix string) ([]string, error) {
+	// Walk returns cleaned paths so compare them with the cleaned prefix.
+	sep := string(filepath.Separator)
+	isDir := strings.HasSuffix(prefix, sep)
+	prefix = filepath.Clean(prefix)
+
+	root := filepath.Dir(prefix)
+	if isDir {
+		root = prefix
+		if !strings.HasSuffix(prefix, sep) {
+			prefix = prefix + sep
+		}
+	}
+
+	paths := []string{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return nil
+			}
+			return err
+		}
+
+		// A directory that doesn't start with prefix can still contain files that do; e.g. prefix "a/b" and "a/bc/d".
+		if info.IsDir() || !strings.HasPrefix(p, prefix) {
+			return nil
+		}
+
+		paths = append(paths, p)
+		return nil
+	})
+
+	if err != nil {
+		return nil, errors.WithStack(errors.Wrapf(err, "Error listing %v", prefix))
+	}
+	return paths, nil
 }
 
 // Exists checks whether the file exists.
 func (h *LocalFileHelper) Exists(uri string) (bool, error) {
 	_, err := os.Stat(uri)
+	if err == nil {
+		return true, nil
+	}
 	if os.IsNotExist(err) {
 		return false, nil
 	}
-	return true, nil
-}
\ No newline at end of file
+	return false, errors.WithStack(errors.Wrapf(err, "Could not stat %v", uri))
+}
+
+// Glob returns the files matching the pattern. The pattern supports ** in addition to the syntax of filepath.Glob;
+// see Match. Like filepath.Glob, I/O errors such as unreadable directories are ignored.
+func (h *LocalFileHelper) Glob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, globStar) {
+		return filepath.Glob(pattern)
+	}
+
+	// Validate the pattern so a bad pattern is reported even if there are no files to match it against.
+	if err := validatePattern(filepath.ToSlash(pattern)); err != nil {
+		return nil, errors.WithStack(errors.Wrapf(err, "Invalid pattern %v", pattern))
+	}
+
+	prefix, rest := globPrefix(filepath.ToSlash(pattern))
+
+	root := "."
+	if prefix != "" {
+		root = filepath.FromSlash(path.Clean(prefix))
+	}
+
+	matches := []string{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		isMatch, err := Match(rest, filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+
+		if isMatch {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, errors.WithStack(errors.Wrapf(err, "Error matching %v", pattern))
+	}
+	return matches, nil
+}
@@ -0,0 +1,158 @@
+package gcs
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryFileHelper is a FileHelper that keeps files in memory. It is intended for tests.
+//
+// Paths are arbitrary strings; e.g. mem://specs/groups.yaml. Glob and List treat "/" as the separator.
+type MemoryFileHelper struct {
+	mu    sync.Mutex
+	files map[string]*memoryFile
+	// generation is the last generation assigned to a file.
+	generation int64
+}
+
+type memoryFile struct {
+	data       []byte
+	generation int64
+}
+
+// NewMemoryFileHelper creates an empty MemoryFileHelper.
+func NewMemoryFileHelper() *MemoryFileHelper {
+	return &MemoryFileHelper{
+		files: map[string]*memoryFile{},
+	}
+}
+
+// Exists checks whether the file exists.
+func (h *MemoryFileHelper) Exists(path string) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.files[path]
+	return ok, nil
+}
+
+// NewReader returns a reader for a snapshot of the file's contents.
+func (h *MemoryFileHelper) NewReader(path string) (io.Reader, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[path]
+	if !ok {
+		return nil, errors.WithStack(errors.Wrapf(os.ErrNotExist, "Clould not read: %v", path))
+	}
+	return bytes.NewReader(f.data), nil
+}
+
+// NewWriter creates a new Writer for the file. It fails if the file already exists.
+func (h *MemoryFileHelper) NewWriter(path string) (io.WriteCloser, error) {
+	return h.NewWriterWithOptions(path, WriteOptions{Mode: CreateOnly})
+}
+
+// NewWriterWithOptions creates a new Writer for the file. The contents are stored when the writer is closed and
+// the write mode is checked atomically at that point.
+func (h *MemoryFileHelper) NewWriterWithOptions(path string, opts WriteOptions) (io.WriteCloser, error) {
+	switch opts.Mode {
+	case CreateOnly:
+		if exists, _ := h.Exists(path); exists {
+			return nil, errors.WithStack(errors.Wrapf(ErrGenerationMismatch, "Can't write %v; It already exists", path))
+		}
+	case Overwrite, IfGenerationMatch:
+	default:
+		return nil, errors.WithStack(errors.Errorf("Can't write %v; unknown write mode %v", path, opts.Mode))
+	}
+	return &memoryWriter{h: h, path: path, opts: opts}, nil
+}
+
+type memoryWriter struct {
+	bytes.Buffer
+	h    *MemoryFileHelper
+	path string
+	opts WriteOptions
+}
+
+func (w *memoryWriter) Close() error {
+	h := w.h
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var current int64
+	if f, ok := h.files[w.path]; ok {
+		current = f.generation
+	}
+
+	switch {
+	case w.opts.Mode == CreateOnly && current != 0:
+		return errors.WithStack(errors.Wrapf(ErrGenerationMismatch, "Can't write %v; It already exists", w.path))
+	case w.opts.Mode == IfGenerationMatch && current != w.opts.Generation:
+		return errors.WithStack(errors.Wrapf(ErrGenerationMismatch, "Can't write %v; its generation is %v not %v", w.path, current, w.opts.Generation))
+	}
+
+	h.generation++
+	h.files[w.path] = &memoryFile{
+		data:       append([]byte{}, w.Bytes()...),
+		generation: h.generation,
+	}
+	return nil
+}
+
+// Generation returns the generation of the file or 0 if it doesn't exist.
+func (h *MemoryFileHelper) Generation(path string) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if f, ok := h.files[path]; ok {
+		return f.generation, nil
+	}
+	return 0, nil
+}
+
+// Delete deletes the file. Deleting a file that doesn't exist isn't an error.
+func (h *MemoryFileHelper) Delete(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.files, path)
+	return nil
+}
+
+// List returns the paths of all files that start with prefix in sorted order.
+func (h *MemoryFileHelper) List(prefix string) ([]string, error) {
+	return h.filter(func(p string) (bool, error) {
+		return strings.HasPrefix(p, prefix), nil
+	})
+}
+
+// Glob returns the paths matching the pattern in sorted order. See Match for the syntax.
+func (h *MemoryFileHelper) Glob(pattern string) ([]string, error) {
+	if err := validatePattern(pattern); err != nil {
+		return nil, errors.WithStack(errors.Wrapf(err, "Invalid pattern %v", pattern))
+	}
+
+	return h.filter(func(p string) (bool, error) {
+		return Match(pattern, p)
+	})
+}
+
+func (h *MemoryFileHelper) filter(include func(string) (bool, error)) ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	paths := []string{}
+	for p := range h.files {
+		ok, err := include(p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
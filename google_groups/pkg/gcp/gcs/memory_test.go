@@ -0,0 +1,28 @@
+package gcs
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+func TestMemoryFileHelperWrites(t *testing.T) {
+	testFileHelperWrites(t, NewMemoryFileHelper(), "mem://bucket")
+}
+
+func TestMemoryFileHelperGlob(t *testing.T) {
+	h := NewMemoryFileHelper()
+	for _, p := range []string{"mem://specs/a.yaml", "mem://specs/b.txt", "mem://specs/sub/c.yaml"} {
+		if err := write(h, p, p, WriteOptions{Mode: CreateOnly}); err != nil {
+			t.Fatalf("Error writing %v; %v", p, err)
+		}
+	}
+
+	actual, err := h.Glob("mem://specs/**/*.yaml")
+	if err != nil {
+		t.Fatalf("Glob returned error; %v", err)
+	}
+
+	if d := cmp.Diff([]string{"mem://specs/a.yaml", "mem://specs/sub/c.yaml"}, actual); d != "" {
+		t.Errorf("Glob mismatch (-want +got):\n%s", d)
+	}
+}
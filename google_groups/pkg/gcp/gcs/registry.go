@@ -0,0 +1,78 @@
+package gcs
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"github.com/pkg/errors"
+	"regexp"
+	"sync"
+)
+
+// FileHelperFactory creates the FileHelper for the URIs of a scheme.
+type FileHelperFactory func(ctx context.Context) (FileHelper, error)
+
+var (
+	schemeRe = regexp.MustCompile("^([a-zA-Z][a-zA-Z0-9+.-]*)://")
+
+	registryMu sync.Mutex
+	registry   = map[string]FileHelperFactory{}
+)
+
+// RegisterScheme registers the factory used by NewFileHelper for URIs of the form {scheme}://...
+// Registering a scheme again replaces the factory; e.g. tests can register a MemoryFileHelper.
+//
+// Paths without a scheme are local files.
+func RegisterScheme(scheme string, factory FileHelperFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[scheme] = factory
+}
+
+// NewFileHelper returns the FileHelper for the uri based on its scheme. gs:// and https:// are registered by
+// default; paths without a scheme use the LocalFileHelper.
+func NewFileHelper(ctx context.Context, uri string) (FileHelper, error) {
+	scheme := Scheme(uri)
+	if scheme == "" {
+		return &LocalFileHelper{}, nil
+	}
+
+	registryMu.Lock()
+	factory, ok := registry[scheme]
+	registryMu.Unlock()
+
+	if !ok {
+		return nil, errors.WithStack(errors.Errorf("Can't handle %v; no FileHelper is registered for scheme %v", uri, scheme))
+	}
+	return factory(ctx)
+}
+
+// Scheme returns the scheme of the uri or the empty string if it is a local path.
+func Scheme(uri string) string {
+	m := schemeRe.FindStringSubmatch(uri)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// defaultHTTPFileHelper is shared by all calls so the ETag cache lasts across them.
+var defaultHTTPFileHelper = NewHTTPFileHelper(defaultHTTPClient)
+
+func init() {
+	RegisterScheme("gs", func(ctx context.Context) (FileHelper, error) {
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, errors.WithStack(errors.Wrapf(err, "Error creating GCS client"))
+		}
+
+		return &GcsHelper{
+			Ctx:    ctx,
+			Client: client,
+		}, nil
+	})
+
+	// Plain http isn't registered; the files fetched this way are credentials.
+	RegisterScheme("https", func(ctx context.Context) (FileHelper, error) {
+		return defaultHTTPFileHelper, nil
+	})
+}
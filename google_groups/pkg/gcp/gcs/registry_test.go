@@ -0,0 +1,65 @@
+package gcs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScheme(t *testing.T) {
+	cases := map[string]string{
+		"gs://bucket/file.json":        "gs",
+		"https://example.com/a.json":   "https",
+		"/tmp/client_secret.json":      "",
+		"client_secret.json":           "",
+		"./dir/with://in/the/path.txt": "",
+	}
+
+	for uri, expected := range cases {
+		if actual := Scheme(uri); actual != expected {
+			t.Errorf("Scheme(%v) = %v; want %v", uri, actual, expected)
+		}
+	}
+}
+
+func TestNewFileHelper(t *testing.T) {
+	mem := NewMemoryFileHelper()
+	RegisterScheme("mem", func(ctx context.Context) (FileHelper, error) {
+		return mem, nil
+	})
+
+	type testCase struct {
+		uri      string
+		expected FileHelper
+	}
+
+	cases := []testCase{
+		{uri: "/tmp/client_secret.json", expected: &LocalFileHelper{}},
+		{uri: "https://example.com/client_secret.json", expected: defaultHTTPFileHelper},
+		{uri: "mem://client_secret.json", expected: mem},
+	}
+
+	for _, c := range cases {
+		actual, err := NewFileHelper(context.Background(), c.uri)
+		if err != nil {
+			t.Errorf("NewFileHelper(%v) returned error; %v", c.uri, err)
+			continue
+		}
+
+		if _, isLocal := c.expected.(*LocalFileHelper); isLocal {
+			if _, ok := actual.(*LocalFileHelper); !ok {
+				t.Errorf("NewFileHelper(%v) = %T; want a LocalFileHelper", c.uri, actual)
+			}
+			continue
+		}
+
+		if actual != c.expected {
+			t.Errorf("NewFileHelper(%v) = %T; want %T", c.uri, actual, c.expected)
+		}
+	}
+
+	for _, uri := range []string{"ftp://example.com/file", "http://example.com/client_secret.json"} {
+		if _, err := NewFileHelper(context.Background(), uri); err == nil {
+			t.Errorf("NewFileHelper(%v) with an unregistered scheme should return an error", uri)
+		}
+	}
+}
@@ -4,14 +4,14 @@ import (
 	"cloud.google.com/go/storage"
 	"context"
 	"fmt"
-	"github.com/kubeflow/internal-acls/google_groups/pkg/util"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"io"
-	"math/rand"
-	"path"
+	"net/http"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -75,8 +75,16 @@ func (h *GcsHelper) NewReader(uri string) (io.Reader, error) {
 
 // NewWriter creates a new Writer for GCS path or local file.
 //
-// TODO(jlewi): Can we add options to control filemode?
-func (h *GcsHelper) NewWriter( uri string) (io.Writer, error) {
+// It returns an error if the bucket doesn't exist or the object already exists.
+func (h *GcsHelper) NewWriter( uri string) (io.WriteCloser, error) {
+	return h.NewWriterWithOptions(uri, WriteOptions{Mode: CreateOnly})
+}
+
+// NewWriterWithOptions creates a new Writer for the GCS path.
+//
+// The write modes are implemented with GCS preconditions so they hold even if there are concurrent writers.
+// The object's generation is the GCS object generation.
+func (h *GcsHelper) NewWriterWithOptions(uri string, opts WriteOptions) (io.WriteCloser, error) {
 	p, err := Parse(uri)
 	if  err != nil {
 		return nil, err
@@ -85,87 +93,139 @@ func (h *GcsHelper) NewWriter( uri string) (io.Writer, error) {
 
 	_, err = b.Attrs(h.Ctx)
 	if err != nil {
-		return nil, errors.WithStack(errors.Wrapf(err, "Can't access bucket %v; It may not exist", p.Bucket ))
+		if err == storage.ErrBucketNotExist {
+			return nil, errors.WithStack(errors.Errorf("Can't write %v; bucket %v doesn't exist", uri, p.Bucket))
+		}
+		return nil, errors.WithStack(errors.Wrapf(err, "Can't access bucket %v", p.Bucket))
 	}
 
 	o := b.Object(p.Path)
 
-	// Make sure object doesn't already exist
-	if ObjectExists(h.Ctx, o) {
-		return nil, errors.WithStack(errors.Errorf("Can't write %v; It already exists", uri ))
+	switch opts.Mode {
+	case CreateOnly:
+		// Fail early if the object already exists; the precondition catches objects created after this check.
+		exists, err := ObjectExists(h.Ctx, o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't write %v", uri)
+		}
+
+		if exists {
+			return nil, errors.WithStack(errors.Wrapf(ErrGenerationMismatch, "Can't write %v; It already exists", uri))
+		}
+		o = o.If(storage.Conditions{DoesNotExist: true})
+	case Overwrite:
+	case IfGenerationMatch:
+		if opts.Generation == 0 {
+			o = o.If(storage.Conditions{DoesNotExist: true})
+		} else {
+			o = o.If(storage.Conditions{GenerationMatch: opts.Generation})
+		}
+	default:
+		return nil, errors.WithStack(errors.Errorf("Can't write %v; unknown write mode %v", uri, opts.Mode))
 	}
 
-	return o.NewWriter(h.Ctx), nil
+	return &gcsWriter{Writer: o.NewWriter(h.Ctx), uri: uri}, nil
 }
 
-// Exists checks whether the URI exists.
-//
-// If error is not nil the boolean value will be random.
-func (h *GcsHelper) Exists( uri string) (bool, error) {
-	// In the event of an error we return a random value for the boolean.
-	// This is meant to discourage callers from trusting the value in the event an error occured.
-	randVal := rand.Float32() > .5
+// gcsWriter translates failed preconditions into ErrGenerationMismatch.
+type gcsWriter struct {
+	*storage.Writer
+	uri string
+}
 
+func (w *gcsWriter) Close() error {
+	err := w.Writer.Close()
+	if err == nil {
+		return nil
+	}
+
+	if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusPreconditionFailed {
+		return errors.WithStack(errors.Wrapf(ErrGenerationMismatch, "Can't write %v", w.uri))
+	}
+	return errors.WithStack(errors.Wrapf(err, "Error writing %v", w.uri))
+}
+
+// Generation returns the GCS generation of the object or 0 if it doesn't exist.
+func (h *GcsHelper) Generation(uri string) (int64, error) {
 	p, err := Parse(uri)
 	if  err != nil {
-		return randVal, err
+		return 0, err
 	}
-	b := h.Client.Bucket(p.Bucket)
-
-	_, err = b.Attrs(h.Ctx)
 
+	attrs, err := h.Client.Bucket(p.Bucket).Object(p.Path).Attrs(h.Ctx)
 	if err != nil {
-		isMatch, _ := regexp.MatchString(".*doesn't.*exist.*", err.Error())
-
-		if isMatch {
-			return true, nil
+		if err == storage.ErrObjectNotExist {
+			return 0, nil
 		}
+		return 0, errors.WithStack(errors.Wrapf(err, "Could not get attributes of %v", uri))
+	}
+	return attrs.Generation, nil
+}
 
-		return randVal, err
+// Delete deletes the object. Deleting an object that doesn't exist isn't an error.
+func (h *GcsHelper) Delete(uri string) error {
+	p, err := Parse(uri)
+	if  err != nil {
+		return err
 	}
 
-	o := b.Object(p.Path)
+	err = h.Client.Bucket(p.Bucket).Object(p.Path).Delete(h.Ctx)
+	if err != nil && err != storage.ErrObjectNotExist {
+		return errors.WithStack(errors.Wrapf(err, "Could not delete %v", uri))
+	}
+	return nil
+}
 
-	return ObjectExists(h.Ctx, o), nil
+// List returns the URIs of all objects that start with the prefix. See ListObjectsWithPrefix.
+func (h *GcsHelper) List(prefix string) ([]string, error) {
+	return ListObjectsWithPrefix(h.Ctx, h.Client, prefix)
 }
 
-// BuildInputOutputList builds a map from input files to the files that they
-// should be mapped to.
+// Exists checks whether the URI exists. A URI without an object path exists if the bucket exists.
 //
-// input is a regex as specified by TransformFiles. This is used to find existing files and generate
-// the corresponding output files.
-func (h *GcsHelper) BuildInputOutputList(input string, output string) (map[string]string, error) {
-	paths, err := ListObjects(h.Ctx, h.Client, input)
+// A missing bucket or object isn't an error; any other failure, e.g. a permission error, is returned as an error.
+func (h *GcsHelper) Exists( uri string) (bool, error) {
+	p, err := Parse(uri)
+	if  err != nil {
+		return false, err
+	}
+	b := h.Client.Bucket(p.Bucket)
+
+	_, err = b.Attrs(h.Ctx)
 
 	if err != nil {
-		return map[string]string{}, errors.Wrapf(err, "Could not list files matching: %v", input)
+		if err == storage.ErrBucketNotExist {
+			return false, nil
+		}
+		return false, errors.WithStack(errors.Wrapf(err, "Could not get attributes of bucket %v", p.Bucket))
 	}
-	return util.TransformFiles(paths, input, output)
+
+	if p.Path == "" {
+		return true, nil
+	}
+
+	return ObjectExists(h.Ctx, b.Object(p.Path))
 }
 
-func ObjectExists(ctx context.Context, o *storage.ObjectHandle) bool {
+// ObjectExists checks whether the object exists. An error is returned if that can't be determined;
+// e.g. because the caller doesn't have permission to read the object.
+func ObjectExists(ctx context.Context, o *storage.ObjectHandle) (bool, error) {
 	_, err := o.Attrs(ctx)
 
 	if err == nil {
-		return true
+		return true, nil
 	}
 
-	isMatch, mErr := regexp.MatchString(".*doesn't.*exist.*", err.Error())
-
-	if mErr != nil {
-		log.Errorf("There was a problem matching the regex; %v", err)
-	}
-
-	if err !=nil && isMatch  {
-		return false
+	if err == storage.ErrObjectNotExist {
+		return false, nil
 	}
 
-	return true
+	return false, errors.WithStack(errors.Wrapf(err, "Could not get attributes of gs://%v/%v", o.BucketName(), o.ObjectName()))
 }
 
-// ListObjects lists all objects matching some regex.
+// ListObjects lists all objects matching the glob pattern uri; e.g. gs://bucket/groups/**/*.yaml.
 //
-// This is listing all files in the parent directory.
+// See Match for the glob syntax. Only objects below the leading path elements without wildcards are listed.
 func ListObjects(ctx context.Context, client *storage.Client, uri string) ([]string, error) {
 	paths := []string{}
 	p, err := Parse(uri)
@@ -175,18 +235,31 @@ func ListObjects(ctx context.Context, client *storage.Client, uri string) ([]str
 
 	b := client.Bucket(p.Bucket)
 
-	prefix := path.Dir(p.Path)
+	if err := validatePattern(p.Path); err != nil {
+		return paths, errors.WithStack(errors.Wrapf(err, "Invalid pattern %v", uri))
+	}
+
+	prefix, rest := globPrefix(p.Path)
 
 	q := &storage.Query{
-		Delimiter: "/",
-		Prefix:    prefix + "/",
+		Prefix:    prefix,
 		Versions:  false,
 	}
 
+	// If the pattern can only match objects directly below the prefix we don't need to list recursively.
+	if !strings.Contains(rest, "/") && !strings.Contains(rest, globStar) {
+		q.Delimiter = "/"
+	}
+
 	objs := b.Objects(ctx, q)
 	return findMatches(p, objs)
 }
 
+// Glob returns the URIs of the objects matching the glob pattern. See ListObjects.
+func (h *GcsHelper) Glob(pattern string) ([]string, error) {
+	return ListObjects(h.Ctx, h.Client, pattern)
+}
+
 // ListObjectsWithPrefix returns a list of all GCS objects within the given prefix.
 func ListObjectsWithPrefix(ctx context.Context, client *storage.Client, prefix string) ([]string, error) {
 	paths := []string{}
@@ -258,12 +331,15 @@ func findMatches(pattern *GcsPath, objs objectAttrsIterator) ([]string, error) {
 			Path: i.Name,
 		}
 
-		log.Debugf("path.Match(%v, %v)", pattern.ToURI(), iPath.ToURI())
-		isMatch, err := regexp.MatchString(pattern.ToURI(), iPath.ToURI())
+		if iPath.Bucket != pattern.Bucket {
+			continue
+		}
+
+		log.Debugf("Match(%v, %v)", pattern.ToURI(), iPath.ToURI())
+		isMatch, err := Match(pattern.Path, iPath.Path)
 
 		if err != nil {
-			log.Errorf("path.Match(%v, %v) returned error; %v", pattern.Path, iPath.ToURI(), err)
-			continue
+			return paths, errors.WithStack(errors.Wrapf(err, "Invalid pattern %v", pattern.ToURI()))
 		}
 
 		if isMatch {
@@ -2,8 +2,11 @@ package gcs
 
 import (
 	"cloud.google.com/go/storage"
+	"context"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/api/iterator"
+	"io/ioutil"
+	"net/http"
 	"regexp"
 	"testing"
 )
@@ -146,4 +149,172 @@ func TestFindMatches(t *testing.T) {
 			continue
 		}
 	}
-}
\ No newline at end of file
+}
+func TestGcsHelperExists(t *testing.T) {
+	type testCase struct {
+		name     string
+		uri      string
+		expected bool
+		wantErr  bool
+	}
+
+	f, client := newFakeGCSServer(t)
+	defer f.server.Close()
+
+	f.addObject("mybucket", "dirA/contract-1.pdf", "contract")
+	f.addObject("forbidden", "file.txt", "secret")
+	f.failures["forbidden"] = http.StatusForbidden
+	f.addObject("mybucket", "forbidden.txt", "secret")
+	f.failures["mybucket/forbidden.txt"] = http.StatusForbidden
+
+	cases := []testCase{
+		{name: "object-exists", uri: "gs://mybucket/dirA/contract-1.pdf", expected: true},
+		{name: "object-missing", uri: "gs://mybucket/dirA/contract-2.pdf", expected: false},
+		{name: "bucket-exists", uri: "gs://mybucket", expected: true},
+		{name: "bucket-missing", uri: "gs://missing/dirA/contract-1.pdf", expected: false},
+		{name: "bucket-forbidden", uri: "gs://forbidden/file.txt", wantErr: true},
+		{name: "object-forbidden", uri: "gs://mybucket/forbidden.txt", wantErr: true},
+	}
+
+	h := &GcsHelper{Ctx: context.Background(), Client: client}
+
+	for _, c := range cases {
+		actual, err := h.Exists(c.uri)
+
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("Case %v: Exists(%v) should have returned an error", c.name, c.uri)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Case %v: Exists(%v) returned error; %v", c.name, c.uri, err)
+			continue
+		}
+
+		if actual != c.expected {
+			t.Errorf("Case %v: Exists(%v) = %v; want %v", c.name, c.uri, actual, c.expected)
+		}
+	}
+}
+
+func TestGcsHelperNewWriter(t *testing.T) {
+	type testCase struct {
+		name  string
+		uri   string
+		errRe string
+	}
+
+	f, client := newFakeGCSServer(t)
+	defer f.server.Close()
+
+	f.addObject("mybucket", "existing.txt", "contents")
+	f.addObject("mybucket", "forbidden.txt", "secret")
+	f.failures["mybucket/forbidden.txt"] = http.StatusForbidden
+
+	cases := []testCase{
+		{name: "new-object", uri: "gs://mybucket/new.txt"},
+		{name: "existing-object", uri: "gs://mybucket/existing.txt", errRe: "already exists"},
+		{name: "bucket-missing", uri: "gs://missing/new.txt", errRe: "bucket missing doesn't exist"},
+		{name: "object-forbidden", uri: "gs://mybucket/forbidden.txt", errRe: "Forbidden"},
+	}
+
+	h := &GcsHelper{Ctx: context.Background(), Client: client}
+
+	for _, c := range cases {
+		w, err := h.NewWriter(c.uri)
+
+		if c.errRe == "" {
+			if err != nil {
+				t.Errorf("Case %v: NewWriter(%v) returned error; %v", c.name, c.uri, err)
+			} else if w == nil {
+				t.Errorf("Case %v: NewWriter(%v) returned a nil writer", c.name, c.uri)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("Case %v: NewWriter(%v) should have returned an error", c.name, c.uri)
+			continue
+		}
+
+		if !regexp.MustCompile(c.errRe).MatchString(err.Error()) {
+			t.Errorf("Case %v: NewWriter(%v) error %v doesn't match %v", c.name, c.uri, err, c.errRe)
+		}
+	}
+}
+
+func TestGcsHelperNewReader(t *testing.T) {
+	f, client := newFakeGCSServer(t)
+	defer f.server.Close()
+
+	f.addObject("mybucket", "dirA/file.txt", "hello world")
+
+	h := &GcsHelper{Ctx: context.Background(), Client: client}
+
+	r, err := h.NewReader("gs://mybucket/dirA/file.txt")
+	if err != nil {
+		t.Fatalf("NewReader returned error; %v", err)
+	}
+
+	actual, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Error reading object; %v", err)
+	}
+
+	if string(actual) != "hello world" {
+		t.Errorf("Got contents %q; want %q", actual, "hello world")
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	type testCase struct {
+		pattern  string
+		expected []string
+	}
+
+	f, client := newFakeGCSServer(t)
+	defer f.server.Close()
+
+	for _, o := range []string{"groups/ci-team.yaml", "groups/ci-teamxyaml", "groups/owners.txt", "groups/sub/a.yaml", "groups/sub/deeper/b.yaml", "other/c.yaml"} {
+		f.addObject("mybucket", o, o)
+	}
+
+	cases := []testCase{
+		{
+			pattern:  "gs://mybucket/groups/*.yaml",
+			expected: []string{"gs://mybucket/groups/ci-team.yaml"},
+		},
+		{
+			pattern:  "gs://mybucket/groups/**/*.yaml",
+			expected: []string{"gs://mybucket/groups/ci-team.yaml", "gs://mybucket/groups/sub/a.yaml", "gs://mybucket/groups/sub/deeper/b.yaml"},
+		},
+		{
+			pattern:  "gs://mybucket/*/*.yaml",
+			expected: []string{"gs://mybucket/groups/ci-team.yaml", "gs://mybucket/other/c.yaml"},
+		},
+		{
+			pattern:  "gs://mybucket/groups/owners.txt",
+			expected: []string{"gs://mybucket/groups/owners.txt"},
+		},
+	}
+
+	h := &GcsHelper{Ctx: context.Background(), Client: client}
+
+	for _, c := range cases {
+		actual, err := h.Glob(c.pattern)
+		if err != nil {
+			t.Errorf("Glob(%v) returned error; %v", c.pattern, err)
+			continue
+		}
+
+		if d := cmp.Diff(c.expected, actual); d != "" {
+			t.Errorf("Glob(%v) mismatch (-want +got):\n%s", c.pattern, d)
+		}
+	}
+
+	if _, err := h.Glob("gs://mybucket/groups/[a"); err == nil {
+		t.Errorf("Glob with a malformed pattern should return an error")
+	}
+}
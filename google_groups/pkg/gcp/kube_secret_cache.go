@@ -0,0 +1,167 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// KubeSecretTokenKey is the key in the Kubernetes secret containing the token.
+	KubeSecretTokenKey = "token"
+)
+
+// KubeSecretCache implements a cache for an OAuth2 credential using a Kubernetes secret.
+//
+// Save uses the resourceVersion of the secret that was read so it refuses to overwrite a token saved by someone else
+// after the token was read. The secret is created the first time a token is saved.
+type KubeSecretCache struct {
+	client    kubernetes.Interface
+	Namespace string
+	Name      string
+	Log       logr.Logger
+
+	// resourceVersion is the resourceVersion of the secret last read or written; it is empty if the secret
+	// didn't exist.
+	resourceVersion string
+}
+
+// NewKubeSecretCache creates a cache using the in-cluster configuration.
+func NewKubeSecretCache(namespace string, name string) (*KubeSecretCache, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error getting in-cluster Kubernetes config")
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error creating Kubernetes client")
+	}
+
+	return &KubeSecretCache{
+		client:    client,
+		Namespace: namespace,
+		Name:      name,
+		Log:       zapr.NewLogger(zap.L()),
+	}, nil
+}
+
+func (c *KubeSecretCache) GetToken() (*oauth2.Token, error) {
+	secret, err := c.client.CoreV1().Secrets(c.Namespace).Get(context.Background(), c.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			c.Log.Info("No secret exists containing cached token", "namespace", c.Namespace, "secret", c.Name)
+			c.resourceVersion = ""
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "Error getting secret %v/%v", c.Namespace, c.Name)
+	}
+
+	c.resourceVersion = secret.ResourceVersion
+
+	payload, ok := secret.Data[KubeSecretTokenKey]
+	if !ok || len(payload) == 0 {
+		c.Log.Info("Secret doesn't contain a cached token", "namespace", c.Namespace, "secret", c.Name, "key", KubeSecretTokenKey)
+		return nil, nil
+	}
+
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(payload, tok); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing token in secret %v/%v", c.Namespace, c.Name)
+	}
+	return tok, nil
+}
+
+// Save saves the token to the secret; creating the secret if it doesn't exist. An existing secret is updated in
+// place so its labels, annotations and other keys are kept.
+func (c *KubeSecretCache) Save(token *oauth2.Token) error {
+	log := c.Log
+	log.Info("Saving credential to Kubernetes secret", "namespace", c.Namespace, "secret", c.Name)
+
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	secrets := c.client.CoreV1().Secrets(c.Namespace)
+	ctx := context.Background()
+
+	var saved *corev1.Secret
+	if c.resourceVersion == "" {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: c.Namespace,
+				Name:      c.Name,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				KubeSecretTokenKey: payload,
+			},
+		}
+		saved, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	} else {
+		var secret *corev1.Secret
+		secret, err = secrets.Get(ctx, c.Name, metav1.GetOptions{})
+		if err == nil {
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			secret.Data[KubeSecretTokenKey] = payload
+			// Only update the version of the secret that was read; the API server rejects the update otherwise.
+			secret.ResourceVersion = c.resourceVersion
+			saved, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		}
+	}
+
+	if err != nil {
+		if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			latest := ""
+			if current, gErr := secrets.Get(ctx, c.Name, metav1.GetOptions{}); gErr == nil {
+				latest = current.ResourceVersion
+			}
+			log.Info("Not saving token; the secret was updated since it was read", "read", c.resourceVersion, "latest", latest)
+			return &ConflictError{Read: c.resourceVersion, Latest: latest}
+		}
+		return errors.Wrapf(err, "Error saving token to secret %v/%v", c.Namespace, c.Name)
+	}
+
+	c.resourceVersion = saved.ResourceVersion
+	log.Info("Stored token in Kubernetes secret", "namespace", c.Namespace, "secret", c.Name, "resourceVersion", saved.ResourceVersion)
+	return nil
+}
+
+// Clear removes the token from the secret. The secret itself is kept.
+func (c *KubeSecretCache) Clear() error {
+	secrets := c.client.CoreV1().Secrets(c.Namespace)
+	ctx := context.Background()
+
+	secret, err := secrets.Get(ctx, c.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "Error getting secret %v/%v", c.Namespace, c.Name)
+	}
+
+	if _, ok := secret.Data[KubeSecretTokenKey]; !ok {
+		return nil
+	}
+
+	c.Log.Info("Removing credential from Kubernetes secret", "namespace", c.Namespace, "secret", c.Name)
+	delete(secret.Data, KubeSecretTokenKey)
+	updated, err := secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "Error removing token from secret %v/%v", c.Namespace, c.Name)
+	}
+	c.resourceVersion = updated.ResourceVersion
+	return nil
+}
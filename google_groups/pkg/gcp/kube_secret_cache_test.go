@@ -0,0 +1,188 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/zapr"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"strconv"
+	"testing"
+)
+
+// newFakeClientset returns a fake clientset that, like the API server, assigns resource versions and rejects
+// updates of stale secrets.
+func newFakeClientset() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	version := 0
+
+	client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.CreateAction).GetObject().(*corev1.Secret).DeepCopy()
+		version++
+		secret.ResourceVersion = strconv.Itoa(version)
+		if err := client.Tracker().Create(action.GetResource(), secret, secret.Namespace); err != nil {
+			return true, nil, err
+		}
+		return true, secret, nil
+	})
+
+	client.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.UpdateAction).GetObject().(*corev1.Secret).DeepCopy()
+		current, err := client.Tracker().Get(action.GetResource(), secret.Namespace, secret.Name)
+		if err != nil {
+			return true, nil, err
+		}
+
+		if current.(*corev1.Secret).ResourceVersion != secret.ResourceVersion {
+			return true, nil, apierrors.NewConflict(action.GetResource().GroupResource(), secret.Name, fmt.Errorf("the object has been modified"))
+		}
+
+		version++
+		secret.ResourceVersion = strconv.Itoa(version)
+		if err := client.Tracker().Update(action.GetResource(), secret, secret.Namespace); err != nil {
+			return true, nil, err
+		}
+		return true, secret, nil
+	})
+	return client
+}
+
+func TestKubeSecretCache(t *testing.T) {
+	client := newFakeClientset()
+
+	newCache := func() *KubeSecretCache {
+		return &KubeSecretCache{
+			client:    client,
+			Namespace: "groups",
+			Name:      "oauth-token",
+			Log:       zapr.NewLogger(zap.L()),
+		}
+	}
+
+	pod := newCache()
+	person := newCache()
+
+	tok, err := pod.GetToken()
+	if err != nil || tok != nil {
+		t.Fatalf("GetToken on a missing secret returned %v, %v; want nil, nil", tok, err)
+	}
+
+	// The first save creates the secret.
+	if err := pod.Save(&oauth2.Token{AccessToken: "pod-1"}); err != nil {
+		t.Fatalf("Save returned error; %v", err)
+	}
+
+	// Creating the secret again is a conflict.
+	if err := person.Save(&oauth2.Token{AccessToken: "person-0"}); !IsConflict(err) {
+		t.Errorf("Save of a secret created by someone else returned %v; want a ConflictError", err)
+	}
+
+	tok, err = person.GetToken()
+	if err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	if tok.AccessToken != "pod-1" {
+		t.Errorf("Got access token %v; want pod-1", tok.AccessToken)
+	}
+
+	if err := person.Save(&oauth2.Token{AccessToken: "person-1"}); err != nil {
+		t.Fatalf("Save returned error; %v", err)
+	}
+
+	// The pod's view of the secret is stale so it mustn't overwrite the person's token.
+	if err := pod.Save(&oauth2.Token{AccessToken: "pod-2"}); !IsConflict(err) {
+		t.Errorf("Save of a stale secret returned %v; want a ConflictError", err)
+	}
+
+	tok, err = pod.GetToken()
+	if err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	if tok.AccessToken != "person-1" {
+		t.Errorf("Got access token %v; want person-1", tok.AccessToken)
+	}
+
+	// After re-reading the secret the pod can save again.
+	if err := pod.Save(&oauth2.Token{AccessToken: "pod-3"}); err != nil {
+		t.Errorf("Save after re-reading returned error; %v", err)
+	}
+
+	tok, err = newCache().GetToken()
+	if err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	if tok.AccessToken != "pod-3" {
+		t.Errorf("Got access token %v; want pod-3", tok.AccessToken)
+	}
+}
+
+func TestKubeSecretCacheKeepsMetadata(t *testing.T) {
+	client := newFakeClientset()
+
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "groups",
+			Name:        "oauth-token",
+			Labels:      map[string]string{"app": "google-groups"},
+			Annotations: map[string]string{"owner": "kubeflow-admins"},
+		},
+		Data: map[string][]byte{
+			"smtp-password": []byte("secret"),
+		},
+	}
+
+	if _, err := client.CoreV1().Secrets("groups").Create(context.Background(), existing, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create secret; %v", err)
+	}
+
+	cache := &KubeSecretCache{
+		client:    client,
+		Namespace: "groups",
+		Name:      "oauth-token",
+		Log:       zapr.NewLogger(zap.L()),
+	}
+
+	if _, err := cache.GetToken(); err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	if err := cache.Save(&oauth2.Token{AccessToken: "pod-1"}); err != nil {
+		t.Fatalf("Save returned error; %v", err)
+	}
+
+	secret, err := client.CoreV1().Secrets("groups").Get(context.Background(), "oauth-token", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get secret; %v", err)
+	}
+
+	if d := cmp.Diff(existing.Labels, secret.Labels); d != "" {
+		t.Errorf("Labels changed; diff:\n%v", d)
+	}
+
+	if d := cmp.Diff(existing.Annotations, secret.Annotations); d != "" {
+		t.Errorf("Annotations changed; diff:\n%v", d)
+	}
+
+	if string(secret.Data["smtp-password"]) != "secret" {
+		t.Errorf("Key smtp-password was %q; want secret", secret.Data["smtp-password"])
+	}
+
+	tok, err := cache.GetToken()
+	if err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	if tok.AccessToken != "pod-1" {
+		t.Errorf("Got access token %v; want pod-1", tok.AccessToken)
+	}
+}
@@ -0,0 +1,272 @@
+package gcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// AuthFlow is the OAuth2 flow used by WebFlowHelper to get a token.
+type AuthFlow string
+
+const (
+	// LoopbackFlow redirects the browser to a local HTTP listener. It requires a browser on the same machine.
+	LoopbackFlow AuthFlow = "loopback"
+	// DeviceFlow shows a code which is entered on another device. Use it on headless machines.
+	DeviceFlow AuthFlow = "device"
+
+	// GoogleDeviceAuthURL is Google's device authorization endpoint.
+	GoogleDeviceAuthURL = "https://oauth2.googleapis.com/device/code"
+
+	// defaultDevicePollInterval is how often to poll for the token if the server doesn't say.
+	defaultDevicePollInterval = 5 * time.Second
+)
+
+// randomString returns a random URL safe string.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallenge returns the S256 code challenge for the verifier; see RFC 7636.
+func pkceChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// loopbackToken gets a token with the authorization code flow. The browser is redirected to a listener on an
+// ephemeral local port. PKCE and a random state protect the code from being intercepted or forged.
+func (h *WebFlowHelper) loopbackToken(ctx context.Context) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to start local listener for the OAuth2 redirect")
+	}
+	defer listener.Close()
+
+	config := *h.config
+	config.RedirectURL = fmt.Sprintf("http://%v/", listener.Addr().String())
+
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+
+	// Only the redirect with the expected state completes the flow. Anything else, e.g. the browser asking for
+	// a favicon, a prefetch or a forged redirect, is rejected and the flow keeps waiting.
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			if r.URL.Path != "/" || q.Get("state") != state {
+				http.Error(w, "Not an OAuth2 redirect for this login", http.StatusBadRequest)
+				return
+			}
+
+			var res result
+			switch {
+			case q.Get("error") != "":
+				res.err = errors.Errorf("Authorization failed: %v", q.Get("error"))
+			case q.Get("code") == "":
+				res.err = errors.New("OAuth2 redirect is missing the authorization code")
+			default:
+				res.code = q.Get("code")
+			}
+
+			if res.err != nil {
+				http.Error(w, res.err.Error(), http.StatusBadRequest)
+			} else {
+				fmt.Fprintln(w, "Authorization complete; you can close this window.")
+			}
+
+			select {
+			case results <- res:
+			default:
+			}
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authOpts := []oauth2.AuthCodeOption{
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+
+	if h.ForceConsent {
+		authOpts = append(authOpts, oauth2.ApprovalForce)
+	}
+
+	authURL := config.AuthCodeURL(state, authOpts...)
+
+	fmt.Fprintf(h.out(), "Go to the following link in your browser to authorize access:\n%v\n", authURL)
+
+	if h.OpenBrowser != nil {
+		if err := h.OpenBrowser(authURL); err != nil {
+			h.Log.Error(err, "Could not open browser")
+		}
+	}
+
+	var res result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "Timed out waiting for the OAuth2 redirect")
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	tok, err := config.Exchange(ctx, res.code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to exchange authorization code for a token")
+	}
+	return tok, nil
+}
+
+// deviceAuthResponse is the response from the device authorization endpoint; see RFC 8628.
+type deviceAuthResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	// VerificationURL is used by Google instead of verification_uri.
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        *int   `json:"interval"`
+}
+
+type deviceTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+// deviceToken gets a token with the OAuth2 device authorization flow.
+func (h *WebFlowHelper) deviceToken(ctx context.Context) (*oauth2.Token, error) {
+	deviceAuthURL := h.DeviceAuthURL
+	if deviceAuthURL == "" {
+		deviceAuthURL = GoogleDeviceAuthURL
+	}
+
+	auth := &deviceAuthResponse{}
+	err := postForm(ctx, deviceAuthURL, url.Values{
+		"client_id": {h.config.ClientID},
+		"scope":     {strings.Join(h.config.Scopes, " ")},
+	}, auth)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Device authorization request failed")
+	}
+
+	verificationURI := auth.VerificationURI
+	if verificationURI == "" {
+		verificationURI = auth.VerificationURL
+	}
+
+	fmt.Fprintf(h.out(), "Go to %v on any device and enter the code: %v\n", verificationURI, auth.UserCode)
+
+	interval := defaultDevicePollInterval
+	if auth.Interval != nil {
+		interval = time.Duration(*auth.Interval) * time.Second
+	}
+
+	if auth.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(auth.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "Timed out waiting for device authorization")
+		}
+
+		resp := &deviceTokenResponse{}
+		err := postForm(ctx, h.config.Endpoint.TokenURL, url.Values{
+			"client_id":     {h.config.ClientID},
+			"client_secret": {h.config.ClientSecret},
+			"device_code":   {auth.DeviceCode},
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+		}, resp)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "Device token request failed")
+		}
+
+		switch resp.Error {
+		case "":
+			tok := &oauth2.Token{
+				AccessToken:  resp.AccessToken,
+				RefreshToken: resp.RefreshToken,
+				TokenType:    resp.TokenType,
+			}
+			if resp.ExpiresIn > 0 {
+				tok.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+			}
+			return tok, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, errors.Errorf("Device authorization failed: %v", resp.Error)
+		}
+	}
+}
+
+// postForm posts the form and decodes the JSON response. Error responses are decoded too since they
+// describe why the request failed; e.g. authorization_pending.
+func postForm(ctx context.Context, endpoint string, form url.Values, result interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Wrapf(err, "Unable to decode response from %v; status %v", endpoint, resp.Status)
+	}
+	return nil
+}
+
+func (h *WebFlowHelper) out() io.Writer {
+	if h.Out != nil {
+		return h.Out
+	}
+	return os.Stdout
+}
@@ -0,0 +1,261 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOAuthServer implements the authorization, token and device endpoints of an OAuth2 server.
+type fakeOAuthServer struct {
+	mu        sync.Mutex
+	challenge string
+	// pending is the number of device token requests to answer with authorization_pending.
+	pending int
+	// refreshes is the number of refresh token grants served.
+	refreshes int
+	// rotate causes refresh token grants to issue a new refresh token.
+	rotate bool
+	// refreshError if set is returned as the error for refresh token grants.
+	refreshError string
+	// prompt is the prompt parameter of the last authorization request.
+	prompt string
+	// revoked is the set of revoked tokens.
+	revoked map[string]bool
+	server  *httptest.Server
+}
+
+func newFakeOAuthServer() *fakeOAuthServer {
+	f := &fakeOAuthServer{revoked: map[string]bool{}}
+	f.server = httptest.NewServer(f)
+	return f
+}
+
+func (f *fakeOAuthServer) config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Scopes:       []string{"scope-a"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   f.server.URL + "/auth",
+			TokenURL:  f.server.URL + "/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+func (f *fakeOAuthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+
+	writeJSON := func(code int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	switch r.URL.Path {
+	case "/auth":
+		f.challenge = r.Form.Get("code_challenge")
+		f.prompt = r.Form.Get("prompt")
+		redirect, _ := url.Parse(r.Form.Get("redirect_uri"))
+		q := redirect.Query()
+		q.Set("code", "auth-code")
+		q.Set("state", r.Form.Get("state"))
+		redirect.RawQuery = q.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	case "/device":
+		writeJSON(http.StatusOK, map[string]interface{}{
+			"device_code":      "device-code",
+			"user_code":        "ABCD-EFGH",
+			"verification_url": "https://www.google.com/device",
+			"expires_in":       60,
+			"interval":         0,
+		})
+	case "/token":
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			if r.Form.Get("code") != "auth-code" || pkceChallenge(r.Form.Get("code_verifier")) != f.challenge {
+				writeJSON(http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			writeJSON(http.StatusOK, map[string]interface{}{"access_token": "loopback-token", "refresh_token": "refresh-1", "token_type": "Bearer", "expires_in": 3600})
+		case "urn:ietf:params:oauth:grant-type:device_code":
+			if f.pending > 0 {
+				f.pending--
+				writeJSON(http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+				return
+			}
+			writeJSON(http.StatusOK, map[string]interface{}{"access_token": "device-token", "refresh_token": "refresh-1", "token_type": "Bearer", "expires_in": 3600})
+		case "refresh_token":
+			if f.refreshError != "" {
+				writeJSON(http.StatusBadRequest, map[string]string{"error": f.refreshError})
+				return
+			}
+			if f.revoked[r.Form.Get("refresh_token")] {
+				writeJSON(http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			f.refreshes++
+			resp := map[string]interface{}{"access_token": fmt.Sprintf("refreshed-%v", f.refreshes), "token_type": "Bearer", "expires_in": 3600}
+			if f.rotate {
+				resp["refresh_token"] = fmt.Sprintf("refresh-%v", f.refreshes+1)
+			}
+			writeJSON(http.StatusOK, resp)
+		default:
+			writeJSON(http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		}
+	case "/revoke":
+		t := r.Form.Get("token")
+		if f.revoked[t] {
+			writeJSON(http.StatusBadRequest, map[string]string{"error": "invalid_token"})
+			return
+		}
+		f.revoked[t] = true
+		w.WriteHeader(http.StatusOK)
+	case "/tokeninfo":
+		if !strings.HasPrefix(r.Form.Get("access_token"), "refreshed-") {
+			writeJSON(http.StatusBadRequest, map[string]string{"error": "invalid_token"})
+			return
+		}
+		writeJSON(http.StatusOK, map[string]string{"scope": "scope-a scope-b", "email": "autobot@kubeflow.org"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestLoopbackFlow(t *testing.T) {
+	f := newFakeOAuthServer()
+	defer f.server.Close()
+
+	type testCase struct {
+		name string
+		// browser simulates the user's browser visiting the auth URL.
+		browser  func(authURL string) error
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			name: "success",
+			browser: func(authURL string) error {
+				go http.Get(authURL)
+				return nil
+			},
+			expected: "loopback-token",
+		},
+		{
+			// Requests which aren't the redirect for this login are rejected without ending the flow.
+			name: "ignore-other-requests",
+			browser: func(authURL string) error {
+				u, _ := url.Parse(authURL)
+				redirect := u.Query().Get("redirect_uri")
+				for _, r := range []string{"favicon.ico", "", "?code=auth-code&state=forged"} {
+					resp, err := http.Get(redirect + r)
+					if err != nil {
+						return err
+					}
+					resp.Body.Close()
+					if resp.StatusCode != http.StatusBadRequest {
+						t.Errorf("Request %q: got status %v; want %v", r, resp.StatusCode, http.StatusBadRequest)
+					}
+				}
+				go http.Get(authURL)
+				return nil
+			},
+			expected: "loopback-token",
+		},
+		{
+			name: "access-denied",
+			browser: func(authURL string) error {
+				u, _ := url.Parse(authURL)
+				redirect := u.Query().Get("redirect_uri")
+				go http.Get(redirect + "?error=access_denied&state=" + url.QueryEscape(u.Query().Get("state")))
+				return nil
+			},
+		},
+	}
+
+	for _, c := range cases {
+		h := &WebFlowHelper{
+			config:      f.config(),
+			Log:         zapr.NewLogger(zap.L()),
+			Out:         ioutil.Discard,
+			OpenBrowser: c.browser,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ts, err := h.GetTokenSource(ctx)
+		cancel()
+
+		if c.expected == "" {
+			if err == nil || !strings.Contains(err.Error(), "access_denied") {
+				t.Errorf("Case %v: got error %v; want access_denied", c.name, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Case %v: GetTokenSource returned error; %v", c.name, err)
+			continue
+		}
+
+		tok, err := ts.Token()
+		if err != nil {
+			t.Errorf("Case %v: Token returned error; %v", c.name, err)
+			continue
+		}
+
+		if tok.AccessToken != c.expected {
+			t.Errorf("Case %v: got access token %v; want %v", c.name, tok.AccessToken, c.expected)
+		}
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	f := newFakeOAuthServer()
+	defer f.server.Close()
+	f.pending = 2
+
+	out := &strings.Builder{}
+	h := &WebFlowHelper{
+		config:        f.config(),
+		Log:           zapr.NewLogger(zap.L()),
+		Flow:          DeviceFlow,
+		DeviceAuthURL: f.server.URL + "/device",
+		Out:           out,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ts, err := h.GetTokenSource(ctx)
+	if err != nil {
+		t.Fatalf("GetTokenSource returned error; %v", err)
+	}
+
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token returned error; %v", err)
+	}
+
+	if tok.AccessToken != "device-token" || tok.RefreshToken != "refresh-1" {
+		t.Errorf("Got token %+v; want device-token with refresh token refresh-1", tok)
+	}
+
+	if !strings.Contains(out.String(), "ABCD-EFGH") {
+		t.Errorf("Instructions don't include the user code:\n%v", out.String())
+	}
+}
@@ -0,0 +1,107 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// MissingScopesError is returned when a token doesn't carry the OAuth2 scopes a command needs; e.g. because the
+// cached token was obtained by a command that only needed read-only scopes.
+type MissingScopesError struct {
+	Missing []string
+	Granted []string
+}
+
+func (e *MissingScopesError) Error() string {
+	return fmt.Sprintf("the OAuth2 token is missing the scopes %v; it was granted %v. Run auth login to get a token with the scopes this command needs",
+		strings.Join(e.Missing, ", "), strings.Join(e.Granted, ", "))
+}
+
+// MissingScopes returns the required scopes that aren't covered by the granted scopes.
+// Following Google's naming convention a scope covers the narrower scopes it is a prefix of; e.g.
+// admin.directory.group covers admin.directory.group.readonly and admin.directory.group.member.
+func MissingScopes(granted []string, required []string) []string {
+	var missing []string
+	for _, r := range required {
+		covered := false
+		for _, g := range granted {
+			if r == g || strings.HasPrefix(r, g+".") {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			missing = append(missing, r)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// VerifyScopes checks that the tokens returned by ts carry the required scopes. The scopes are looked up with
+// the token info endpoint at tokenInfoURL; if it is empty GoogleTokenInfoURL is used.
+func VerifyScopes(ctx context.Context, ts oauth2.TokenSource, required []string, tokenInfoURL string) error {
+	if len(required) == 0 {
+		return nil
+	}
+
+	tok, err := ts.Token()
+	if err != nil {
+		return errors.Wrapf(err, "Error getting token")
+	}
+
+	info, err := getTokenInfo(ctx, tokenInfoURL, tok.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	granted := strings.Fields(info.Scope)
+	if missing := MissingScopes(granted, required); len(missing) > 0 {
+		sort.Strings(granted)
+		return &MissingScopesError{Missing: missing, Granted: granted}
+	}
+	return nil
+}
+
+type tokenInfo struct {
+	Scope string `json:"scope"`
+	Email string `json:"email"`
+}
+
+// getTokenInfo describes an access token using the token info endpoint.
+func getTokenInfo(ctx context.Context, infoURL string, accessToken string) (*tokenInfo, error) {
+	if infoURL == "" {
+		infoURL = GoogleTokenInfoURL
+	}
+
+	req, err := http.NewRequest(http.MethodGet, infoURL+"?"+url.Values{"access_token": {accessToken}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error getting token info")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("Error getting token info; status %v: %s", resp.Status, body)
+	}
+
+	info := &tokenInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, errors.Wrapf(err, "Error decoding token info")
+	}
+	return info, nil
+}
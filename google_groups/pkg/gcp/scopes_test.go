@@ -0,0 +1,73 @@
+package gcp
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/oauth2"
+	"testing"
+)
+
+func TestMissingScopes(t *testing.T) {
+	type testCase struct {
+		name     string
+		granted  []string
+		required []string
+		expected []string
+	}
+
+	const prefix = "https://www.googleapis.com/auth/"
+
+	cases := []testCase{
+		{
+			name:     "exact",
+			granted:  []string{prefix + "admin.directory.group.readonly"},
+			required: []string{prefix + "admin.directory.group.readonly"},
+		},
+		{
+			name:     "broader-scope",
+			granted:  []string{prefix + "admin.directory.group"},
+			required: []string{prefix + "admin.directory.group.readonly", prefix + "admin.directory.group.member.readonly"},
+		},
+		{
+			name:     "read-only-token",
+			granted:  []string{prefix + "admin.directory.group.readonly", prefix + "apps.groups.settings"},
+			required: []string{prefix + "apps.groups.settings", prefix + "admin.directory.group.member", prefix + "admin.directory.group"},
+			expected: []string{prefix + "admin.directory.group", prefix + "admin.directory.group.member"},
+		},
+		{
+			name:     "prefix-without-dot",
+			granted:  []string{prefix + "admin.directory.group"},
+			required: []string{prefix + "admin.directory.groupsettings"},
+			expected: []string{prefix + "admin.directory.groupsettings"},
+		},
+	}
+
+	for _, c := range cases {
+		actual := MissingScopes(c.granted, c.required)
+		if d := cmp.Diff(c.expected, actual); d != "" {
+			t.Errorf("Case %v: missing scopes mismatch (-want +got):\n%s", c.name, d)
+		}
+	}
+}
+
+func TestVerifyScopes(t *testing.T) {
+	f := newFakeOAuthServer()
+	defer f.server.Close()
+
+	// The fake server grants scope-a and scope-b.
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "refreshed-1"})
+
+	if err := VerifyScopes(context.Background(), ts, []string{"scope-a"}, f.server.URL+"/tokeninfo"); err != nil {
+		t.Errorf("VerifyScopes returned error; %v", err)
+	}
+
+	err := VerifyScopes(context.Background(), ts, []string{"scope-a", "scope-c"}, f.server.URL+"/tokeninfo")
+	missing, ok := err.(*MissingScopesError)
+	if !ok {
+		t.Fatalf("VerifyScopes returned %v; want a MissingScopesError", err)
+	}
+
+	if d := cmp.Diff([]string{"scope-c"}, missing.Missing); d != "" {
+		t.Errorf("Missing scopes mismatch (-want +got):\n%s", d)
+	}
+}
@@ -10,12 +10,50 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// PruneMode determines what happens to superseded versions of a secret.
+type PruneMode string
+
+const (
+	// PruneDisable disables superseded versions; they can be re-enabled.
+	PruneDisable PruneMode = "disable"
+	// PruneDestroy irrevocably destroys superseded versions.
+	PruneDestroy PruneMode = "destroy"
+)
+
+// ConflictError is returned by a TokenCache's Save when the secret was updated after it was read;
+// e.g. because another replica or a person refreshed the token. The newer version is left in place.
+type ConflictError struct {
+	// Read is the version that was read; it is empty if no version was read.
+	Read string
+	// Latest is the newer version.
+	Latest string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("secret version %v was added after version %q was read; refusing to overwrite it", e.Latest, e.Read)
+}
+
+// IsConflict returns true if err was caused by a newer version of a cached token.
+func IsConflict(err error) bool {
+	var c *ConflictError
+	return errors.As(err, &c)
+}
+
 // SecretCache implements a cache for an OAuth2 credential using GCP secret manager
+//
+// Save uses optimistic concurrency; it refuses to add a version if the latest version isn't the one last read or
+// written by this cache. Secret manager has no conditional writes so there is still a small window in which two
+// writers can both add a version.
 type SecretCache struct {
 	client *secretmanager.Client
 	Project string
@@ -23,9 +61,18 @@ type SecretCache struct {
 	Version string
 	Log logr.Logger
 
+	// KeepVersions is the number of most recent versions to keep when a new version is saved. Older versions are
+	// pruned according to Prune. If it is 0 no versions are pruned.
+	KeepVersions int
+	// Prune determines how superseded versions are pruned. Defaults to PruneDisable.
+	Prune PruneMode
+
+	// loaded is the resource name of the version last read or written; it is empty if there was none.
+	loaded string
 }
 
-func NewSecretCache(project string,  secret string, version string) (*SecretCache, error) {
+// NewSecretCache creates a new cache. opts are passed to the secret manager client.
+func NewSecretCache(project string,  secret string, version string, opts ...option.ClientOption) (*SecretCache, error) {
 	c := &SecretCache{
 		Project: project,
 		Secret:  secret,
@@ -33,7 +80,7 @@ func NewSecretCache(project string,  secret string, version string) (*SecretCach
 		Log:     zapr.NewLogger(zap.L()),
 	}
 
-	client, err := secretmanager.NewClient(context.Background())
+	client, err := secretmanager.NewClient(context.Background(), opts...)
 
 	if err != nil {
 		return nil, err
@@ -102,10 +149,20 @@ func (c *SecretCache) Save(token *oauth2.Token) error {
 		return err
 	}
 
+	latest, err := c.latestVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if latest != c.loaded {
+		err := &ConflictError{Read: c.loaded, Latest: latest}
+		log.Info("Not saving token; the secret was updated since it was read", "read", c.loaded, "latest", latest)
+		return err
+	}
 
 	// Build the request.
 	addSecretVersionReq := &secretmanagerpb.AddSecretVersionRequest{
-		Parent: fmt.Sprintf("projects/%v/secrets/%v", c.Project, c.Secret),
+		Parent: c.secretName(),
 		Payload: &secretmanagerpb.SecretPayload{
 			Data: payload,
 		},
@@ -117,13 +174,134 @@ func (c *SecretCache) Save(token *oauth2.Token) error {
 		return err
 	}
 
-	log.Info("Stored token in secret manager,", "version", version)
+	c.loaded = version.Name
+	log.Info("Stored token in secret manager,", "version", version.Name)
+
+	// Failing to prune old versions shouldn't fail the save.
+	if err := c.prune(ctx); err != nil {
+		log.Error(err, "Failed to prune superseded versions of the secret", "secret", c.secretName())
+	}
+	return nil
+}
+
+// Clear destroys all versions of the secret. The secret itself is kept.
+func (c *SecretCache) Clear() error {
+	ctx := context.Background()
+	it := c.client.ListSecretVersions(ctx, &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: c.secretName(),
+	})
+
+	for {
+		v, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return errors.Wrapf(err, "Error listing versions of secret %v", c.secretName())
+		}
+
+		if v.State == secretmanagerpb.SecretVersion_DESTROYED {
+			continue
+		}
+
+		c.Log.Info("Destroying secret version", "version", v.Name)
+		if _, err := c.client.DestroySecretVersion(ctx, &secretmanagerpb.DestroySecretVersionRequest{Name: v.Name}); err != nil {
+			return errors.Wrapf(err, "Error destroying secret version %v", v.Name)
+		}
+	}
 	return nil
 }
 
+func (c *SecretCache) secretName() string {
+	return fmt.Sprintf("projects/%v/secrets/%v", c.Project, c.Secret)
+}
+
+// latestVersion returns the resource name of the latest version of the secret or the empty string if there is none.
+func (c *SecretCache) latestVersion(ctx context.Context) (string, error) {
+	v, err := c.client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{
+		Name: c.secretName() + "/versions/latest",
+	})
+
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "Error getting the latest version of secret %v", c.secretName())
+	}
+	return v.Name, nil
+}
+
+// prune disables or destroys all but the KeepVersions most recent versions of the secret.
+func (c *SecretCache) prune(ctx context.Context) error {
+	if c.KeepVersions <= 0 {
+		return nil
+	}
+
+	candidates := []*secretmanagerpb.SecretVersion{}
+	it := c.client.ListSecretVersions(ctx, &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: c.secretName(),
+	})
+
+	for {
+		v, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error listing versions of secret %v", c.secretName())
+		}
+
+		if v.State == secretmanagerpb.SecretVersion_DESTROYED {
+			continue
+		}
+		candidates = append(candidates, v)
+	}
+
+	// Sort the versions from newest to oldest.
+	sort.Slice(candidates, func(i, j int) bool {
+		return versionNumber(candidates[i].Name) > versionNumber(candidates[j].Name)
+	})
+
+	if len(candidates) <= c.KeepVersions {
+		return nil
+	}
+
+	for _, v := range candidates[c.KeepVersions:] {
+		var err error
+		switch c.Prune {
+		case PruneDestroy:
+			c.Log.Info("Destroying superseded secret version", "version", v.Name)
+			_, err = c.client.DestroySecretVersion(ctx, &secretmanagerpb.DestroySecretVersionRequest{Name: v.Name})
+		default:
+			if v.State == secretmanagerpb.SecretVersion_DISABLED {
+				continue
+			}
+			c.Log.Info("Disabling superseded secret version", "version", v.Name)
+			_, err = c.client.DisableSecretVersion(ctx, &secretmanagerpb.DisableSecretVersionRequest{Name: v.Name})
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "Error pruning secret version %v", v.Name)
+		}
+	}
+	return nil
+}
+
+// versionNumber returns the number of a secret version given its resource name; it returns -1 if there is none.
+func versionNumber(name string) int {
+	n, err := strconv.Atoi(name[strings.LastIndex(name, "/")+1:])
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
 func (c *SecretCache) loadSecret() ([]byte, error) {
 	log := c.Log
-	name := fmt.Sprintf("projects/%v/secrets/%v/versions/%s", c.Project, c.Secret, c.Version)
+	name := fmt.Sprintf("%v/versions/%s", c.secretName(), c.Version)
 	accessRequest := &secretmanagerpb.AccessSecretVersionRequest{
 		Name: name,
 	}
@@ -138,16 +316,25 @@ func (c *SecretCache) loadSecret() ([]byte, error) {
 		if ok {
 			if status.Code() == codes.NotFound {
 				log.Info("No secret exists containing cached token", "secret", name)
+				c.loaded = ""
 				return nil, nil
 			}
 
 			if status.Code() == codes.FailedPrecondition {
 				log.Info("Latest version of secret is not valid a new secret will be created.", "secret", name, "status_message", status.Message())
+				latest, err := c.latestVersion(ctx)
+				if err != nil {
+					return nil, err
+				}
+				// Record the invalid version so saving a new token isn't treated as a conflict.
+				c.loaded = latest
 				return nil, nil
 			}
 		}
 		return nil, errors.Wrapf(err, "failed to access secret %v", name)
 	}
 
+	// Record the version that was actually read; e.g. the version "latest" resolved to.
+	c.loaded = result.Name
 	return result.Payload.Data, nil
 }
\ No newline at end of file
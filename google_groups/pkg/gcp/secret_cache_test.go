@@ -0,0 +1,281 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/zapr"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSecretManager is an in memory implementation of the secret manager API.
+type fakeSecretManager struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+	mu sync.Mutex
+	// versions maps the name of each secret to its versions; version i+1 is at index i.
+	versions map[string][]*fakeSecretVersion
+}
+
+type fakeSecretVersion struct {
+	state secretmanagerpb.SecretVersion_State
+	data  []byte
+}
+
+func newFakeSecretManager(t *testing.T) (*fakeSecretManager, []option.ClientOption, func()) {
+	f := &fakeSecretManager{versions: map[string][]*fakeSecretVersion{}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen; error %v", err)
+	}
+
+	server := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(server, f)
+	go server.Serve(l)
+
+	opts := []option.ClientOption{
+		option.WithEndpoint(l.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+	}
+	return f, opts, server.Stop
+}
+
+// resolve returns the secret and index of the version with the given name.
+func (f *fakeSecretManager) resolve(name string) (string, int, error) {
+	i := strings.Index(name, "/versions/")
+	secret := name[:i]
+	versions, ok := f.versions[secret]
+	if !ok {
+		return "", 0, status.Errorf(codes.NotFound, "secret %v not found", secret)
+	}
+
+	id := name[i+len("/versions/"):]
+	n := len(versions)
+	if id != "latest" {
+		fmt.Sscanf(id, "%d", &n)
+	}
+
+	if n < 1 || n > len(versions) {
+		return "", 0, status.Errorf(codes.NotFound, "version %v not found", name)
+	}
+	return secret, n - 1, nil
+}
+
+func (f *fakeSecretManager) metadata(secret string, i int) *secretmanagerpb.SecretVersion {
+	return &secretmanagerpb.SecretVersion{
+		Name:  fmt.Sprintf("%v/versions/%v", secret, i+1),
+		State: f.versions[secret][i].state,
+	}
+}
+
+func (f *fakeSecretManager) CreateSecret(ctx context.Context, req *secretmanagerpb.CreateSecretRequest) (*secretmanagerpb.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := req.Parent + "/secrets/" + req.SecretId
+	if _, ok := f.versions[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "secret %v exists", name)
+	}
+	f.versions[name] = []*fakeSecretVersion{}
+	return &secretmanagerpb.Secret{Name: name}, nil
+}
+
+func (f *fakeSecretManager) AddSecretVersion(ctx context.Context, req *secretmanagerpb.AddSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.versions[req.Parent] = append(f.versions[req.Parent], &fakeSecretVersion{state: secretmanagerpb.SecretVersion_ENABLED, data: req.Payload.Data})
+	return f.metadata(req.Parent, len(f.versions[req.Parent])-1), nil
+}
+
+func (f *fakeSecretManager) GetSecretVersion(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secret, i, err := f.resolve(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return f.metadata(secret, i), nil
+}
+
+func (f *fakeSecretManager) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secret, i, err := f.resolve(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	v := f.versions[secret][i]
+	if v.state != secretmanagerpb.SecretVersion_ENABLED {
+		return nil, status.Errorf(codes.FailedPrecondition, "version %v is %v", req.Name, v.state)
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    f.metadata(secret, i).Name,
+		Payload: &secretmanagerpb.SecretPayload{Data: v.data},
+	}, nil
+}
+
+func (f *fakeSecretManager) ListSecretVersions(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &secretmanagerpb.ListSecretVersionsResponse{}
+	for i := range f.versions[req.Parent] {
+		resp.Versions = append(resp.Versions, f.metadata(req.Parent, i))
+	}
+	return resp, nil
+}
+
+func (f *fakeSecretManager) setState(name string, state secretmanagerpb.SecretVersion_State) (*secretmanagerpb.SecretVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secret, i, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	f.versions[secret][i].state = state
+	return f.metadata(secret, i), nil
+}
+
+func (f *fakeSecretManager) DisableSecretVersion(ctx context.Context, req *secretmanagerpb.DisableSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	return f.setState(req.Name, secretmanagerpb.SecretVersion_DISABLED)
+}
+
+func (f *fakeSecretManager) DestroySecretVersion(ctx context.Context, req *secretmanagerpb.DestroySecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	return f.setState(req.Name, secretmanagerpb.SecretVersion_DESTROYED)
+}
+
+// states returns the state of each version of the secret.
+func (f *fakeSecretManager) states(secret string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	states := []string{}
+	for _, v := range f.versions[secret] {
+		states = append(states, v.state.String())
+	}
+	return states
+}
+
+func TestSecretCachePrune(t *testing.T) {
+	type testCase struct {
+		name     string
+		keep     int
+		prune    PruneMode
+		expected []string
+	}
+
+	cases := []testCase{
+		{
+			name:     "keep-all",
+			expected: []string{"ENABLED", "ENABLED", "ENABLED"},
+		},
+		{
+			name:     "disable",
+			keep:     1,
+			expected: []string{"DISABLED", "DISABLED", "ENABLED"},
+		},
+		{
+			name:     "destroy",
+			keep:     2,
+			prune:    PruneDestroy,
+			expected: []string{"DESTROYED", "ENABLED", "ENABLED"},
+		},
+	}
+
+	for _, c := range cases {
+		f, opts, stop := newFakeSecretManager(t)
+
+		cache, err := NewSecretCache("project", "token", "latest", opts...)
+		if err != nil {
+			t.Fatalf("Case %v: NewSecretCache returned error; %v", c.name, err)
+		}
+		cache.Log = zapr.NewLogger(zap.L())
+		cache.KeepVersions = c.keep
+		cache.Prune = c.prune
+
+		if tok, err := cache.GetToken(); err != nil || tok != nil {
+			t.Errorf("Case %v: GetToken on an empty secret returned %v, %v; want nil, nil", c.name, tok, err)
+		}
+
+		for i := 1; i <= 3; i++ {
+			if err := cache.Save(&oauth2.Token{AccessToken: fmt.Sprintf("access-%v", i)}); err != nil {
+				t.Errorf("Case %v: Save %v returned error; %v", c.name, i, err)
+			}
+		}
+
+		tok, err := cache.GetToken()
+		if err != nil {
+			t.Errorf("Case %v: GetToken returned error; %v", c.name, err)
+		} else if tok.AccessToken != "access-3" {
+			t.Errorf("Case %v: got access token %v; want access-3", c.name, tok.AccessToken)
+		}
+
+		if d := cmp.Diff(c.expected, f.states("projects/project/secrets/token")); d != "" {
+			t.Errorf("Case %v: version states mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		cache.client.Close()
+		stop()
+	}
+}
+
+func TestSecretCacheConflict(t *testing.T) {
+	f, opts, stop := newFakeSecretManager(t)
+	defer stop()
+
+	newCache := func() *SecretCache {
+		c, err := NewSecretCache("project", "token", "latest", opts...)
+		if err != nil {
+			t.Fatalf("NewSecretCache returned error; %v", err)
+		}
+		c.Log = zapr.NewLogger(zap.L())
+		return c
+	}
+
+	pod := newCache()
+	person := newCache()
+
+	if err := pod.Save(&oauth2.Token{AccessToken: "pod-1"}); err != nil {
+		t.Fatalf("Save returned error; %v", err)
+	}
+
+	if _, err := person.GetToken(); err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	// The person regenerates the token; the pod's next save must not overwrite it.
+	if err := person.Save(&oauth2.Token{AccessToken: "person-1"}); err != nil {
+		t.Fatalf("Save returned error; %v", err)
+	}
+
+	err := pod.Save(&oauth2.Token{AccessToken: "pod-2"})
+	if !IsConflict(err) {
+		t.Fatalf("Save returned %v; want a ConflictError", err)
+	}
+
+	tok, err := pod.GetToken()
+	if err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	if tok.AccessToken != "person-1" {
+		t.Errorf("Got access token %v; want person-1", tok.AccessToken)
+	}
+
+	// After re-reading the secret the pod can save again.
+	if err := pod.Save(&oauth2.Token{AccessToken: "pod-3"}); err != nil {
+		t.Errorf("Save after re-reading returned error; %v", err)
+	}
+
+	if d := cmp.Diff([]string{"ENABLED", "ENABLED", "ENABLED"}, f.states("projects/project/secrets/token")); d != "" {
+		t.Errorf("Version states mismatch (-want +got):\n%s", d)
+	}
+}
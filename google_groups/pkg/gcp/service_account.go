@@ -0,0 +1,59 @@
+package gcp
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
+)
+
+// ServiceAccountHelper gets credentials for a service account with domain-wide delegation.
+//
+// The service account impersonates Subject, a Google Workspace admin, so unattended deployments don't depend
+// on a person's OAuth grant. The service account's client ID must be granted the scopes in the admin console.
+type ServiceAccountHelper struct {
+	config *jwt.Config
+	Log    logr.Logger
+}
+
+// NewServiceAccountHelper constructs a new helper. keyFile is the JSON key of the service account; it can be a
+// GCS file or a https:// URL. subject is the email of the user to impersonate.
+func NewServiceAccountHelper(keyFile string, subject string, scopes []string) (*ServiceAccountHelper, error) {
+	if subject == "" {
+		return nil, errors.New("A subject to impersonate is required to use a service account with domain-wide delegation")
+	}
+
+	b, err := readFile(keyFile)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read service account key %v", keyFile)
+	}
+
+	config, err := google.JWTConfigFromJSON(b, scopes...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse service account key %v", keyFile)
+	}
+
+	config.Subject = subject
+
+	return &ServiceAccountHelper{
+		config: config,
+		Log:    zapr.NewLogger(zap.L()),
+	}, nil
+}
+
+// GetOAuthConfig returns nil; service accounts don't use an OAuth2 client.
+func (h *ServiceAccountHelper) GetOAuthConfig() *oauth2.Config {
+	return nil
+}
+
+// GetTokenSource returns a token source which mints tokens for the subject by signing JWTs with the service
+// account key. Tokens are refreshed automatically so they don't need to be cached.
+func (h *ServiceAccountHelper) GetTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	h.Log.Info("Using service account with domain-wide delegation", "serviceAccount", h.config.Email, "subject", h.config.Subject)
+	return h.config.TokenSource(ctx), nil
+}
@@ -0,0 +1,117 @@
+package gcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/google/go-cmp/cmp"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// writeServiceAccountKey writes a service account key which uses tokenURL to a temporary file.
+func writeServiceAccountKey(t *testing.T, tokenURL string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate key; error %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	b, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "groups-sync@acme.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(keyPEM),
+		"token_uri":      tokenURL,
+	})
+	if err != nil {
+		t.Fatalf("Could not marshal key; error %v", err)
+	}
+
+	f, err := ioutil.TempFile("", "sa-key*.json")
+	if err != nil {
+		t.Fatalf("Could not create temporary file; error %v", err)
+	}
+	f.Write(b)
+	f.Close()
+	return f.Name()
+}
+
+func TestServiceAccountHelper(t *testing.T) {
+	claims := map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			http.Error(w, "unexpected grant_type", http.StatusBadRequest)
+			return
+		}
+
+		pieces := strings.Split(r.Form.Get("assertion"), ".")
+		if len(pieces) != 3 {
+			http.Error(w, "malformed assertion", http.StatusBadRequest)
+			return
+		}
+
+		payload, err := base64.RawURLEncoding.DecodeString(pieces[1])
+		if err != nil {
+			http.Error(w, "malformed assertion", http.StatusBadRequest)
+			return
+		}
+		json.Unmarshal(payload, &claims)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "sa-token", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+
+	keyFile := writeServiceAccountKey(t, server.URL)
+	defer os.Remove(keyFile)
+
+	if _, err := NewServiceAccountHelper(keyFile, "", []string{"scope-a"}); err == nil {
+		t.Errorf("NewServiceAccountHelper should require a subject")
+	}
+
+	h, err := NewServiceAccountHelper(keyFile, "admin@kubeflow.org", []string{"scope-a", "scope-b"})
+	if err != nil {
+		t.Fatalf("NewServiceAccountHelper returned error; %v", err)
+	}
+
+	ts, err := h.GetTokenSource(context.Background())
+	if err != nil {
+		t.Fatalf("GetTokenSource returned error; %v", err)
+	}
+
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token returned error; %v", err)
+	}
+
+	if tok.AccessToken != "sa-token" {
+		t.Errorf("Got access token %v; want sa-token", tok.AccessToken)
+	}
+
+	actual := map[string]interface{}{
+		"iss":   claims["iss"],
+		"sub":   claims["sub"],
+		"scope": claims["scope"],
+	}
+
+	expected := map[string]interface{}{
+		"iss":   "groups-sync@acme.iam.gserviceaccount.com",
+		"sub":   "admin@kubeflow.org",
+		"scope": "scope-a scope-b",
+	}
+
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("JWT claims mismatch (-want +got):\n%s", d)
+	}
+}
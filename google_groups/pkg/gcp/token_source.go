@@ -0,0 +1,184 @@
+package gcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/oauth2"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sync"
+)
+
+var (
+	// credentialRevoked counts the token refreshes rejected because the credential was revoked or expired.
+	credentialRevoked = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "google_groups_credential_revoked_total",
+		Help: "Number of token refreshes that failed because the OAuth2 credential was revoked or expired.",
+	})
+
+	// tokenSaveErrors counts the refreshed tokens that couldn't be written back to the token cache.
+	tokenSaveErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "google_groups_token_cache_save_errors_total",
+		Help: "Number of refreshed OAuth2 tokens that could not be saved to the token cache.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(credentialRevoked, tokenSaveErrors)
+}
+
+// RevokedError is returned when the authorization server rejects the refresh token; i.e. the
+// credential was revoked or expired and a person needs to go through the OAuth flow again.
+type RevokedError struct {
+	Err error
+}
+
+func (e *RevokedError) Error() string {
+	return fmt.Sprintf("OAuth2 credential has been revoked or expired; obtain a new credential: %v", e.Err)
+}
+
+func (e *RevokedError) Unwrap() error {
+	return e.Err
+}
+
+// IsRevoked returns true if err was caused by a revoked credential.
+func IsRevoked(err error) bool {
+	var r *RevokedError
+	return errors.As(err, &r)
+}
+
+// isInvalidGrant returns true if err is the token endpoint rejecting the grant.
+// Ref: https://tools.ietf.org/html/rfc6749#section-5.2
+func isInvalidGrant(err error) bool {
+	var rErr *oauth2.RetrieveError
+	if !errors.As(err, &rErr) {
+		return false
+	}
+
+	body := struct {
+		Error string `json:"error"`
+	}{}
+
+	if err := json.Unmarshal(rErr.Body, &body); err != nil {
+		return false
+	}
+	return body.Error == "invalid_grant"
+}
+
+// CachingTokenSource wraps a TokenSource and saves the token to a TokenCache whenever it changes;
+// e.g. when the access token is refreshed or the refresh token is rotated.
+type CachingTokenSource struct {
+	Source oauth2.TokenSource
+	Cache  TokenCache
+	Log    logr.Logger
+
+	// NewSource creates a token source from a token; e.g. oauth2.Config.TokenSource. It is used to switch to the
+	// token in the cache when another process saved a different grant. If nil the other grant isn't used.
+	NewSource func(tok *oauth2.Token) oauth2.TokenSource
+
+	mu sync.Mutex
+	// last is the last token returned by Source; it is the token that is in the cache.
+	last *oauth2.Token
+	// superseded is true if the cache holds a newer grant that this source can't switch to. Tokens are no
+	// longer saved so the newer grant isn't overwritten.
+	superseded bool
+}
+
+// NewCachingTokenSource creates a CachingTokenSource. cached is the token currently in the cache; it may be nil.
+func NewCachingTokenSource(src oauth2.TokenSource, cache TokenCache, cached *oauth2.Token, log logr.Logger) *CachingTokenSource {
+	return &CachingTokenSource{
+		Source: src,
+		Cache:  cache,
+		Log:    log,
+		last:   cached,
+	}
+}
+
+// Token returns a token from the underlying source and saves it if it changed.
+// Failing to save the token is logged but doesn't fail the request.
+func (s *CachingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token(true)
+}
+
+// token returns a token from the underlying source. If resolve is true and saving the token conflicts with a newer
+// version in the cache the conflict is resolved; see resolveConflict.
+func (s *CachingTokenSource) token(resolve bool) (*oauth2.Token, error) {
+	tok, err := s.Source.Token()
+
+	if err != nil {
+		if isInvalidGrant(err) {
+			credentialRevoked.Inc()
+			err = &RevokedError{Err: err}
+			s.Log.Error(err, "Refresh token was rejected")
+		}
+		return nil, err
+	}
+
+	if tokenChanged(s.last, tok) && !s.superseded {
+		s.Log.Info("Token changed; updating cache", "expiry", tok.Expiry, "refreshTokenRotated", s.last != nil && s.last.RefreshToken != tok.RefreshToken)
+		err := s.Cache.Save(tok)
+
+		if IsConflict(err) && resolve {
+			return s.resolveConflict(tok, err)
+		}
+
+		if err != nil {
+			// Don't retry on every request; the token is saved again the next time it changes.
+			tokenSaveErrors.Inc()
+			s.Log.Error(err, "Could not save refreshed token")
+		}
+		s.last = tok
+	}
+
+	return tok, nil
+}
+
+// resolveConflict handles a save that failed because someone else updated the cache since it was read. The cache
+// is re-read so later saves are compared to the newer version. If the cache holds the same grant, e.g. another
+// replica refreshed the access token, tok is saved. Otherwise, e.g. after auth login, the cached grant is newer so
+// the source switches to it, if NewSource is set, and returns a token for it.
+func (s *CachingTokenSource) resolveConflict(tok *oauth2.Token, conflict error) (*oauth2.Token, error) {
+	cached, err := s.Cache.GetToken()
+
+	if err != nil {
+		tokenSaveErrors.Inc()
+		s.Log.Error(err, "Could not re-read the token cache after a conflicting save", "conflict", conflict.Error())
+		s.last = tok
+		return tok, nil
+	}
+
+	if cached == nil || cached.RefreshToken == tok.RefreshToken {
+		s.Log.Info("Token cache was updated by someone else with the same grant; saving the newer token", "reason", conflict.Error())
+		if err := s.Cache.Save(tok); err != nil {
+			tokenSaveErrors.Inc()
+			s.Log.Error(err, "Could not save refreshed token")
+		}
+		s.last = tok
+		return tok, nil
+	}
+
+	if s.NewSource == nil {
+		// Don't overwrite the newer grant; this process keeps using its own token without saving it.
+		s.Log.Info("Token cache holds a different grant; not overwriting it", "reason", conflict.Error())
+		s.superseded = true
+		s.last = tok
+		return tok, nil
+	}
+
+	s.Log.Info("Token cache holds a different grant; switching to it", "reason", conflict.Error())
+	s.Source = s.NewSource(cached)
+	s.last = cached
+	return s.token(false)
+}
+
+// tokenChanged returns true if next differs from prev.
+func tokenChanged(prev *oauth2.Token, next *oauth2.Token) bool {
+	if prev == nil {
+		return true
+	}
+	return prev.AccessToken != next.AccessToken || prev.RefreshToken != next.RefreshToken || !prev.Expiry.Equal(next.Expiry)
+}
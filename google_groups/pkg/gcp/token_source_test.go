@@ -0,0 +1,280 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/zapr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"testing"
+	"time"
+)
+
+// memoryTokenCache is a TokenCache that records the tokens saved to it.
+type memoryTokenCache struct {
+	token   *oauth2.Token
+	saved   []string
+	saveErr error
+}
+
+func (c *memoryTokenCache) GetToken() (*oauth2.Token, error) {
+	return c.token, nil
+}
+
+func (c *memoryTokenCache) Save(token *oauth2.Token) error {
+	if c.saveErr != nil {
+		return c.saveErr
+	}
+	c.token = token
+	c.saved = append(c.saved, token.AccessToken+"/"+token.RefreshToken)
+	return nil
+}
+
+func (c *memoryTokenCache) Clear() error {
+	c.token = nil
+	return nil
+}
+
+func TestCachingTokenSource(t *testing.T) {
+	type testCase struct {
+		name         string
+		expiry       time.Duration
+		rotate       bool
+		refreshError string
+		saveErr      error
+		// expected is the access and refresh token returned by the token source.
+		expected     string
+		expectedSave []string
+		revoked      bool
+		saveErrors   float64
+	}
+
+	cases := []testCase{
+		{
+			name:         "valid-token",
+			expiry:       time.Hour,
+			expected:     "cached/refresh-1",
+			expectedSave: nil,
+		},
+		{
+			name:         "refresh",
+			expiry:       -time.Hour,
+			expected:     "refreshed-1/refresh-1",
+			expectedSave: []string{"refreshed-1/refresh-1"},
+		},
+		{
+			name:         "rotated-refresh-token",
+			expiry:       -time.Hour,
+			rotate:       true,
+			expected:     "refreshed-1/refresh-2",
+			expectedSave: []string{"refreshed-1/refresh-2"},
+		},
+		{
+			name:         "revoked",
+			expiry:       -time.Hour,
+			refreshError: "invalid_grant",
+			revoked:      true,
+		},
+		{
+			name:         "server-unavailable",
+			expiry:       -time.Hour,
+			refreshError: "temporarily_unavailable",
+		},
+		{
+			name:       "save-fails",
+			expiry:     -time.Hour,
+			saveErr:    fmt.Errorf("secret manager is unavailable"),
+			expected:   "refreshed-1/refresh-1",
+			saveErrors: 1,
+		},
+	}
+
+	for _, c := range cases {
+		f := newFakeOAuthServer()
+		f.rotate = c.rotate
+		f.refreshError = c.refreshError
+
+		cache := &memoryTokenCache{
+			token: &oauth2.Token{
+				AccessToken:  "cached",
+				RefreshToken: "refresh-1",
+				TokenType:    "Bearer",
+				Expiry:       time.Now().Add(c.expiry),
+			},
+			saveErr: c.saveErr,
+		}
+
+		h := &CachedCredentialHelper{
+			CredentialHelper: &WebFlowHelper{config: f.config()},
+			TokenCache:       cache,
+			Log:              zapr.NewLogger(zap.L()),
+		}
+
+		revokedBefore := testutil.ToFloat64(credentialRevoked)
+		saveErrorsBefore := testutil.ToFloat64(tokenSaveErrors)
+
+		ts, err := h.GetTokenSource(context.Background())
+		if err != nil {
+			t.Errorf("Case %v: GetTokenSource returned error; %v", c.name, err)
+			f.server.Close()
+			continue
+		}
+
+		// Get the token twice; an unchanged token shouldn't be saved again.
+		for i := 0; i < 2; i++ {
+			tok, err := ts.Token()
+
+			if c.refreshError != "" {
+				if err == nil {
+					t.Errorf("Case %v: Token should have returned an error", c.name)
+				} else if IsRevoked(err) != c.revoked {
+					t.Errorf("Case %v: IsRevoked(%v) = %v; want %v", c.name, err, IsRevoked(err), c.revoked)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("Case %v: Token returned error; %v", c.name, err)
+				continue
+			}
+
+			if actual := tok.AccessToken + "/" + tok.RefreshToken; actual != c.expected {
+				t.Errorf("Case %v: got token %v; want %v", c.name, actual, c.expected)
+			}
+		}
+
+		f.server.Close()
+
+		if d := cmp.Diff(c.expectedSave, cache.saved); d != "" {
+			t.Errorf("Case %v: saved tokens mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		wantRevoked := 0.0
+		if c.revoked {
+			wantRevoked = 2
+		}
+
+		if actual := testutil.ToFloat64(credentialRevoked) - revokedBefore; actual != wantRevoked {
+			t.Errorf("Case %v: credential revoked metric increased by %v; want %v", c.name, actual, wantRevoked)
+		}
+
+		if actual := testutil.ToFloat64(tokenSaveErrors) - saveErrorsBefore; actual != c.saveErrors {
+			t.Errorf("Case %v: token save errors metric increased by %v; want %v", c.name, actual, c.saveErrors)
+		}
+	}
+}
+
+// sequenceSource returns the tokens in order; the last one is repeated.
+type sequenceSource struct {
+	tokens []*oauth2.Token
+}
+
+func (s *sequenceSource) Token() (*oauth2.Token, error) {
+	tok := s.tokens[0]
+	if len(s.tokens) > 1 {
+		s.tokens = s.tokens[1:]
+	}
+	return tok, nil
+}
+
+func TestCachingTokenSourceConflict(t *testing.T) {
+	_, opts, stop := newFakeSecretManager(t)
+	defer stop()
+
+	newCache := func() *SecretCache {
+		c, err := NewSecretCache("project", "token", "latest", opts...)
+		if err != nil {
+			t.Fatalf("NewSecretCache returned error; %v", err)
+		}
+		c.Log = zapr.NewLogger(zap.L())
+		return c
+	}
+
+	token := func(access string, refresh string) *oauth2.Token {
+		return &oauth2.Token{AccessToken: access, RefreshToken: refresh, Expiry: time.Now().Add(time.Hour)}
+	}
+
+	// cached returns the token in the secret.
+	cached := func() string {
+		tok, err := newCache().GetToken()
+		if err != nil {
+			t.Fatalf("GetToken returned error; %v", err)
+		}
+		return tok.AccessToken + "/" + tok.RefreshToken
+	}
+
+	pod := newCache()
+	other := newCache()
+
+	if err := pod.Save(token("pod-1", "refresh-1")); err != nil {
+		t.Fatalf("Save returned error; %v", err)
+	}
+
+	if _, err := other.GetToken(); err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	// Another replica refreshes the same grant so the pod's next save conflicts.
+	if err := other.Save(token("other-1", "refresh-1")); err != nil {
+		t.Fatalf("Save returned error; %v", err)
+	}
+
+	switched := []string{}
+	ts := NewCachingTokenSource(&sequenceSource{tokens: []*oauth2.Token{token("pod-2", "refresh-1"), token("pod-3", "refresh-1"), token("pod-4", "refresh-1")}}, pod, token("pod-1", "refresh-1"), zapr.NewLogger(zap.L()))
+	ts.NewSource = func(tok *oauth2.Token) oauth2.TokenSource {
+		switched = append(switched, tok.AccessToken)
+		return &sequenceSource{tokens: []*oauth2.Token{tok, token("login-2", tok.RefreshToken)}}
+	}
+
+	saveErrorsBefore := testutil.ToFloat64(tokenSaveErrors)
+
+	// The conflict is resolved by re-reading the secret and both later saves succeed.
+	for _, want := range []string{"pod-2/refresh-1", "pod-3/refresh-1"} {
+		tok, err := ts.Token()
+		if err != nil {
+			t.Fatalf("Token returned error; %v", err)
+		}
+
+		if actual := tok.AccessToken + "/" + tok.RefreshToken; actual != want {
+			t.Errorf("Got token %v; want %v", actual, want)
+		}
+
+		if actual := cached(); actual != want {
+			t.Errorf("Cached token is %v; want %v", actual, want)
+		}
+	}
+
+	// Someone logs in again. When the pod next refreshes it switches to the new grant instead of overwriting it.
+	if _, err := other.GetToken(); err != nil {
+		t.Fatalf("GetToken returned error; %v", err)
+	}
+
+	if err := other.Save(token("login-1", "refresh-2")); err != nil {
+		t.Fatalf("Save returned error; %v", err)
+	}
+
+	for _, want := range []string{"login-1/refresh-2", "login-2/refresh-2"} {
+		tok, err := ts.Token()
+		if err != nil {
+			t.Fatalf("Token returned error; %v", err)
+		}
+
+		if actual := tok.AccessToken + "/" + tok.RefreshToken; actual != want {
+			t.Errorf("Got token %v; want %v", actual, want)
+		}
+
+		if actual := cached(); actual != want {
+			t.Errorf("Cached token is %v; want %v", actual, want)
+		}
+	}
+
+	if d := cmp.Diff([]string{"login-1"}, switched); d != "" {
+		t.Errorf("Switched grants mismatch (-want +got):\n%s", d)
+	}
+
+	if actual := testutil.ToFloat64(tokenSaveErrors) - saveErrorsBefore; actual != 0 {
+		t.Errorf("Token save errors metric increased by %v; want 0", actual)
+	}
+}
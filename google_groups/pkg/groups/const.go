@@ -1,5 +1,10 @@
 package groups
 
+import (
+	admin "google.golang.org/api/admin/directory/v1"
+	settingsSdk "google.golang.org/api/groupssettings/v1"
+)
+
 type GroupRole string
 
 const (
@@ -7,3 +12,20 @@ const (
 	OwnerRole GroupRole = "OWNER"
 	MemberRole GroupRole = "MEMBER"
 )
+
+var (
+	// SyncScopes are the OAuth2 scopes GroupSyncer needs to create groups and update their members and settings.
+	SyncScopes = []string{
+		admin.AdminDirectoryGroupScope,
+		admin.AdminDirectoryGroupMemberScope,
+		settingsSdk.AppsGroupsSettingsScope,
+	}
+
+	// ImportScopes are the OAuth2 scopes GroupImporter needs to read groups, their members and settings.
+	// The groups settings API has no read-only scope.
+	ImportScopes = []string{
+		admin.AdminDirectoryGroupReadonlyScope,
+		admin.AdminDirectoryGroupMemberReadonlyScope,
+		settingsSdk.AppsGroupsSettingsScope,
+	}
+)
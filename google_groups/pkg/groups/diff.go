@@ -0,0 +1,101 @@
+package groups
+
+import (
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"sort"
+	"time"
+)
+
+// GroupDiff describes how the live state of a group differs from its spec.
+type GroupDiff struct {
+	Group string `json:"group"`
+	// MissingMembers are in the spec but not in the live group.
+	MissingMembers []v1alpha1.Member `json:"missingMembers,omitempty"`
+	// ExtraMembers are in the live group but not in the spec.
+	ExtraMembers []v1alpha1.Member `json:"extraMembers,omitempty"`
+	// RoleChanges are members whose role differs.
+	RoleChanges []RoleChange `json:"roleChanges,omitempty"`
+	// Settings are the settings that differ.
+	Settings []SettingDiff `json:"settings,omitempty"`
+}
+
+// RoleChange is a member whose role in the live group differs from the spec.
+type RoleChange struct {
+	Email string `json:"email"`
+	Spec  string `json:"spec"`
+	Live  string `json:"live"`
+}
+
+// SettingDiff is a setting whose live value differs from the spec.
+type SettingDiff struct {
+	Name string `json:"name"`
+	Spec string `json:"spec"`
+	Live string `json:"live"`
+}
+
+// DiffGroup compares the spec of a group to its live state e.g. as returned by GroupImporter. Members are
+// compared the same way the syncer does; expired members in the spec are treated as absent. Only the settings that are set in the spec are compared.
+func DiffGroup(spec *v1alpha1.GoogleGroup, live *v1alpha1.GoogleGroup, now time.Time) *GroupDiff {
+	diff := &GroupDiff{
+		Group:          spec.Spec.Email,
+		MissingMembers: []v1alpha1.Member{},
+		ExtraMembers:   []v1alpha1.Member{},
+		RoleChanges:    []RoleChange{},
+		Settings:       []SettingDiff{},
+	}
+
+	liveMembers := map[string]v1alpha1.Member{}
+	for _, m := range live.Spec.Members {
+		liveMembers[m.Email] = m
+	}
+
+	members := diffMembers(live.Spec.Members, activeMembers(spec.Spec.Members, now))
+	diff.MissingMembers = members.ToAdd
+	diff.RoleChanges = members.RoleChanges
+
+	for _, e := range members.ToRemove {
+		diff.ExtraMembers = append(diff.ExtraMembers, liveMembers[e])
+	}
+
+	sort.Slice(diff.ExtraMembers, func(i, j int) bool {
+		return diff.ExtraMembers[i].Email < diff.ExtraMembers[j].Email
+	})
+
+	settings := []SettingDiff{
+		{Name: "description", Spec: spec.Spec.Description, Live: live.Spec.Description},
+		{Name: "whoCanJoin", Spec: spec.Spec.WhoCanJoin, Live: live.Spec.WhoCanJoin},
+		{Name: "whoCanPostMessage", Spec: spec.Spec.WhoCanPostMessage, Live: live.Spec.WhoCanPostMessage},
+		{Name: "allowExternalMembers", Spec: spec.Spec.AllowExternalMembers, Live: live.Spec.AllowExternalMembers},
+	}
+
+	for _, s := range settings {
+		if s.Spec != "" && s.Spec != s.Live {
+			diff.Settings = append(diff.Settings, s)
+		}
+	}
+	return diff
+}
+
+// IsEmpty returns true if the live state matches the spec.
+func (d *GroupDiff) IsEmpty() bool {
+	return len(d.MissingMembers) == 0 && len(d.ExtraMembers) == 0 && len(d.RoleChanges) == 0 && len(d.Settings) == 0
+}
+
+// Lines describes each difference on a separate line.
+func (d *GroupDiff) Lines() []string {
+	lines := []string{}
+	for _, m := range d.MissingMembers {
+		lines = append(lines, fmt.Sprintf("member %v (%v) is in the spec but not in Google Groups", m.Email, m.Role))
+	}
+	for _, m := range d.ExtraMembers {
+		lines = append(lines, fmt.Sprintf("member %v (%v) is in Google Groups but not in the spec", m.Email, m.Role))
+	}
+	for _, r := range d.RoleChanges {
+		lines = append(lines, fmt.Sprintf("member %v has role %v in the spec but %v in Google Groups", r.Email, r.Spec, r.Live))
+	}
+	for _, s := range d.Settings {
+		lines = append(lines, fmt.Sprintf("setting %v is %q in the spec but %q in Google Groups", s.Name, s.Spec, s.Live))
+	}
+	return lines
+}
@@ -0,0 +1,167 @@
+package groups
+
+import (
+	"github.com/go-logr/zapr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestDiffGroup(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	spec := &v1alpha1.GoogleGroup{
+		Spec: v1alpha1.GoogleGroupSpec{
+			Email:             "ci-team@kubeflow.org",
+			Description:       "CI team",
+			WhoCanPostMessage: "ALL_MEMBERS_CAN_POST",
+			Members: []v1alpha1.Member{
+				{Email: "owner@acme.com", Role: "OWNER"},
+				{Email: "Same@acme.com", Role: "MEMBER"},
+				{Email: "missing@acme.com", Role: "MEMBER"},
+				{Email: "expired@acme.com", Role: "MEMBER", Expires: "2020-10-01"},
+			},
+		},
+	}
+
+	live := &v1alpha1.GoogleGroup{
+		Spec: v1alpha1.GoogleGroupSpec{
+			Email:             "ci-team@kubeflow.org",
+			Description:       "CI team",
+			WhoCanJoin:        "CAN_REQUEST_TO_JOIN",
+			WhoCanPostMessage: "ANYONE_CAN_POST",
+			Members: []v1alpha1.Member{
+				{Email: "owner@acme.com", Role: "MEMBER"},
+				{Email: "same@acme.com", Role: "MEMBER"},
+				{Email: "expired@acme.com", Role: "MEMBER"},
+				{Email: "extra@acme.com", Role: "MANAGER"},
+			},
+		},
+	}
+
+	expected := &GroupDiff{
+		Group: "ci-team@kubeflow.org",
+		MissingMembers: []v1alpha1.Member{
+			{Email: "missing@acme.com", Role: "MEMBER"},
+		},
+		ExtraMembers: []v1alpha1.Member{
+			{Email: "expired@acme.com", Role: "MEMBER"},
+			{Email: "extra@acme.com", Role: "MANAGER"},
+		},
+		RoleChanges: []RoleChange{
+			{Email: "owner@acme.com", Spec: "OWNER", Live: "MEMBER"},
+		},
+		Settings: []SettingDiff{
+			{Name: "whoCanPostMessage", Spec: "ALL_MEMBERS_CAN_POST", Live: "ANYONE_CAN_POST"},
+		},
+	}
+
+	actual := DiffGroup(spec, live, now)
+
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("DiffGroup() mismatch (-want +got):\n%s", d)
+	}
+
+	if actual.IsEmpty() {
+		t.Errorf("IsEmpty() returned true; want false")
+	}
+
+	if !DiffGroup(live, live, now).IsEmpty() {
+		t.Errorf("IsEmpty() returned false for identical groups; want true")
+	}
+}
+
+func TestImportGroupsFilter(t *testing.T) {
+	f := newFakeDirectory()
+	f.addGroup("ci-team@kubeflow.org", map[string]string{"a@acme.com": "OWNER"})
+	f.addGroup("release-team@kubeflow.org", map[string]string{"b@acme.com": "MEMBER"})
+
+	client, shutdown := f.client()
+	defer shutdown()
+
+	importer := &GroupImporter{
+		Client: client,
+		Log:    zapr.NewLogger(zap.L()),
+		Groups: []string{"Release-Team@kubeflow.org"},
+	}
+
+	actual, err := importer.Import("kubeflow.org")
+	if err != nil {
+		t.Fatalf("Import returned error; %v", err)
+	}
+
+	emails := []string{}
+	for _, g := range actual {
+		emails = append(emails, g.Spec.Email)
+	}
+
+	if d := cmp.Diff([]string{"release-team@kubeflow.org"}, emails); d != "" {
+		t.Errorf("Import() groups mismatch (-want +got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]v1alpha1.Member{{Email: "b@acme.com", Role: "MEMBER"}}, actual[0].Spec.Members); d != "" {
+		t.Errorf("Import() members mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestImportGroupsPartialFailure(t *testing.T) {
+	f := newFakeDirectory()
+	f.addGroup("ci-team@kubeflow.org", map[string]string{"a@acme.com": "OWNER"})
+	f.addGroup("release-team@kubeflow.org", map[string]string{"b@acme.com": "MEMBER"})
+	f.failSettings["ci-team@kubeflow.org"] = true
+
+	client, shutdown := f.client()
+	defer shutdown()
+
+	importer := &GroupImporter{
+		Client: client,
+		Log:    zapr.NewLogger(zap.L()),
+	}
+
+	actual, err := importer.Import("kubeflow.org")
+
+	importErr, ok := err.(*ImportError)
+	if !ok {
+		t.Fatalf("Import returned error %v; want an *ImportError", err)
+	}
+
+	if _, ok := importErr.Failed["ci-team@kubeflow.org"]; !ok || len(importErr.Failed) != 1 {
+		t.Errorf("ImportError.Failed = %v; want only ci-team@kubeflow.org", importErr.Failed)
+	}
+
+	// The groups that could be read are still imported.
+	if len(actual) != 1 || actual[0].Spec.Email != "release-team@kubeflow.org" {
+		t.Errorf("Import() returned %v; want only release-team@kubeflow.org", actual)
+	}
+}
+
+func TestImportGroupsMissing(t *testing.T) {
+	f := newFakeDirectory()
+	f.addGroup("release-team@kubeflow.org", map[string]string{"b@acme.com": "MEMBER"})
+
+	client, shutdown := f.client()
+	defer shutdown()
+
+	importer := &GroupImporter{
+		Client: client,
+		Log:    zapr.NewLogger(zap.L()),
+		Groups: []string{"release-team@kubeflow.org", "relase-team@kubeflow.org"},
+	}
+
+	actual, err := importer.Import("kubeflow.org")
+
+	importErr, ok := err.(*ImportError)
+	if !ok {
+		t.Fatalf("Import returned error %v; want an *ImportError", err)
+	}
+
+	if _, ok := importErr.Failed["relase-team@kubeflow.org"]; !ok || len(importErr.Failed) != 1 {
+		t.Errorf("ImportError.Failed = %v; want only relase-team@kubeflow.org", importErr.Failed)
+	}
+
+	if len(actual) != 1 || actual[0].Spec.Email != "release-team@kubeflow.org" {
+		t.Errorf("Import() returned %v; want only release-team@kubeflow.org", actual)
+	}
+}
@@ -0,0 +1,205 @@
+package groups
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/internal/apitest"
+	admin "google.golang.org/api/admin/directory/v1"
+	settingsSdk "google.golang.org/api/groupssettings/v1"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fakeDirectory is an in memory implementation of the subset of the Directory and Groups Settings APIs
+// used by the syncer and importer.
+type fakeDirectory struct {
+	mu       sync.Mutex
+	groups   map[string]*admin.Group
+	members  map[string]map[string]*admin.Member
+	settings map[string]*settingsSdk.Groups
+	nextID   int
+
+	// failMembers is a set of member emails for which inserts and deletes fail.
+	failMembers map[string]bool
+	// failSettings is a set of group emails for which getting the settings fails.
+	failSettings map[string]bool
+}
+
+func newFakeDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		groups:       map[string]*admin.Group{},
+		members:      map[string]map[string]*admin.Member{},
+		settings:     map[string]*settingsSdk.Groups{},
+		failMembers:  map[string]bool{},
+		failSettings: map[string]bool{},
+	}
+}
+
+// addGroup adds a group with the given members. members maps email to role.
+func (f *fakeDirectory) addGroup(email string, members map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.insertGroup(&admin.Group{Email: email, Name: strings.Split(email, "@")[0]})
+	for e, r := range members {
+		f.members[email][e] = &admin.Member{Email: e, Role: r}
+	}
+}
+
+// memberRoles returns a map from member email to role for the group.
+func (f *fakeDirectory) memberRoles(group string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := map[string]string{}
+	for e, m := range f.members[group] {
+		r[e] = m.Role
+	}
+	return r
+}
+
+func (f *fakeDirectory) insertGroup(g *admin.Group) {
+	f.nextID++
+	g.Id = fmt.Sprintf("id-%v", f.nextID)
+	f.groups[g.Email] = g
+	f.members[g.Email] = map[string]*admin.Member{}
+	f.settings[g.Email] = &settingsSdk.Groups{Email: g.Email}
+}
+
+// client returns an http.Client which sends all requests to the fake and a function to shut it down.
+func (f *fakeDirectory) client() (*http.Client, func()) {
+	return apitest.NewClient(f)
+}
+
+func (f *fakeDirectory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const directoryPrefix = "/admin/directory/v1/groups"
+	const settingsPrefix = "/groups/v1/groups/"
+
+	if strings.HasPrefix(r.URL.Path, settingsPrefix) {
+		f.serveSettings(w, r, strings.TrimPrefix(r.URL.Path, settingsPrefix))
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, directoryPrefix) {
+		apitest.WriteError(w, http.StatusNotFound, "")
+		return
+	}
+
+	pieces := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, directoryPrefix), "/"), "/")
+
+	switch {
+	case pieces[0] == "" && r.Method == http.MethodGet:
+		result := &admin.Groups{}
+		for _, g := range f.groups {
+			if strings.HasSuffix(g.Email, "@"+r.URL.Query().Get("domain")) {
+				result.Groups = append(result.Groups, g)
+			}
+		}
+		sort.Slice(result.Groups, func(i, j int) bool {
+			return result.Groups[i].Email < result.Groups[j].Email
+		})
+		apitest.WriteJSON(w, result)
+	case pieces[0] == "" && r.Method == http.MethodPost:
+		g := &admin.Group{}
+		json.NewDecoder(r.Body).Decode(g)
+		f.insertGroup(g)
+		apitest.WriteJSON(w, g)
+	case len(pieces) == 1 && r.Method == http.MethodGet:
+		g, ok := f.groups[pieces[0]]
+		if !ok {
+			apitest.WriteError(w, http.StatusNotFound, "")
+			return
+		}
+		apitest.WriteJSON(w, g)
+	case len(pieces) >= 2 && pieces[1] == "members":
+		f.serveMembers(w, r, pieces[0], pieces[2:])
+	default:
+		apitest.WriteError(w, http.StatusNotFound, "")
+	}
+}
+
+func (f *fakeDirectory) serveMembers(w http.ResponseWriter, r *http.Request, group string, rest []string) {
+	members, ok := f.members[group]
+	if !ok {
+		apitest.WriteError(w, http.StatusNotFound, "")
+		return
+	}
+
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		result := &admin.Members{}
+		for _, m := range members {
+			result.Members = append(result.Members, m)
+		}
+		sort.Slice(result.Members, func(i, j int) bool {
+			return result.Members[i].Email < result.Members[j].Email
+		})
+		apitest.WriteJSON(w, result)
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		m := &admin.Member{}
+		json.NewDecoder(r.Body).Decode(m)
+		if f.failMembers[m.Email] {
+			apitest.WriteError(w, http.StatusBadRequest, "")
+			return
+		}
+		if _, ok := members[m.Email]; ok {
+			apitest.WriteError(w, http.StatusConflict, "")
+			return
+		}
+		members[m.Email] = m
+		apitest.WriteJSON(w, m)
+	case len(rest) == 1 && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		m, ok := members[rest[0]]
+		if !ok {
+			apitest.WriteError(w, http.StatusNotFound, "")
+			return
+		}
+		update := &admin.Member{}
+		json.NewDecoder(r.Body).Decode(update)
+		if update.Role != "" {
+			m.Role = update.Role
+		}
+		apitest.WriteJSON(w, m)
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		if f.failMembers[rest[0]] {
+			apitest.WriteError(w, http.StatusBadRequest, "")
+			return
+		}
+		if _, ok := members[rest[0]]; !ok {
+			apitest.WriteError(w, http.StatusNotFound, "")
+			return
+		}
+		delete(members, rest[0])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		apitest.WriteError(w, http.StatusNotFound, "")
+	}
+}
+
+func (f *fakeDirectory) serveSettings(w http.ResponseWriter, r *http.Request, group string) {
+	if f.failSettings[group] {
+		apitest.WriteError(w, http.StatusForbidden, "PERMISSION_DENIED")
+		return
+	}
+
+	s, ok := f.settings[group]
+	if !ok {
+		apitest.WriteError(w, http.StatusNotFound, "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		apitest.WriteJSON(w, s)
+	case http.MethodPut, http.MethodPatch:
+		update := &settingsSdk.Groups{}
+		json.NewDecoder(r.Body).Decode(update)
+		f.settings[group] = update
+		apitest.WriteJSON(w, update)
+	default:
+		apitest.WriteError(w, http.StatusNotFound, "")
+	}
+}
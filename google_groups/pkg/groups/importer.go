@@ -2,28 +2,51 @@ package groups
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/gcp"
 	admin "google.golang.org/api/admin/directory/v1"
 	settingsSdk "google.golang.org/api/groupssettings/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net/http"
+	"sort"
+	"strings"
 )
 
 // GroupImporter is used to import existing groups to YAML files.
 type GroupImporter struct {
 	Client *http.Client
 	Log logr.Logger
+
+	// Groups restricts the import to the groups with these emails. If empty all groups are imported.
+	Groups []string
+}
+
+// ImportError is returned by Import when some groups couldn't be imported; the other groups are still returned.
+type ImportError struct {
+	// Failed maps the email of each group that couldn't be imported to the error. Groups requested with
+	// GroupImporter.Groups that don't exist are included.
+	Failed map[string]error
 }
 
-// Import group definitions
+func (e *ImportError) Error() string {
+	emails := []string{}
+	for g := range e.Failed {
+		emails = append(emails, g)
+	}
+	sort.Strings(emails)
+	return fmt.Sprintf("failed to import groups: %v", strings.Join(emails, ", "))
+}
+
+// Import group definitions. If reading the settings or members of some groups fails the other groups are
+// still imported and an *ImportError listing the failed groups is returned.
 func (s *GroupImporter) Import(org string) ([]*v1alpha1.GoogleGroup, error) {
 	log := s.Log
 	results := []*v1alpha1.GoogleGroup{}
 
-	// TODO(jlewi): Using admin.NewService was giving me auth problems. I think it might be an OAuthScope
-	// issue because the credential didn't have all the scopes but admin.NewService appears to request all scopes
-	// so the client was requesting a token for scopes it wasn't authorized for.
+	// Use admin.New rather than admin.NewService; NewService requests all scopes so the client would request a
+	// token for scopes it isn't authorized for. The client's token needs ImportScopes.
 	service, err := admin.New(s.Client)
 
 	if err != nil {
@@ -48,7 +71,19 @@ func (s *GroupImporter) Import(org string) ([]*v1alpha1.GoogleGroup, error) {
 		return results, err
 	}
 
+	failed := map[string]error{}
+
+	// A mistyped group would otherwise silently import nothing.
+	for _, email := range s.missingGroups(groups) {
+		log.Info("Group to import doesn't exist", "group", email, "domain", org)
+		failed[email] = fmt.Errorf("No group %v in domain %v", email, org)
+	}
+
 	for _, g := range groups {
+		if !s.shouldImport(g.Email) {
+			continue
+		}
+
 		newGroup  := &v1alpha1.GoogleGroup{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: g.Email,
@@ -66,6 +101,11 @@ func (s *GroupImporter) Import(org string) ([]*v1alpha1.GoogleGroup, error) {
 
 		if err != nil {
 			log.Error(err, "Error getting group settings", "group", g.Email)
+			// Every remaining group would fail the same way so stop and surface the revoked credential.
+			if gcp.IsRevoked(err) {
+				return results, err
+			}
+			failed[g.Email] = err
 			continue
 		}
 
@@ -88,10 +128,48 @@ func (s *GroupImporter) Import(org string) ([]*v1alpha1.GoogleGroup, error) {
 
 		if err != nil {
 			log.Error(err, "Error getting group members", "group", g.Email)
+			if gcp.IsRevoked(err) {
+				return results, err
+			}
+			failed[g.Email] = err
 			continue
 		}
 
 		results = append(results, newGroup)
 	}
+
+	if len(failed) > 0 {
+		return results, &ImportError{Failed: failed}
+	}
 	return results, nil
 }
+
+// shouldImport returns true if the group matches the Groups filter.
+func (s *GroupImporter) shouldImport(email string) bool {
+	if len(s.Groups) == 0 {
+		return true
+	}
+
+	for _, g := range s.Groups {
+		if strings.EqualFold(g, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingGroups returns the groups in the Groups filter that aren't among the live groups.
+func (s *GroupImporter) missingGroups(live []*admin.Group) []string {
+	emails := map[string]bool{}
+	for _, g := range live {
+		emails[strings.ToLower(g.Email)] = true
+	}
+
+	missing := []string{}
+	for _, g := range s.Groups {
+		if !emails[strings.ToLower(g)] {
+			missing = append(missing, g)
+		}
+	}
+	return missing
+}
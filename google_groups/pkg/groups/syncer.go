@@ -5,23 +5,33 @@ import (
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/gcp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/notify"
 	admin "google.golang.org/api/admin/directory/v1"
 	"google.golang.org/api/googleapi"
 	settingsSdk "google.golang.org/api/groupssettings/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type GroupSyncer struct {
 	Client *http.Client
 	Log logr.Logger
+
+	// Notifier is told about the changes made to each group. It may be nil.
+	Notifier notify.Notifier
+
+	// now is used to get the current time; it is overridden in tests.
+	now func() time.Time
 }
 
+// Sync syncs the groups and records the observed state of each group in its Status.
 func (s *GroupSyncer) Sync(groupSpecs []*v1alpha1.GoogleGroup) error {
 	log := s.Log
-	// TODO(jlewi): Using admin.NewService was giving me auth problems. I think it might be an OAuthScope
-	// issue because the credential didn't have all the scopes but admin.NewService appears to request all scopes
-	// so the client was requesting a token for scopes it wasn't authorized for.
+	// Use admin.New rather than admin.NewService; NewService requests all scopes so the client would request a
+	// token for scopes it isn't authorized for. The client's token needs SyncScopes.
 	service, err := admin.New(s.Client)
 
 	if err != nil {
@@ -34,29 +44,119 @@ func (s *GroupSyncer) Sync(groupSpecs []*v1alpha1.GoogleGroup) error {
 		return err
 	}
 
+	failed := []string{}
+	// specFailed are the failed groups whose errors are all caused by their specs.
+	specFailed := 0
 	for _, gDef := range groupSpecs {
 		if gDef.Spec.AutoSync != nil && !*gDef.Spec.AutoSync {
 			log.Info("AutoSync not enabled for group", "group", gDef.Spec.Email)
 			continue
 		}
 
+		if gDef.Status == nil {
+			gDef.Status = &v1alpha1.GoogleGroupStatus{}
+		}
+
+		changes := &notify.ChangeSet{
+			Group:  gDef,
+			Events: []notify.Event{},
+		}
+
 		// Ensure each group exists and settings are up to date
-		s.syncGroupSettings(gDef, service, settingsService)
+		err := classify(s.syncGroupSettings(gDef, service, settingsService, changes))
 
 		// Sync members
-		s.syncMembers(gDef, service)
+		if err == nil {
+			err = s.syncMembers(gDef, service, changes)
+		}
+
+		s.recordResult(gDef, err)
+		s.notify(changes)
+
+		if err != nil {
+			// Every remaining group would fail the same way so stop and surface the revoked credential.
+			if gcp.IsRevoked(err) {
+				return err
+			}
+			failed = append(failed, gDef.Spec.Email)
+			if IsPermanent(err) {
+				specFailed++
+			}
+		}
+	}
+
+	if len(failed) > 0 && specFailed == len(failed) {
+		return &SpecError{Groups: failed}
 	}
 
-	// Sync members
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to sync groups: %v", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
+// SpecError is returned by Sync when the only groups that failed to sync failed because of their specs; e.g. a
+// member has an invalid role or the Directory API rejects a member. Syncing again fails the same way until the
+// specs are fixed.
+type SpecError struct {
+	// Groups are the emails of the groups that failed to sync.
+	Groups []string
+}
+
+func (e *SpecError) Error() string {
+	return fmt.Sprintf("failed to sync groups because of errors in their specs: %v", strings.Join(e.Groups, ", "))
+}
+
+// IsPermanent returns true if the error is caused by the group specs so retrying won't fix it.
+func IsPermanent(err error) bool {
+	switch err.(type) {
+	case *SpecError, *permanentError:
+		return true
+	}
+	return false
+}
+
+// permanentError wraps an error that retrying won't fix.
+type permanentError struct {
+	error
+}
+
+func (e *permanentError) Cause() error {
+	return e.error
+}
+
+// classify marks the errors caused by a group spec as permanent. These are invalid requests, e.g. a malformed
+// email or a setting the domain doesn't allow, and members that don't exist or can't be added.
+func classify(err error) error {
+	if err == nil || IsPermanent(err) {
+		return err
+	}
+
+	if gErr, ok := err.(*googleapi.Error); ok {
+		switch gErr.Code {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed:
+			return &permanentError{err}
+		}
+	}
+	return err
+}
+
+// mergeErrors returns the error to report for a group that failed with both errors. Transient errors are
+// preferred so the group is retried.
+func mergeErrors(prev error, err error) error {
+	err = classify(err)
+	if prev == nil || IsPermanent(prev) {
+		return err
+	}
+	return prev
+}
+
 // syncGroupSettings synchronizes a groups setting (but not the membership).
 // This includes;
 // * creating the group if it doesn't exist
 // * setting description and properties on the group
-func (s *GroupSyncer) syncGroupSettings(gDef *v1alpha1.GoogleGroup,service *admin.Service, settingsService *settingsSdk.Service) error {
-	_, err := service.Groups.Get(gDef.Spec.Email).Do()
+func (s *GroupSyncer) syncGroupSettings(gDef *v1alpha1.GoogleGroup,service *admin.Service, settingsService *settingsSdk.Service, changes *notify.ChangeSet) error {
+	group, err := service.Groups.Get(gDef.Spec.Email).Do()
 
 	log := s.Log
 	if err != nil {
@@ -81,14 +181,18 @@ func (s *GroupSyncer) syncGroupSettings(gDef *v1alpha1.GoogleGroup,service *admi
 			Name: pieces[0],
 			Description: gDef.Spec.Description,
 		}
-		_, err := service.Groups.Insert(newGroup).Do()
+		created, err := service.Groups.Insert(newGroup).Do()
 
 		if err != nil {
 			log.Error(err, "Error creating group.", "group", gDef.Spec.Email)
 			return err
 		}
+		group = created
+		changes.Events = append(changes.Events, notify.Event{Type: notify.GroupCreated, Group: gDef.Spec.Email})
 	}
 
+	gDef.Status.GroupID = group.Id
+
 	// Update the group settings.
 	gSettings, err := settingsService.Groups.Get(gDef.Spec.Email).Do()
 
@@ -119,10 +223,10 @@ func (s *GroupSyncer) syncGroupSettings(gDef *v1alpha1.GoogleGroup,service *admi
 		s.Log.Error(err, "Error updating group settings", "group", gDef.Spec.Email)
 	}
 
-	return nil
+	return err
 }
 
-func (s *GroupSyncer) syncMembers(gDef *v1alpha1.GoogleGroup, service *admin.Service) error {
+func (s *GroupSyncer) syncMembers(gDef *v1alpha1.GoogleGroup, service *admin.Service, changes *notify.ChangeSet) error {
 	log := s.Log
 	currentMembers := []*admin.Member{}
 
@@ -138,14 +242,29 @@ func (s *GroupSyncer) syncMembers(gDef *v1alpha1.GoogleGroup, service *admin.Ser
 		return err
 	}
 
-	diff := diffCurrentDesiredMembers(currentMembers, gDef.Spec.Members)
+	// Expired members are treated as absent so they get removed.
+	desired := activeMembers(gDef.Spec.Members, s.getNow())
+
+	for _, m := range gDef.Spec.Members {
+		if m.IsExpired(s.getNow()) {
+			log.Info("Membership expired", "group", gDef.Spec.Email, "member", m.Email, "expires", m.Expires)
+		}
+	}
+
+	diff := diffCurrentDesiredMembers(currentMembers, desired)
 
 	log.Info("Diff Group Membership", "group", gDef.Spec.Email, "diff", diff)
 
+	// Keep going when individual members fail so one bad member doesn't block the rest of the group.
+	var syncErr error
+	memberCount := len(currentMembers)
+
 	// Add missing members
 	for _, m := range diff.ToAdd {
-		if !isValidGroupRole(GroupRole(m.Role)) {
-			log.Error(fmt.Errorf("Member has invalid role"), "Member has invalid role", "group", gDef.Spec.Email, "member", m)
+		if !IsValidGroupRole(GroupRole(m.Role)) {
+			roleErr := &permanentError{fmt.Errorf("Member %v has invalid role %v", m.Email, m.Role)}
+			syncErr = mergeErrors(syncErr, roleErr)
+			log.Error(roleErr, "Member has invalid role", "group", gDef.Spec.Email, "member", m)
 			continue
 		}
 		newMember := admin.Member{
@@ -155,61 +274,126 @@ func (s *GroupSyncer) syncMembers(gDef *v1alpha1.GoogleGroup, service *admin.Ser
 		result, err := service.Members.Insert(gDef.Spec.Email, &newMember).Do()
 
 		if err != nil {
+			syncErr = mergeErrors(syncErr, err)
 			log.Error(err, "Could not insert member", "group", gDef.Spec.Email, "member", newMember)
 		} else {
+			memberCount++
+			changes.Events = append(changes.Events, notify.Event{Type: notify.MemberAdded, Group: gDef.Spec.Email, Member: m.Email, Role: m.Role})
 			log.Info( "Inserted member", "group", gDef.Spec.Email, "member", result)
 		}
 	}
 
+	// Roles of existing members aren't changed; diff.RoleChanges is only reported by drift.
+
 	// Delete removed members
 	for _, m := range diff.ToRemove {
 		err := service.Members.Delete(gDef.Spec.Email, m).Do()
 
 		if err != nil {
+			syncErr = mergeErrors(syncErr, err)
 			log.Error(err, "Could not delete member", "group", gDef.Spec.Email, "member", m)
 		} else {
+			memberCount--
+			changes.Events = append(changes.Events, notify.Event{Type: notify.MemberRemoved, Group: gDef.Spec.Email, Member: m})
 			log.Info( "Delete member", "group", gDef.Spec.Email, "member", m)
 		}
 	}
-	return nil
+
+	gDef.Status.MemberCount = memberCount
+	return syncErr
 }
 
-// TODO(jlewi): We should also figure out if there are any members that need to be updated e.g. have their
-// role changed.
+// notify sends notifications about the changes made to a group. Failing to notify doesn't fail the sync.
+func (s *GroupSyncer) notify(changes *notify.ChangeSet) {
+	if s.Notifier == nil || len(changes.Events) == 0 {
+		return
+	}
+
+	if err := s.Notifier.Notify(changes); err != nil {
+		s.Log.Error(err, "Failed to send notifications", "group", changes.Group.Spec.Email)
+	}
+}
+
+// recordResult records the outcome of syncing a group in its status.
+func (s *GroupSyncer) recordResult(gDef *v1alpha1.GoogleGroup, err error) {
+	now := metav1.NewTime(s.getNow())
+	gDef.Status.LastSyncTime = &now
+	gDef.Status.InSync = err == nil
+
+	if err != nil {
+		gDef.Status.LastError = err.Error()
+		return
+	}
+
+	gDef.Status.LastError = ""
+	gDef.Status.LastSuccessfulSyncTime = &now
+}
+
+func (s *GroupSyncer) getNow() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// memberDiff is how the current members of a group differ from the desired members. It is shared by the
+// syncer and DiffGroup so sync and drift agree on which members are missing or extra.
 type memberDiff struct{
 	// List of members that are missing from the group
 	ToAdd []v1alpha1.Member
 
 	// List of members to remove from the group
 	ToRemove []string
+
+	// RoleChanges are members whose current role differs from the desired role. The syncer doesn't apply them.
+	RoleChanges []RoleChange
 }
 
 func diffCurrentDesiredMembers(current []*admin.Member, desired []v1alpha1.Member) memberDiff {
-	cSet := map[string] bool {}
+	members := []v1alpha1.Member{}
+	for _, m := range current {
+		members = append(members, v1alpha1.Member{Email: m.Email, Role: m.Role})
+	}
+	return diffMembers(members, desired)
+}
+
+// diffMembers compares the current members of a group to the desired members. Emails are compared case
+// insensitively since Google Groups doesn't distinguish them. A role change is only reported if the desired
+// member has a role.
+func diffMembers(current []v1alpha1.Member, desired []v1alpha1.Member) memberDiff {
+	cSet := map[string]v1alpha1.Member{}
 
 	for  _, m := range current {
-		cSet[m.Email] = true
+		cSet[strings.ToLower(m.Email)] = m
 	}
 
 	diff := memberDiff{
 		ToAdd:  []v1alpha1.Member{},
 		ToRemove: []string{},
+		RoleChanges: []RoleChange{},
 	}
 
 	dSet := map[string] bool {}
 
-	// generate missing members
+	// generate missing members and role changes
 	for _, m := range desired {
-		dSet[m.Email] = true
+		key := strings.ToLower(m.Email)
+		dSet[key] = true
 
-		if _, ok := cSet[m.Email]; !ok {
+		c, ok := cSet[key]
+		if !ok {
 			diff.ToAdd = append(diff.ToAdd, m)
+			continue
+		}
+
+		if m.Role != "" && m.Role != c.Role {
+			diff.RoleChanges = append(diff.RoleChanges, RoleChange{Email: c.Email, Spec: m.Role, Live: c.Role})
 		}
 	}
 
 	// generate members to delete
 	for _, m := range current {
-		if _, ok := dSet[m.Email]; !ok {
+		if _, ok := dSet[strings.ToLower(m.Email)]; !ok {
 			diff.ToRemove = append(diff.ToRemove, m.Email)
 		}
 	}
@@ -217,7 +401,20 @@ func diffCurrentDesiredMembers(current []*admin.Member, desired []v1alpha1.Membe
 	return diff
 }
 
-func isValidGroupRole(role GroupRole) bool {
+// activeMembers returns the members whose membership hasn't expired.
+func activeMembers(members []v1alpha1.Member, now time.Time) []v1alpha1.Member {
+	active := []v1alpha1.Member{}
+	for _, m := range members {
+		if m.IsExpired(now) {
+			continue
+		}
+		active = append(active, m)
+	}
+	return active
+}
+
+// IsValidGroupRole returns true if role is one of the roles supported by the Directory API.
+func IsValidGroupRole(role GroupRole) bool {
 	for _, v := range []GroupRole{OwnerRole, ManagerRole, MemberRole} {
 		if v == role {
 			return true
@@ -1,10 +1,16 @@
 package groups
 
 import (
+	"github.com/go-logr/zapr"
+	"github.com/gogo/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
 	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/notify"
+	"go.uber.org/zap"
 	admin "google.golang.org/api/admin/directory/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
+	"time"
 )
 
 func TestMembersDiff(t *testing.T) {
@@ -26,6 +32,7 @@ func TestMembersDiff(t *testing.T) {
 					},
 				},
 				ToRemove: []string{"a"},
+				RoleChanges: []RoleChange{},
 			},
 		},
 	}
@@ -52,3 +59,303 @@ func TestMembersDiff(t *testing.T) {
 		}
 	}
 }
+
+func TestMembersDiffRoles(t *testing.T) {
+	current := []*admin.Member{
+		{Email: "Owner@acme.com", Role: "MEMBER"},
+		{Email: "same@acme.com", Role: "MANAGER"},
+		{Email: "norole@acme.com", Role: "MEMBER"},
+	}
+
+	desired := []v1alpha1.Member{
+		{Email: "owner@acme.com", Role: "OWNER"},
+		{Email: "SAME@acme.com", Role: "MANAGER"},
+		{Email: "norole@acme.com"},
+	}
+
+	expected := memberDiff{
+		ToAdd:    []v1alpha1.Member{},
+		ToRemove: []string{},
+		RoleChanges: []RoleChange{
+			{Email: "Owner@acme.com", Spec: "OWNER", Live: "MEMBER"},
+		},
+	}
+
+	if diff := cmp.Diff(expected, diffCurrentDesiredMembers(current, desired)); diff != "" {
+		t.Errorf("diffCurrentDesiredMembers() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSyncStatus(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	syncTime := metav1.NewTime(now)
+
+	f := newFakeDirectory()
+	f.addGroup("ci-team@kubeflow.org", map[string]string{
+		"a@acme.com":       "MEMBER",
+		"b@acme.com":       "MEMBER",
+		"expired@acme.com": "MEMBER",
+	})
+	f.addGroup("release-team@kubeflow.org", map[string]string{})
+	f.failMembers["bad@acme.com"] = true
+
+	client, stop := f.client()
+	defer stop()
+
+	s := &GroupSyncer{
+		Client: client,
+		Log:    zapr.NewLogger(zap.L()),
+		now: func() time.Time {
+			return now
+		},
+	}
+
+	specs := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					// Sync doesn't change the roles of existing members; drift reports them.
+					{Email: "b@acme.com", Role: "MANAGER"},
+					{Email: "c@acme.com", Role: "OWNER"},
+					{Email: "d@acme.com", Role: "MEMBER"},
+					// Expired members should be removed.
+					{Email: "expired@acme.com", Role: "MEMBER", Expires: "2020-10-31"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "release-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "bad@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				AutoSync: proto.Bool(false),
+				Email:    "unmanaged@kubeflow.org",
+			},
+		},
+	}
+
+	err := s.Sync(specs)
+
+	if err == nil {
+		t.Errorf("Sync should have returned an error because release-team couldn't be synced")
+	}
+
+	expected := []*v1alpha1.GoogleGroupStatus{
+		{
+			GroupID:                "id-1",
+			MemberCount:            3,
+			InSync:                 true,
+			LastSyncTime:           &syncTime,
+			LastSuccessfulSyncTime: &syncTime,
+		},
+		{
+			GroupID:      "id-2",
+			InSync:       false,
+			LastError:    "googleapi: Error 400: Bad Request",
+			LastSyncTime: &syncTime,
+		},
+		nil,
+	}
+
+	for i, g := range specs {
+		if d := cmp.Diff(expected[i], g.Status); d != "" {
+			t.Errorf("Status for %v mismatch (-want +got):\n%s", g.Spec.Email, d)
+		}
+	}
+
+	expectedRoles := map[string]string{
+		"b@acme.com": "MEMBER",
+		"c@acme.com": "OWNER",
+		"d@acme.com": "MEMBER",
+	}
+
+	if d := cmp.Diff(expectedRoles, f.memberRoles("ci-team@kubeflow.org")); d != "" {
+		t.Errorf("Members mismatch (-want +got):\n%s", d)
+	}
+}
+
+// recordingNotifier records the change sets it is notified about.
+type recordingNotifier struct {
+	changes []notify.ChangeSet
+}
+
+func (n *recordingNotifier) Notify(changes *notify.ChangeSet) error {
+	n.changes = append(n.changes, *changes)
+	return nil
+}
+
+func TestSyncNotifications(t *testing.T) {
+	f := newFakeDirectory()
+	f.addGroup("ci-team@kubeflow.org", map[string]string{
+		"a@acme.com": "MEMBER",
+		"b@acme.com": "MEMBER",
+	})
+
+	client, stop := f.client()
+	defer stop()
+
+	n := &recordingNotifier{}
+	s := &GroupSyncer{
+		Client:   client,
+		Log:      zapr.NewLogger(zap.L()),
+		Notifier: n,
+	}
+
+	specs := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "b@acme.com", Role: "MEMBER"},
+					{Email: "c@acme.com", Role: "OWNER"},
+				},
+			},
+		},
+		{
+			// Group doesn't exist so it should be created.
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "new-team@kubeflow.org",
+			},
+		},
+	}
+
+	if err := s.Sync(specs); err != nil {
+		t.Fatalf("Sync returned error; %v", err)
+	}
+
+	// Sync again; nothing changed so there should be no more notifications.
+	if err := s.Sync(specs); err != nil {
+		t.Fatalf("Sync returned error; %v", err)
+	}
+
+	expected := []notify.ChangeSet{
+		{
+			Group: specs[0],
+			Events: []notify.Event{
+				{Type: notify.MemberAdded, Group: "ci-team@kubeflow.org", Member: "c@acme.com", Role: "OWNER"},
+				{Type: notify.MemberRemoved, Group: "ci-team@kubeflow.org", Member: "a@acme.com"},
+			},
+		},
+		{
+			Group: specs[1],
+			Events: []notify.Event{
+				{Type: notify.GroupCreated, Group: "new-team@kubeflow.org"},
+			},
+		},
+	}
+
+	if d := cmp.Diff(expected, n.changes); d != "" {
+		t.Errorf("Notifications mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestSyncSpecErrors(t *testing.T) {
+	type testCase struct {
+		name  string
+		specs []*v1alpha1.GoogleGroup
+		// failSettings are the groups whose settings can't be read; e.g. because of a missing permission.
+		failSettings []string
+		// expected is the SpecError expected; nil if the error should be transient.
+		expected *SpecError
+	}
+
+	cases := []testCase{
+		{
+			name: "invalid-role",
+			specs: []*v1alpha1.GoogleGroup{
+				{
+					Spec: v1alpha1.GoogleGroupSpec{
+						Email: "ci-team@kubeflow.org",
+						Members: []v1alpha1.Member{
+							{Email: "a@acme.com", Role: "ADMIN"},
+						},
+					},
+				},
+			},
+			expected: &SpecError{Groups: []string{"ci-team@kubeflow.org"}},
+		},
+		{
+			name: "rejected-member",
+			specs: []*v1alpha1.GoogleGroup{
+				{
+					Spec: v1alpha1.GoogleGroupSpec{
+						Email: "ci-team@kubeflow.org",
+						Members: []v1alpha1.Member{
+							{Email: "bad@acme.com", Role: "MEMBER"},
+							{Email: "a@acme.com", Role: "MEMBER"},
+						},
+					},
+				},
+			},
+			expected: &SpecError{Groups: []string{"ci-team@kubeflow.org"}},
+		},
+		{
+			// Any transient failure means the sync should be retried.
+			name: "transient",
+			specs: []*v1alpha1.GoogleGroup{
+				{
+					Spec: v1alpha1.GoogleGroupSpec{
+						Email: "ci-team@kubeflow.org",
+						Members: []v1alpha1.Member{
+							{Email: "bad@acme.com", Role: "MEMBER"},
+						},
+					},
+				},
+				{
+					Spec: v1alpha1.GoogleGroupSpec{
+						Email: "release-team@kubeflow.org",
+					},
+				},
+			},
+			failSettings: []string{"release-team@kubeflow.org"},
+		},
+	}
+
+	for _, c := range cases {
+		f := newFakeDirectory()
+		f.addGroup("ci-team@kubeflow.org", map[string]string{})
+		f.addGroup("release-team@kubeflow.org", map[string]string{})
+		f.failMembers["bad@acme.com"] = true
+		for _, g := range c.failSettings {
+			f.failSettings[g] = true
+		}
+
+		client, stop := f.client()
+
+		s := &GroupSyncer{
+			Client: client,
+			Log:    zapr.NewLogger(zap.L()),
+		}
+
+		err := s.Sync(c.specs)
+		stop()
+
+		if err == nil {
+			t.Errorf("Case %v: Sync should have returned an error", c.name)
+			continue
+		}
+
+		if c.expected == nil {
+			if IsPermanent(err) {
+				t.Errorf("Case %v: got permanent error %v; want a transient error", c.name, err)
+			}
+			continue
+		}
+
+		actual, ok := err.(*SpecError)
+		if !ok {
+			t.Errorf("Case %v: got error %v; want a SpecError", c.name, err)
+			continue
+		}
+
+		if d := cmp.Diff(c.expected, actual); d != "" {
+			t.Errorf("Case %v: SpecError mismatch (-want +got):\n%s", c.name, d)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package iam
+
+import (
+	"encoding/json"
+	"fmt"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	"sort"
+)
+
+// BindingDiff is the change to the members of a binding. Bindings are identified by their role and condition.
+type BindingDiff struct {
+	Role string `json:"role"`
+	// Condition is the title, or the expression if there is no title, of the binding's condition.
+	Condition string `json:"condition,omitempty"`
+	// Added are the members in the policy file but not in the live policy.
+	Added []string `json:"added,omitempty"`
+	// Removed are the members in the live policy but not in the policy file.
+	Removed []string `json:"removed,omitempty"`
+}
+
+// PolicyDiff describes how the live IAM policy of a project differs from its policy file.
+type PolicyDiff struct {
+	Project  string        `json:"project"`
+	Bindings []BindingDiff `json:"bindings,omitempty"`
+	// AuditConfigsChanged is true if the policy file sets the audit logging configuration and it differs.
+	AuditConfigsChanged bool `json:"auditConfigsChanged,omitempty"`
+}
+
+// bindingKey identifies a binding.
+type bindingKey struct {
+	role string
+	// condition is the serialized condition.
+	condition string
+}
+
+// DiffPolicies compares the desired policy of a project to its live policy.
+// Bindings with the same role and condition are merged, so splitting a binding isn't a change.
+func DiffPolicies(project string, desired *crm.Policy, live *crm.Policy) *PolicyDiff {
+	diff := &PolicyDiff{
+		Project:  project,
+		Bindings: []BindingDiff{},
+	}
+
+	desiredMembers, conditions := groupBindings(desired)
+	liveMembers, liveConditions := groupBindings(live)
+	for k, c := range liveConditions {
+		conditions[k] = c
+	}
+
+	keys := []bindingKey{}
+	for k := range conditions {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].role != keys[j].role {
+			return keys[i].role < keys[j].role
+		}
+		return keys[i].condition < keys[j].condition
+	})
+
+	for _, k := range keys {
+		d := BindingDiff{
+			Role:      k.role,
+			Condition: describeCondition(conditions[k]),
+			Added:     difference(desiredMembers[k], liveMembers[k]),
+			Removed:   difference(liveMembers[k], desiredMembers[k]),
+		}
+
+		if len(d.Added) > 0 || len(d.Removed) > 0 {
+			diff.Bindings = append(diff.Bindings, d)
+		}
+	}
+
+	// Like gcloud, the audit logging configuration is only managed if the policy file sets it.
+	if desired.AuditConfigs != nil {
+		diff.AuditConfigsChanged = serialize(desired.AuditConfigs) != serialize(live.AuditConfigs)
+	}
+	return diff
+}
+
+// IsEmpty returns true if the live policy matches the policy file.
+func (d *PolicyDiff) IsEmpty() bool {
+	return len(d.Bindings) == 0 && !d.AuditConfigsChanged
+}
+
+// Lines describes each change on a separate line.
+func (d *PolicyDiff) Lines() []string {
+	lines := []string{}
+	for _, b := range d.Bindings {
+		binding := b.Role
+		if b.Condition != "" {
+			binding = fmt.Sprintf("%v (condition %q)", b.Role, b.Condition)
+		}
+
+		for _, m := range b.Added {
+			lines = append(lines, fmt.Sprintf("add %v to %v", m, binding))
+		}
+		for _, m := range b.Removed {
+			lines = append(lines, fmt.Sprintf("remove %v from %v", m, binding))
+		}
+	}
+
+	if d.AuditConfigsChanged {
+		lines = append(lines, "update the audit logging configuration")
+	}
+	return lines
+}
+
+// groupBindings returns the set of members of each binding and its condition.
+func groupBindings(p *crm.Policy) (map[bindingKey]map[string]bool, map[bindingKey]*crm.Expr) {
+	members := map[bindingKey]map[string]bool{}
+	conditions := map[bindingKey]*crm.Expr{}
+
+	for _, b := range p.Bindings {
+		k := bindingKey{role: b.Role, condition: serialize(b.Condition)}
+		if _, ok := members[k]; !ok {
+			members[k] = map[string]bool{}
+		}
+		conditions[k] = b.Condition
+
+		for _, m := range b.Members {
+			members[k][m] = true
+		}
+	}
+	return members, conditions
+}
+
+// difference returns the sorted members of a that aren't in b.
+func difference(a map[string]bool, b map[string]bool) []string {
+	var result []string
+	for m := range a {
+		if !b[m] {
+			result = append(result, m)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func describeCondition(c *crm.Expr) string {
+	if c == nil {
+		return ""
+	}
+	if c.Title != "" {
+		return c.Title
+	}
+	return c.Expression
+}
+
+// serialize returns a canonical form of v for comparisons. Empty lists and nil are the same.
+func serialize(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	s := string(b)
+	if s == "[]" || s == "null" {
+		return ""
+	}
+	return s
+}
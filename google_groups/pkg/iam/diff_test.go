@@ -0,0 +1,104 @@
+package iam
+
+import (
+	"github.com/google/go-cmp/cmp"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	"testing"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	type testCase struct {
+		name     string
+		desired  *crm.Policy
+		live     *crm.Policy
+		expected *PolicyDiff
+	}
+
+	condition := &crm.Expr{Title: "expires", Expression: "request.time < timestamp('2021-01-01T00:00:00Z')"}
+
+	cases := []testCase{
+		{
+			name: "in-sync",
+			desired: &crm.Policy{Bindings: []*crm.Binding{
+				{Role: "roles/viewer", Members: []string{"user:a@kubeflow.org", "user:b@kubeflow.org"}},
+			}},
+			live: &crm.Policy{Bindings: []*crm.Binding{
+				{Role: "roles/viewer", Members: []string{"user:b@kubeflow.org", "user:a@kubeflow.org"}},
+			}},
+			expected: &PolicyDiff{Project: "p", Bindings: []BindingDiff{}},
+		},
+		{
+			name: "split-binding-isnt-a-change",
+			desired: &crm.Policy{Bindings: []*crm.Binding{
+				{Role: "roles/viewer", Members: []string{"user:a@kubeflow.org"}},
+				{Role: "roles/viewer", Members: []string{"user:b@kubeflow.org"}},
+			}},
+			live: &crm.Policy{Bindings: []*crm.Binding{
+				{Role: "roles/viewer", Members: []string{"user:a@kubeflow.org", "user:b@kubeflow.org"}},
+			}},
+			expected: &PolicyDiff{Project: "p", Bindings: []BindingDiff{}},
+		},
+		{
+			name: "members-and-roles",
+			desired: &crm.Policy{Bindings: []*crm.Binding{
+				{Role: "roles/editor", Members: []string{"group:ci-team@kubeflow.org"}},
+				{Role: "roles/viewer", Members: []string{"user:a@kubeflow.org", "user:c@kubeflow.org"}},
+			}},
+			live: &crm.Policy{Bindings: []*crm.Binding{
+				{Role: "roles/owner", Members: []string{"user:root@kubeflow.org"}},
+				{Role: "roles/viewer", Members: []string{"user:a@kubeflow.org", "user:b@kubeflow.org"}},
+			}},
+			expected: &PolicyDiff{
+				Project: "p",
+				Bindings: []BindingDiff{
+					{Role: "roles/editor", Added: []string{"group:ci-team@kubeflow.org"}},
+					{Role: "roles/owner", Removed: []string{"user:root@kubeflow.org"}},
+					{Role: "roles/viewer", Added: []string{"user:c@kubeflow.org"}, Removed: []string{"user:b@kubeflow.org"}},
+				},
+			},
+		},
+		{
+			name: "conditions-are-separate-bindings",
+			desired: &crm.Policy{Bindings: []*crm.Binding{
+				{Role: "roles/viewer", Members: []string{"user:a@kubeflow.org"}, Condition: condition},
+			}},
+			live: &crm.Policy{Bindings: []*crm.Binding{
+				{Role: "roles/viewer", Members: []string{"user:a@kubeflow.org"}},
+			}},
+			expected: &PolicyDiff{
+				Project: "p",
+				Bindings: []BindingDiff{
+					{Role: "roles/viewer", Removed: []string{"user:a@kubeflow.org"}},
+					{Role: "roles/viewer", Condition: "expires", Added: []string{"user:a@kubeflow.org"}},
+				},
+			},
+		},
+		{
+			name: "audit-configs",
+			desired: &crm.Policy{AuditConfigs: []*crm.AuditConfig{
+				{Service: "allServices", AuditLogConfigs: []*crm.AuditLogConfig{{LogType: "DATA_READ"}}},
+			}},
+			live:     &crm.Policy{},
+			expected: &PolicyDiff{Project: "p", Bindings: []BindingDiff{}, AuditConfigsChanged: true},
+		},
+		{
+			name:    "audit-configs-not-in-file",
+			desired: &crm.Policy{},
+			live: &crm.Policy{AuditConfigs: []*crm.AuditConfig{
+				{Service: "allServices", AuditLogConfigs: []*crm.AuditLogConfig{{LogType: "DATA_READ"}}},
+			}},
+			expected: &PolicyDiff{Project: "p", Bindings: []BindingDiff{}},
+		},
+	}
+
+	for _, c := range cases {
+		actual := DiffPolicies("p", c.desired, c.live)
+		if d := cmp.Diff(c.expected, actual); d != "" {
+			t.Errorf("Case %v: DiffPolicies mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		if actual.IsEmpty() != (len(c.expected.Bindings) == 0 && !c.expected.AuditConfigsChanged) {
+			t.Errorf("Case %v: IsEmpty() = %v", c.name, actual.IsEmpty())
+		}
+	}
+}
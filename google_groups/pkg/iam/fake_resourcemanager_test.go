@@ -0,0 +1,111 @@
+package iam
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/internal/apitest"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// fakeResourceManager is an in memory implementation of the IAM methods of the Resource Manager API.
+type fakeResourceManager struct {
+	mu       sync.Mutex
+	policies map[string]*crm.Policy
+	// nextEtag is used to generate a new etag whenever a policy is set.
+	nextEtag int
+	// sets counts the calls to setIamPolicy for each project.
+	sets map[string]int
+	// failProjects is a set of projects for which every request fails with a permission error.
+	failProjects map[string]bool
+}
+
+func newFakeResourceManager() *fakeResourceManager {
+	return &fakeResourceManager{
+		policies:     map[string]*crm.Policy{},
+		sets:         map[string]int{},
+		failProjects: map[string]bool{},
+	}
+}
+
+// addPolicy sets the live policy of a project and returns its etag.
+func (f *fakeResourceManager) addPolicy(project string, p *crm.Policy) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextEtag++
+	p.Etag = fmt.Sprintf("etag-%v", f.nextEtag)
+	f.policies[project] = p
+	return p.Etag
+}
+
+// client returns an http.Client which sends all requests to the fake and a function to shut it down.
+func (f *fakeResourceManager) client() (*http.Client, func()) {
+	return apitest.NewClient(f)
+}
+
+func (f *fakeResourceManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const prefix = "/v1/projects/"
+	pieces := strings.SplitN(strings.TrimPrefix(r.URL.Path, prefix), ":", 2)
+
+	if !strings.HasPrefix(r.URL.Path, prefix) || len(pieces) != 2 || r.Method != http.MethodPost {
+		apitest.WriteError(w, http.StatusNotFound, "NOT_FOUND")
+		return
+	}
+
+	project := pieces[0]
+	if f.failProjects[project] {
+		apitest.WriteError(w, http.StatusForbidden, "PERMISSION_DENIED")
+		return
+	}
+
+	live, ok := f.policies[project]
+	if !ok {
+		apitest.WriteError(w, http.StatusForbidden, "PERMISSION_DENIED")
+		return
+	}
+
+	switch pieces[1] {
+	case "getIamPolicy":
+		apitest.WriteJSON(w, live)
+	case "setIamPolicy":
+		req := &crm.SetIamPolicyRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			apitest.WriteError(w, http.StatusBadRequest, "INVALID_ARGUMENT")
+			return
+		}
+
+		if req.Policy.Etag != "" && req.Policy.Etag != live.Etag {
+			apitest.WriteError(w, http.StatusConflict, "ABORTED")
+			return
+		}
+
+		// Like the API only the fields in the update mask are set; the default mask is bindings and etag.
+		updated := *live
+		mask := req.UpdateMask
+		if mask == "" {
+			mask = "bindings,etag"
+		}
+		for _, field := range strings.Split(mask, ",") {
+			switch field {
+			case "auditConfigs":
+				updated.AuditConfigs = req.Policy.AuditConfigs
+			case "bindings":
+				updated.Bindings = req.Policy.Bindings
+				updated.Version = req.Policy.Version
+			}
+		}
+
+		f.sets[project]++
+		f.nextEtag++
+		updated.Etag = fmt.Sprintf("etag-%v", f.nextEtag)
+		f.policies[project] = &updated
+		apitest.WriteJSON(w, &updated)
+	default:
+		apitest.WriteError(w, http.StatusNotFound, "NOT_FOUND")
+	}
+}
@@ -0,0 +1,93 @@
+// Package iam plans and applies the IAM policies of GCP projects from YAML files.
+//
+// The files are in the format written by gcloud projects get-iam-policy --format=yaml and are named
+// {project}.iam.policy.yaml.
+package iam
+
+import (
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PolicyFileSuffix is the suffix of IAM policy files; the rest of the file name is the project.
+const PolicyFileSuffix = ".iam.policy.yaml"
+
+// Scopes are the OAuth2 scopes needed to read and set project IAM policies.
+var Scopes = []string{crm.CloudPlatformScope}
+
+// PolicyFile is the desired IAM policy of a project.
+type PolicyFile struct {
+	// Path is the file the policy was read from.
+	Path    string
+	Project string
+	Policy  *crm.Policy
+}
+
+// ReadPolicyFile reads the policy in path. The project is determined from the file name.
+func ReadPolicyFile(path string) (*PolicyFile, error) {
+	base := filepath.Base(path)
+	if !strings.HasSuffix(base, PolicyFileSuffix) {
+		return nil, errors.Errorf("Policy file %v isn't named {project}%v", path, PolicyFileSuffix)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading policy file %v", path)
+	}
+
+	p := &crm.Policy{}
+	if err := yaml.Unmarshal(b, p); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing policy file %v", path)
+	}
+
+	return &PolicyFile{
+		Path:    path,
+		Project: strings.TrimSuffix(base, PolicyFileSuffix),
+		Policy:  p,
+	}, nil
+}
+
+// ReadPolicyFiles reads all the policy files matching the glob sorted by project. Empty files are skipped
+// since gcloud writes them when it can't read the policy.
+func ReadPolicyFiles(glob string) ([]*PolicyFile, error) {
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error matching glob %v", glob)
+	}
+
+	files := []*PolicyFile{}
+	for _, m := range matches {
+		f, err := ReadPolicyFile(m)
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Policy.Etag == "" && len(f.Policy.Bindings) == 0 {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Project < files[j].Project
+	})
+	return files, nil
+}
+
+// Write writes the policy back to its file in the same format as gcloud.
+func (f *PolicyFile) Write() error {
+	b, err := yaml.Marshal(f.Policy)
+	if err != nil {
+		return errors.Wrapf(err, "Error serializing the policy for %v", f.Project)
+	}
+
+	if err := ioutil.WriteFile(f.Path, b, 0644); err != nil {
+		return errors.Wrapf(err, "Error writing policy file %v", f.Path)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package iam
+
+import (
+	"encoding/json"
+	"github.com/ghodss/yaml"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Report is the outcome of planning or applying a set of policy files.
+type Report struct {
+	// DryRun is true if the changes weren't applied.
+	DryRun   bool             `json:"dryRun"`
+	Projects []*ProjectResult `json:"projects"`
+}
+
+// HasChanges returns true if any project has changes that weren't applied.
+func (r *Report) HasChanges() bool {
+	for _, p := range r.Projects {
+		if p.Diff != nil && !p.Diff.IsEmpty() && !p.Applied {
+			return true
+		}
+	}
+	return false
+}
+
+// HasErrors returns true if any project couldn't be planned or applied.
+func (r *Report) HasErrors() bool {
+	for _, p := range r.Projects {
+		if p.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// rows returns a row (project, status, detail) for each change or error.
+func (r *Report) rows() [][3]string {
+	rows := [][3]string{}
+	for _, p := range r.Projects {
+		status := "pending"
+		if p.Applied {
+			status = "applied"
+		}
+
+		if p.Error != "" {
+			rows = append(rows, [3]string{p.Project, "error", p.Error})
+		}
+
+		if p.Diff == nil {
+			continue
+		}
+
+		lines := p.Diff.Lines()
+		if len(lines) == 0 && p.Error == "" {
+			rows = append(rows, [3]string{p.Project, "in sync", "no changes"})
+		}
+
+		for _, l := range lines {
+			rows = append(rows, [3]string{p.Project, status, l})
+		}
+	}
+	return rows
+}
+
+// Write writes the report in the given format; one of table, json or markdown.
+func (r *Report) Write(w io.Writer, format string) error {
+	return api.WriteReport(w, format, r, [3]string{"Project", "Status", "Detail"}, r.rows())
+}
+
+// WriteFile writes the report to output so there is a record of what was applied. It is written as JSON if
+// output ends in .json and as YAML otherwise.
+func (r *Report) WriteFile(output string) error {
+	var b []byte
+	var err error
+	if strings.ToLower(filepath.Ext(output)) == ".json" {
+		b, err = json.MarshalIndent(r, "", "  ")
+	} else {
+		b, err = yaml.Marshal(r)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(output, b, 0644)
+}
@@ -0,0 +1,163 @@
+package iam
+
+import (
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/gcp"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/googleapi"
+	"net/http"
+	"strings"
+)
+
+// conditionsVersion is the policy version required for bindings with conditions.
+const conditionsVersion = 3
+
+// ProjectResult is the outcome of planning or applying the policy of a project.
+type ProjectResult struct {
+	Project string `json:"project"`
+	File    string `json:"file"`
+	// SpecEtag is the etag in the policy file; the policy is only applied if it matches LiveEtag.
+	SpecEtag string `json:"specEtag"`
+	// LiveEtag is the etag of the live policy before it was applied.
+	LiveEtag string      `json:"liveEtag,omitempty"`
+	Diff     *PolicyDiff `json:"diff,omitempty"`
+	// Applied is true if the changes were applied.
+	Applied bool `json:"applied"`
+	// Error is why the policy couldn't be planned or applied.
+	Error string `json:"error,omitempty"`
+}
+
+// PolicySyncer plans and applies the IAM policies in policy files to their projects.
+type PolicySyncer struct {
+	Client *http.Client
+	Log    logr.Logger
+
+	// DryRun computes the changes without applying them.
+	DryRun bool
+}
+
+// Sync compares each policy file to the live policy of its project and, unless DryRun is set, applies the
+// changes. A policy is only applied if the etag in the file matches the live etag; otherwise the live policy
+// was changed since the file was last synced and applying the file would revert those changes.
+//
+// After a policy is applied the etag in the PolicyFile is updated to the new etag; the caller should write
+// the file so the next change can be applied. Projects are synced independently; an error is returned if any
+// of them failed.
+func (s *PolicySyncer) Sync(files []*PolicyFile) (*Report, error) {
+	// Use crm.New rather than crm.NewService so the client's token is used as is.
+	service, err := crm.New(s.Client)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		DryRun:   s.DryRun,
+		Projects: []*ProjectResult{},
+	}
+
+	failed := []string{}
+	for _, f := range files {
+		result, err := s.syncProject(service, f)
+		report.Projects = append(report.Projects, result)
+
+		if err != nil {
+			result.Error = err.Error()
+
+			// Every remaining project would fail the same way so stop and surface the revoked credential.
+			if gcp.IsRevoked(err) {
+				return report, err
+			}
+			failed = append(failed, f.Project)
+		}
+	}
+
+	if len(failed) > 0 {
+		return report, fmt.Errorf("failed to sync IAM policies: %v", strings.Join(failed, ", "))
+	}
+	return report, nil
+}
+
+func (s *PolicySyncer) syncProject(service *crm.Service, f *PolicyFile) (*ProjectResult, error) {
+	log := s.Log.WithValues("project", f.Project)
+
+	result := &ProjectResult{
+		Project:  f.Project,
+		File:     f.Path,
+		SpecEtag: f.Policy.Etag,
+	}
+
+	live, err := service.Projects.GetIamPolicy(f.Project, &crm.GetIamPolicyRequest{
+		Options: &crm.GetPolicyOptions{RequestedPolicyVersion: conditionsVersion},
+	}).Do()
+
+	if err != nil {
+		log.Error(err, "Error getting IAM policy")
+		return result, err
+	}
+
+	result.LiveEtag = live.Etag
+	result.Diff = DiffPolicies(f.Project, f.Policy, live)
+
+	log.Info("Diff IAM policy", "diff", result.Diff)
+
+	if f.Policy.Etag != live.Etag {
+		err := fmt.Errorf("etag %v in %v doesn't match the live etag %v; the policy was changed outside of the policy file. Fetch the live policy, reapply your changes and update the etag", f.Policy.Etag, f.Path, live.Etag)
+		log.Error(err, "Refusing to apply IAM policy")
+		return result, err
+	}
+
+	if result.Diff.IsEmpty() || s.DryRun {
+		return result, nil
+	}
+
+	desired := *f.Policy
+	desired.Etag = live.Etag
+	for _, b := range desired.Bindings {
+		if b.Condition != nil && desired.Version < conditionsVersion {
+			desired.Version = conditionsVersion
+		}
+	}
+
+	updated, err := service.Projects.SetIamPolicy(f.Project, &crm.SetIamPolicyRequest{
+		Policy:     &desired,
+		UpdateMask: updateMask(&desired),
+	}).Do()
+
+	if err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusConflict {
+			err = fmt.Errorf("the IAM policy was changed concurrently; rerun the plan: %v", err)
+		}
+		log.Error(err, "Error setting IAM policy")
+		return result, err
+	}
+
+	result.Applied = true
+	f.Policy.Etag = updated.Etag
+
+	for _, b := range result.Diff.Bindings {
+		for _, m := range b.Added {
+			log.Info("Added IAM member", "role", b.Role, "condition", b.Condition, "member", m)
+		}
+		for _, m := range b.Removed {
+			log.Info("Removed IAM member", "role", b.Role, "condition", b.Condition, "member", m)
+		}
+	}
+
+	if result.Diff.AuditConfigsChanged {
+		log.Info("Updated audit logging configuration")
+	}
+
+	log.Info("Applied IAM policy", "etag", updated.Etag)
+	return result, nil
+}
+
+// updateMask returns the fields of the policy to set. auditConfigs is only included if the policy file sets it;
+// otherwise applying a file without it would delete the project's audit logging configuration.
+func updateMask(p *crm.Policy) string {
+	if p.AuditConfigs != nil {
+		return "auditConfigs,bindings,etag"
+	}
+	return "bindings,etag"
+}
@@ -0,0 +1,226 @@
+package iam
+
+import (
+	"github.com/go-logr/zapr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api"
+	"go.uber.org/zap"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const viewer = "roles/viewer"
+
+func viewers(members ...string) *crm.Policy {
+	return &crm.Policy{
+		Bindings: []*crm.Binding{{Role: viewer, Members: members}},
+		Version:  1,
+	}
+}
+
+func TestPolicySyncer(t *testing.T) {
+	type testCase struct {
+		name   string
+		dryRun bool
+		// expectedSets is the number of times each project's policy should be set.
+		expectedSets    map[string]int
+		expectedApplied map[string]bool
+	}
+
+	cases := []testCase{
+		{
+			name:            "apply",
+			expectedSets:    map[string]int{"changed": 1},
+			expectedApplied: map[string]bool{"changed": true},
+		},
+		{
+			name:            "dry-run",
+			dryRun:          true,
+			expectedSets:    map[string]int{},
+			expectedApplied: map[string]bool{},
+		},
+	}
+
+	for _, c := range cases {
+		f := newFakeResourceManager()
+
+		inSyncEtag := f.addPolicy("in-sync", viewers("user:a@kubeflow.org"))
+		changedEtag := f.addPolicy("changed", viewers("user:a@kubeflow.org"))
+		f.addPolicy("stale", viewers("user:a@kubeflow.org"))
+		f.addPolicy("forbidden", viewers("user:a@kubeflow.org"))
+		f.failProjects["forbidden"] = true
+
+		withEtag := func(p *crm.Policy, etag string) *crm.Policy {
+			p.Etag = etag
+			return p
+		}
+
+		files := []*PolicyFile{
+			{Project: "in-sync", Policy: withEtag(viewers("user:a@kubeflow.org"), inSyncEtag)},
+			{Project: "changed", Policy: withEtag(viewers("user:a@kubeflow.org", "user:b@kubeflow.org"), changedEtag)},
+			{Project: "stale", Policy: withEtag(viewers("user:b@kubeflow.org"), "etag-old")},
+			{Project: "forbidden", Policy: withEtag(viewers("user:b@kubeflow.org"), "etag-old")},
+		}
+
+		client, stop := f.client()
+		s := &PolicySyncer{
+			Client: client,
+			Log:    zapr.NewLogger(zap.L()),
+			DryRun: c.dryRun,
+		}
+
+		report, err := s.Sync(files)
+		stop()
+
+		if err == nil || !strings.Contains(err.Error(), "stale, forbidden") {
+			t.Errorf("Case %v: Sync returned error %v; want an error for the stale and forbidden projects", c.name, err)
+		}
+
+		if d := cmp.Diff(c.expectedSets, f.sets); d != "" {
+			t.Errorf("Case %v: setIamPolicy calls mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		applied := map[string]bool{}
+		errs := map[string]bool{}
+		for _, p := range report.Projects {
+			if p.Applied {
+				applied[p.Project] = true
+			}
+			if p.Error != "" {
+				errs[p.Project] = true
+			}
+		}
+
+		if d := cmp.Diff(c.expectedApplied, applied); d != "" {
+			t.Errorf("Case %v: applied projects mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		if d := cmp.Diff(map[string]bool{"stale": true, "forbidden": true}, errs); d != "" {
+			t.Errorf("Case %v: failed projects mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		// The changes to the stale project are never applied.
+		if !report.HasChanges() {
+			t.Errorf("Case %v: HasChanges() = false; want true", c.name)
+		}
+
+		live := f.policies["changed"]
+		if c.dryRun {
+			if files[1].Policy.Etag != changedEtag {
+				t.Errorf("Case %v: the etag of the policy file changed in a dry run", c.name)
+			}
+			continue
+		}
+
+		if files[1].Policy.Etag != live.Etag {
+			t.Errorf("Case %v: the policy file has etag %v; want the new live etag %v", c.name, files[1].Policy.Etag, live.Etag)
+		}
+
+		if d := cmp.Diff([]string{"user:a@kubeflow.org", "user:b@kubeflow.org"}, live.Bindings[0].Members); d != "" {
+			t.Errorf("Case %v: live members mismatch (-want +got):\n%s", c.name, d)
+		}
+
+		for _, format := range []string{api.FormatTable, api.FormatJSON, api.FormatMarkdown} {
+			out := &strings.Builder{}
+			if err := report.Write(out, format); err != nil {
+				t.Errorf("Case %v: Write(%v) returned error; %v", c.name, format, err)
+			}
+		}
+	}
+}
+
+// TestPolicySyncerKeepsAuditConfigs verifies applying a policy file without auditConfigs doesn't delete the
+// project's audit logging configuration.
+func TestPolicySyncerKeepsAuditConfigs(t *testing.T) {
+	f := newFakeResourceManager()
+
+	auditConfigs := []*crm.AuditConfig{
+		{Service: "allServices", AuditLogConfigs: []*crm.AuditLogConfig{{LogType: "DATA_READ"}}},
+	}
+	live := viewers("user:a@kubeflow.org")
+	live.AuditConfigs = auditConfigs
+	etag := f.addPolicy("audited", live)
+
+	desired := viewers("user:a@kubeflow.org", "user:b@kubeflow.org")
+	desired.Etag = etag
+	files := []*PolicyFile{{Project: "audited", Policy: desired}}
+
+	client, stop := f.client()
+	defer stop()
+	s := &PolicySyncer{
+		Client: client,
+		Log:    zapr.NewLogger(zap.L()),
+	}
+
+	report, err := s.Sync(files)
+	if err != nil {
+		t.Fatalf("Sync returned error; %v", err)
+	}
+
+	if report.Projects[0].Diff.AuditConfigsChanged {
+		t.Errorf("AuditConfigsChanged = true; want false since the policy file doesn't set auditConfigs")
+	}
+
+	updated := f.policies["audited"]
+	if d := cmp.Diff(auditConfigs, updated.AuditConfigs); d != "" {
+		t.Errorf("Audit configs mismatch (-want +got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"user:a@kubeflow.org", "user:b@kubeflow.org"}, updated.Bindings[0].Members); d != "" {
+		t.Errorf("Live members mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestPolicyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testPolicyFile")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := `bindings:
+- members:
+  - user:a@kubeflow.org
+  role: roles/viewer
+etag: BwWI0RjTAus=
+version: 1
+`
+
+	path := filepath.Join(dir, "devstats"+PolicyFileSuffix)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Error writing policy file; %v", err)
+	}
+
+	// gcloud writes an empty file if it can't read the policy.
+	if err := ioutil.WriteFile(filepath.Join(dir, "empty"+PolicyFileSuffix), []byte{}, 0644); err != nil {
+		t.Fatalf("Error writing policy file; %v", err)
+	}
+
+	files, err := ReadPolicyFiles(filepath.Join(dir, "*"+PolicyFileSuffix))
+	if err != nil {
+		t.Fatalf("ReadPolicyFiles returned error; %v", err)
+	}
+
+	if len(files) != 1 || files[0].Project != "devstats" {
+		t.Fatalf("ReadPolicyFiles returned %+v; want only the devstats policy", files)
+	}
+
+	// Writing the policy shouldn't change the formatting so the diff only shows the new etag.
+	files[0].Policy.Etag = "new-etag"
+	if err := files[0].Write(); err != nil {
+		t.Fatalf("Write returned error; %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading policy file; %v", err)
+	}
+
+	if d := cmp.Diff(strings.Replace(contents, "BwWI0RjTAus=", "new-etag", 1), string(b)); d != "" {
+		t.Errorf("Policy file mismatch (-want +got):\n%s", d)
+	}
+}
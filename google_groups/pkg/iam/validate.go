@@ -0,0 +1,164 @@
+package iam
+
+import (
+	"fmt"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultElevatedRoles are the roles that shouldn't be granted to groups with members outside the domain.
+var DefaultElevatedRoles = []string{"roles/owner", "roles/editor"}
+
+// Issue is a problem found while validating the bindings in the policy files against the group specs.
+type Issue struct {
+	Severity api.Severity
+	Project  string
+	Role     string
+	// Member is the principal of the binding; e.g. group:ci-team@kubeflow.org.
+	Member  string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%v %v: %v %v: %v", i.Severity, i.Project, i.Role, i.Member, i.Message)
+}
+
+// ValidateOptions controls ValidateBindings.
+type ValidateOptions struct {
+	// Domain of the managed Google Groups. Bindings to groups in other domains aren't checked.
+	Domain string
+	// ElevatedRoles are checked for groups with members outside Domain. Defaults to DefaultElevatedRoles.
+	ElevatedRoles []string
+	// Now is used to ignore expired memberships.
+	Now time.Time
+}
+
+// ValidateBindings checks the bindings in the policy files against the group specs. Binding a group in the
+// domain that isn't defined in the specs is an error. It warns about bindings to groups with autoSync: false,
+// since their membership isn't managed by the specs, bindings to individual users that should go through a
+// group, and groups with elevated roles that have members outside the domain.
+func ValidateBindings(files []*PolicyFile, grps []*v1alpha1.GoogleGroup, opts ValidateOptions) []Issue {
+	elevated := map[string]bool{}
+	roles := opts.ElevatedRoles
+	if roles == nil {
+		roles = DefaultElevatedRoles
+	}
+	for _, r := range roles {
+		elevated[r] = true
+	}
+
+	specs := map[string]*v1alpha1.GoogleGroup{}
+	for _, g := range grps {
+		specs[strings.ToLower(g.Spec.Email)] = g
+	}
+
+	issues := []Issue{}
+	for _, f := range files {
+		members, _ := groupBindings(f.Policy)
+
+		keys := []bindingKey{}
+		for k := range members {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].role != keys[j].role {
+				return keys[i].role < keys[j].role
+			}
+			return keys[i].condition < keys[j].condition
+		})
+
+		for _, k := range keys {
+			principals := []string{}
+			for m := range members[k] {
+				principals = append(principals, m)
+			}
+			sort.Strings(principals)
+
+			for _, m := range principals {
+				issue := Issue{Project: f.Project, Role: k.role, Member: m}
+				kind, email := splitPrincipal(m)
+
+				switch kind {
+				case "user":
+					issue.Severity = api.SeverityWarning
+					issue.Message = "role is granted to an individual user; grant it to a group instead"
+					issues = append(issues, issue)
+				case "group":
+					if !strings.EqualFold(domainOf(email), opts.Domain) {
+						continue
+					}
+
+					g, ok := specs[email]
+					if !ok {
+						issue.Severity = api.SeverityError
+						issue.Message = "group isn't defined in the group specs"
+						issues = append(issues, issue)
+						continue
+					}
+
+					if g.Spec.AutoSync != nil && !*g.Spec.AutoSync {
+						issue.Severity = api.SeverityWarning
+						issue.Message = "group has autoSync: false so its membership isn't managed by the group specs"
+						issues = append(issues, issue)
+					}
+
+					if !elevated[k.role] {
+						continue
+					}
+
+					if external := externalMembers(g, opts); len(external) > 0 {
+						issue.Severity = api.SeverityWarning
+						issue.Message = fmt.Sprintf("group has an elevated role but has members outside %v: %v", opts.Domain, strings.Join(external, ", "))
+						issues = append(issues, issue)
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// HasErrors returns true if any of the issues is an error.
+func HasErrors(issues []Issue) bool {
+	for _, i := range issues {
+		if i.Severity == api.SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPrincipal splits a principal like group:ci-team@kubeflow.org into its kind and lower case email.
+func splitPrincipal(m string) (string, string) {
+	pieces := strings.SplitN(m, ":", 2)
+	if len(pieces) != 2 {
+		return "", ""
+	}
+	return pieces[0], strings.ToLower(pieces[1])
+}
+
+func domainOf(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return ""
+	}
+	return email[i+1:]
+}
+
+// externalMembers returns the sorted members of the group, ignoring expired memberships, outside opts.Domain.
+func externalMembers(g *v1alpha1.GoogleGroup, opts ValidateOptions) []string {
+	external := []string{}
+	for _, m := range g.Spec.Members {
+		if m.Email == "" || m.IsExpired(opts.Now) {
+			continue
+		}
+		if !strings.EqualFold(domainOf(m.Email), opts.Domain) {
+			external = append(external, m.Email)
+		}
+	}
+	sort.Strings(external)
+	return external
+}
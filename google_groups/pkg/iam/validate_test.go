@@ -0,0 +1,119 @@
+package iam
+
+import (
+	"github.com/gogo/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	crm "google.golang.org/api/cloudresourcemanager/v1"
+	"testing"
+	"time"
+)
+
+func TestValidateBindings(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	grps := []*v1alpha1.GoogleGroup{
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "a@kubeflow.org", Role: "OWNER"},
+					{Email: "b@acme.com", Role: "MEMBER"},
+					{Email: "expired@acme.com", Role: "MEMBER", Expires: "2020-10-31"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "ci-viewer@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "c@acme.com", Role: "MEMBER"},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email:    "Events@kubeflow.org",
+				AutoSync: proto.Bool(false),
+			},
+		},
+		{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "admins@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "d@kubeflow.org", Role: "OWNER"},
+					{Email: "gone@acme.com", Role: "MEMBER", Expires: "2020-10-31"},
+				},
+			},
+		},
+	}
+
+	files := []*PolicyFile{
+		{
+			Project: "kubeflow-ci",
+			Policy: &crm.Policy{
+				Bindings: []*crm.Binding{
+					{
+						Role: "roles/owner",
+						Members: []string{
+							"group:ci-team@kubeflow.org",
+							"group:admins@kubeflow.org",
+							"user:jlewi@kubeflow.org",
+							"serviceAccount:ci@kubeflow-ci.iam.gserviceaccount.com",
+						},
+					},
+					{
+						Role:    "roles/viewer",
+						Members: []string{"group:ci-viewer@kubeflow.org", "group:events@kubeflow.org"},
+					},
+				},
+			},
+		},
+		{
+			Project: "kf-demo",
+			Policy: &crm.Policy{
+				Bindings: []*crm.Binding{
+					{
+						Role:    "roles/editor",
+						Members: []string{"group:missing@kubeflow.org", "group:support@google.com", "domain:kubeflow.org"},
+					},
+				},
+			},
+		},
+	}
+
+	expected := []Issue{
+		{Severity: api.SeverityWarning, Project: "kubeflow-ci", Role: "roles/owner", Member: "group:ci-team@kubeflow.org", Message: "group has an elevated role but has members outside kubeflow.org: b@acme.com"},
+		{Severity: api.SeverityWarning, Project: "kubeflow-ci", Role: "roles/owner", Member: "user:jlewi@kubeflow.org", Message: "role is granted to an individual user; grant it to a group instead"},
+		{Severity: api.SeverityWarning, Project: "kubeflow-ci", Role: "roles/viewer", Member: "group:events@kubeflow.org", Message: "group has autoSync: false so its membership isn't managed by the group specs"},
+		{Severity: api.SeverityError, Project: "kf-demo", Role: "roles/editor", Member: "group:missing@kubeflow.org", Message: "group isn't defined in the group specs"},
+	}
+
+	actual := ValidateBindings(files, grps, ValidateOptions{Domain: "kubeflow.org", Now: now})
+
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Unexpected issues; diff:\n%v", d)
+	}
+
+	if !HasErrors(actual) {
+		t.Errorf("HasErrors should be true")
+	}
+
+	// Restricting the elevated roles to roles/viewer flags ci-viewer instead of ci-team.
+	actual = ValidateBindings(files[:1], grps, ValidateOptions{Domain: "kubeflow.org", Now: now, ElevatedRoles: []string{"roles/viewer"}})
+
+	expected = []Issue{
+		{Severity: api.SeverityWarning, Project: "kubeflow-ci", Role: "roles/owner", Member: "user:jlewi@kubeflow.org", Message: "role is granted to an individual user; grant it to a group instead"},
+		{Severity: api.SeverityWarning, Project: "kubeflow-ci", Role: "roles/viewer", Member: "group:ci-viewer@kubeflow.org", Message: "group has an elevated role but has members outside kubeflow.org: c@acme.com"},
+		{Severity: api.SeverityWarning, Project: "kubeflow-ci", Role: "roles/viewer", Member: "group:events@kubeflow.org", Message: "group has autoSync: false so its membership isn't managed by the group specs"},
+	}
+
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Unexpected issues with custom elevated roles; diff:\n%v", d)
+	}
+
+	if HasErrors(actual) {
+		t.Errorf("HasErrors should be false")
+	}
+}
@@ -0,0 +1,53 @@
+// Package apitest contains helpers for tests that run fakes of the Google APIs.
+package apitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+)
+
+// NewClient starts a test server for the handler and returns an http.Client which sends all requests, whatever
+// their host, to it and a function to shut it down.
+func NewClient(h http.Handler) (*http.Client, func()) {
+	server := httptest.NewServer(h)
+	target, _ := url.Parse(server.URL)
+	c := &http.Client{
+		Transport: &RewriteTransport{Target: target},
+	}
+	return c, server.Close
+}
+
+// RewriteTransport redirects requests for the Google APIs to the test server.
+type RewriteTransport struct {
+	Target *url.URL
+}
+
+func (t *RewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.Target.Scheme
+	req.URL.Host = t.Target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// WriteJSON writes v as the JSON response.
+func WriteJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes an error response in the format of the Google APIs. status is the canonical error code,
+// e.g. PERMISSION_DENIED; it is omitted if empty.
+func WriteError(w http.ResponseWriter, code int, status string) {
+	e := map[string]interface{}{
+		"code":    code,
+		"message": http.StatusText(code),
+	}
+	if status != "" {
+		e["status"] = status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": e})
+}
@@ -0,0 +1,89 @@
+// Package notify tells people about the changes the syncer makes to groups.
+package notify
+
+import (
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"strings"
+)
+
+// EventType is the type of a change made to a group.
+type EventType string
+
+const (
+	GroupCreated  EventType = "GroupCreated"
+	MemberAdded   EventType = "MemberAdded"
+	MemberRemoved EventType = "MemberRemoved"
+)
+
+// Event is a single change made to a group.
+type Event struct {
+	Type EventType
+	// Group is the email of the group.
+	Group string
+	// Member is the email of the member that was added or removed. It is empty for group events.
+	Member string
+	// Role is the role of the member that was added.
+	Role string
+}
+
+// ChangeSet is the set of changes made to a group by a single sync.
+type ChangeSet struct {
+	Group  *v1alpha1.GoogleGroup
+	Events []Event
+}
+
+// Notifier is notified after each group is synced.
+type Notifier interface {
+	Notify(changes *ChangeSet) error
+}
+
+// Filter returns the events in the change set that the group's notification settings allow.
+// It returns nil if notifications aren't enabled for the group.
+func Filter(changes *ChangeSet) []Event {
+	settings := changes.Group.Spec.Notifications
+
+	if settings == nil {
+		return nil
+	}
+
+	if len(settings.Events) == 0 {
+		return changes.Events
+	}
+
+	allowed := map[string]bool{}
+	for _, e := range settings.Events {
+		allowed[e] = true
+	}
+
+	events := []Event{}
+	for _, e := range changes.Events {
+		if allowed[string(e.Type)] {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// MultiNotifier delivers the notifications to several backends.
+type MultiNotifier struct {
+	Notifiers []Notifier
+	Log       logr.Logger
+}
+
+// Notify notifies all the backends. Every backend is tried even if one of them fails.
+func (m *MultiNotifier) Notify(changes *ChangeSet) error {
+	failed := []string{}
+	for _, n := range m.Notifiers {
+		if err := n.Notify(changes); err != nil {
+			m.Log.Error(err, "Failed to send notification", "group", changes.Group.Spec.Email)
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to send notifications: %v", strings.Join(failed, "; "))
+	}
+	return nil
+}
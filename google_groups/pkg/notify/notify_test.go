@@ -0,0 +1,304 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/api/v1alpha1"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testChangeSet(settings *v1alpha1.NotificationSettings) *ChangeSet {
+	return &ChangeSet{
+		Group: &v1alpha1.GoogleGroup{
+			Spec: v1alpha1.GoogleGroupSpec{
+				Email: "ci-team@kubeflow.org",
+				Members: []v1alpha1.Member{
+					{Email: "owner@acme.com", Role: "OWNER"},
+					{Email: "new@acme.com", Role: "MEMBER"},
+				},
+				Notifications: settings,
+			},
+		},
+		Events: []Event{
+			{Type: MemberAdded, Group: "ci-team@kubeflow.org", Member: "new@acme.com", Role: "MEMBER"},
+			{Type: MemberRemoved, Group: "ci-team@kubeflow.org", Member: "old@acme.com"},
+		},
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	type testCase struct {
+		name      string
+		settings  *v1alpha1.NotificationSettings
+		overrides map[EventType]string
+		expected  []webhookPayload
+	}
+
+	cases := []testCase{
+		{
+			name:     "disabled",
+			settings: nil,
+			expected: []webhookPayload{},
+		},
+		{
+			name:     "all-events",
+			settings: &v1alpha1.NotificationSettings{Webhook: true},
+			expected: []webhookPayload{
+				{
+					Text:  "new@acme.com was added to ci-team@kubeflow.org as MEMBER.\nold@acme.com was removed from ci-team@kubeflow.org.",
+					Group: "ci-team@kubeflow.org",
+					Events: []webhookEvent{
+						{Type: MemberAdded, Member: "new@acme.com", Role: "MEMBER"},
+						{Type: MemberRemoved, Member: "old@acme.com"},
+					},
+				},
+			},
+		},
+		{
+			name:      "filtered-with-template",
+			settings:  &v1alpha1.NotificationSettings{Webhook: true, Events: []string{"MemberRemoved"}},
+			overrides: map[EventType]string{MemberRemoved: "Goodbye {{.Member}}"},
+			expected: []webhookPayload{
+				{
+					Text:  "Goodbye old@acme.com",
+					Group: "ci-team@kubeflow.org",
+					Events: []webhookEvent{
+						{Type: MemberRemoved, Member: "old@acme.com"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		received := []webhookPayload{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := webhookPayload{}
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				t.Errorf("Case %v: Could not decode payload; error %v", c.name, err)
+			}
+			received = append(received, p)
+		}))
+
+		templates, err := NewTemplates(c.overrides)
+		if err != nil {
+			t.Fatalf("Case %v: NewTemplates returned error; %v", c.name, err)
+		}
+
+		n := &WebhookNotifier{
+			URL:       server.URL,
+			Templates: templates,
+		}
+
+		if err := n.Notify(testChangeSet(c.settings)); err != nil {
+			t.Errorf("Case %v: Notify returned error; %v", c.name, err)
+		}
+
+		server.Close()
+
+		if d := cmp.Diff(c.expected, received); d != "" {
+			t.Errorf("Case %v: payload mismatch (-want +got):\n%s", c.name, d)
+		}
+	}
+}
+
+// fakeSMTPServer implements just enough of SMTP to receive messages from net/smtp.
+type fakeSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []fakeMessage
+}
+
+type fakeMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen; error %v", err)
+	}
+	s := &fakeSMTPServer{listener: l}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(l string) {
+		conn.Write([]byte(l + "\r\n"))
+	}
+
+	reply("220 localhost fake SMTP")
+	msg := fakeMessage{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.From = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.To = append(msg.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 Send data")
+			data := []string{}
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				l = strings.TrimRight(l, "\r\n")
+				if l == "." {
+					break
+				}
+				data = append(data, l)
+			}
+			msg.Data = strings.Join(data, "\n")
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = fakeMessage{}
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	type testCase struct {
+		name     string
+		settings *v1alpha1.NotificationSettings
+		expected []fakeMessage
+	}
+
+	added := "new@acme.com was added to ci-team@kubeflow.org as MEMBER."
+	removed := "old@acme.com was removed from ci-team@kubeflow.org."
+
+	// message is the email each recipient should get; only the recipient is in the headers.
+	message := func(to string, lines ...string) fakeMessage {
+		return fakeMessage{
+			From: "groups@kubeflow.org",
+			To:   []string{to},
+			Data: "From: groups@kubeflow.org\n" +
+				"To: " + to + "\n" +
+				"Subject: Membership changes to ci-team@kubeflow.org\n" +
+				"Content-Type: text/plain; charset=UTF-8\n" +
+				"\n" +
+				strings.Join(lines, "\n"),
+		}
+	}
+
+	cases := []testCase{
+		{
+			name:     "disabled",
+			settings: nil,
+		},
+		{
+			name:     "owners-and-members",
+			settings: &v1alpha1.NotificationSettings{NotifyOwners: true, NotifyMembers: true, Recipients: []string{"admins@kubeflow.org"}},
+			// Owners and recipients get every event; members only their own.
+			expected: []fakeMessage{
+				message("admins@kubeflow.org", added, removed),
+				message("new@acme.com", added),
+				message("old@acme.com", removed),
+				message("owner@acme.com", added, removed),
+			},
+		},
+		{
+			name:     "owners-only",
+			settings: &v1alpha1.NotificationSettings{NotifyOwners: true},
+			expected: []fakeMessage{
+				message("owner@acme.com", added, removed),
+			},
+		},
+	}
+
+	templates, err := NewTemplates(nil)
+	if err != nil {
+		t.Fatalf("NewTemplates returned error; %v", err)
+	}
+
+	for _, c := range cases {
+		server := newFakeSMTPServer(t)
+
+		n := &SMTPNotifier{
+			Addr:      server.listener.Addr().String(),
+			From:      "groups@kubeflow.org",
+			Templates: templates,
+		}
+
+		if err := n.Notify(testChangeSet(c.settings)); err != nil {
+			t.Errorf("Case %v: Notify returned error; %v", c.name, err)
+		}
+
+		server.listener.Close()
+
+		server.mu.Lock()
+		if d := cmp.Diff(c.expected, server.messages); d != "" {
+			t.Errorf("Case %v: messages mismatch (-want +got):\n%s", c.name, d)
+		}
+		server.mu.Unlock()
+	}
+}
+
+func TestReadTemplates(t *testing.T) {
+	f, err := ioutil.TempFile("", "templates*.yaml")
+	if err != nil {
+		t.Fatalf("Could not create temporary file; error %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`MemberAdded: "Welcome {{.Member}}"`)
+	f.Close()
+
+	templates, err := ReadTemplates(f.Name())
+	if err != nil {
+		t.Fatalf("ReadTemplates returned error; %v", err)
+	}
+
+	actual, err := templates.Render(Event{Type: MemberAdded, Member: "new@acme.com"})
+	if err != nil {
+		t.Fatalf("Render returned error; %v", err)
+	}
+
+	if actual != "Welcome new@acme.com" {
+		t.Errorf("Got %v; want %v", actual, "Welcome new@acme.com")
+	}
+
+	if _, err := NewTemplates(map[EventType]string{"Unknown": "x"}); err == nil {
+		t.Errorf("NewTemplates should reject unknown event types")
+	}
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/smtp"
+	"sort"
+	"strings"
+)
+
+// SMTPNotifier emails the changes to the people the group's notification settings ask for.
+type SMTPNotifier struct {
+	// Addr is the address of the SMTP server in the form host:port.
+	Addr string
+	From string
+	// Auth is used to authenticate to the server. It may be nil.
+	Auth      smtp.Auth
+	Templates *Templates
+}
+
+// Notify emails the change set. Each recipient gets their own message so addresses aren't disclosed to the other
+// recipients. Owners and the extra recipients are told about every event; members notified with NotifyMembers
+// only about the events that concern them.
+func (n *SMTPNotifier) Notify(changes *ChangeSet) error {
+	events := Filter(changes)
+	if len(events) == 0 {
+		return nil
+	}
+
+	byRecipient := recipients(changes, events)
+
+	to := []string{}
+	for r := range byRecipient {
+		to = append(to, r)
+	}
+	sort.Strings(to)
+
+	// Keep going if sending to one recipient fails so the others are still notified.
+	failed := []string{}
+	for _, r := range to {
+		if err := n.send(changes, r, byRecipient[r]); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("Error sending %v of %v emails: %v", len(failed), len(to), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// send emails the events to a single recipient.
+func (n *SMTPNotifier) send(changes *ChangeSet, to string, events []Event) error {
+	body, err := n.Templates.RenderAll(events)
+	if err != nil {
+		return err
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %v\r\n", n.From)
+	fmt.Fprintf(msg, "To: %v\r\n", to)
+	fmt.Fprintf(msg, "Subject: Membership changes to %v\r\n", changes.Group.Spec.Email)
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(msg, "\r\n")
+	fmt.Fprintf(msg, "%v\r\n", strings.Replace(body, "\n", "\r\n", -1))
+
+	if err := smtp.SendMail(n.Addr, n.Auth, n.From, []string{to}, msg.Bytes()); err != nil {
+		return errors.Wrapf(err, "Error sending email about %v to %v", changes.Group.Spec.Email, to)
+	}
+	return nil
+}
+
+// recipients returns the events each email address should be told about.
+func recipients(changes *ChangeSet, events []Event) map[string][]Event {
+	settings := changes.Group.Spec.Notifications
+	result := map[string][]Event{}
+
+	if settings.NotifyMembers {
+		for _, e := range events {
+			if e.Member != "" {
+				result[e.Member] = append(result[e.Member], e)
+			}
+		}
+	}
+
+	// Owners and the extra recipients are told about every event; this replaces the member's own events.
+	if settings.NotifyOwners {
+		for _, m := range changes.Group.Spec.Members {
+			// Matches groups.OwnerRole; that package depends on this one so we can't import it.
+			if m.Role == "OWNER" {
+				result[m.Email] = events
+			}
+		}
+	}
+
+	for _, r := range settings.Recipients {
+		result[r] = events
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"bytes"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+	"text/template"
+)
+
+// defaultTemplates are the message templates for each event type.
+// The templates are executed with the Event as the data.
+var defaultTemplates = map[EventType]string{
+	GroupCreated:  "Group {{.Group}} was created.",
+	MemberAdded:   "{{.Member}} was added to {{.Group}} as {{.Role}}.",
+	MemberRemoved: "{{.Member}} was removed from {{.Group}}.",
+}
+
+// Templates renders the message for each event.
+type Templates struct {
+	templates map[EventType]*template.Template
+}
+
+// NewTemplates creates the templates. overrides maps event types to templates that replace the defaults.
+func NewTemplates(overrides map[EventType]string) (*Templates, error) {
+	t := &Templates{
+		templates: map[EventType]*template.Template{},
+	}
+
+	sources := map[EventType]string{}
+	for k, v := range defaultTemplates {
+		sources[k] = v
+	}
+
+	for k, v := range overrides {
+		if _, ok := defaultTemplates[k]; !ok {
+			return nil, errors.Errorf("Unknown event type %v; template can't be overridden", k)
+		}
+		sources[k] = v
+	}
+
+	for k, v := range sources {
+		parsed, err := template.New(string(k)).Parse(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing template for %v", k)
+		}
+		t.templates[k] = parsed
+	}
+	return t, nil
+}
+
+// ReadTemplates reads template overrides from a YAML file mapping event types to templates, e.g.
+//
+//   MemberAdded: "Welcome {{.Member}} to {{.Group}}"
+func ReadTemplates(file string) (*Templates, error) {
+	b, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading notification templates %v", file)
+	}
+
+	overrides := map[EventType]string{}
+	if err := yaml.Unmarshal(b, &overrides); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing notification templates %v", file)
+	}
+
+	return NewTemplates(overrides)
+}
+
+// Render renders the event as a single line message.
+func (t *Templates) Render(e Event) (string, error) {
+	tmpl, ok := t.templates[e.Type]
+
+	if !ok {
+		return "", errors.Errorf("No template for event type %v", e.Type)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, e); err != nil {
+		return "", errors.Wrapf(err, "Error rendering template for %v", e.Type)
+	}
+	return buf.String(), nil
+}
+
+// RenderAll renders the events as a message with one line per event.
+func (t *Templates) RenderAll(events []Event) (string, error) {
+	lines := []string{}
+	for _, e := range events {
+		l, err := t.Render(e)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, l)
+	}
+	return strings.Join(lines, "\n"), nil
+}
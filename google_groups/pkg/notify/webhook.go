@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// WebhookNotifier posts the changes as JSON to a webhook.
+//
+// The payload has a "text" field so it can be used with Slack incoming webhooks. Other consumers can use
+// the structured "group" and "events" fields.
+type WebhookNotifier struct {
+	URL       string
+	Client    *http.Client
+	Templates *Templates
+}
+
+type webhookPayload struct {
+	Text   string         `json:"text"`
+	Group  string         `json:"group"`
+	Events []webhookEvent `json:"events"`
+}
+
+type webhookEvent struct {
+	Type   EventType `json:"type"`
+	Member string    `json:"member,omitempty"`
+	Role   string    `json:"role,omitempty"`
+}
+
+// Notify posts the change set if the group has webhook notifications enabled.
+func (n *WebhookNotifier) Notify(changes *ChangeSet) error {
+	settings := changes.Group.Spec.Notifications
+	if settings == nil || !settings.Webhook {
+		return nil
+	}
+
+	events := Filter(changes)
+	if len(events) == 0 {
+		return nil
+	}
+
+	text, err := n.Templates.RenderAll(events)
+	if err != nil {
+		return err
+	}
+
+	payload := webhookPayload{
+		Text:   text,
+		Group:  changes.Group.Spec.Email,
+		Events: []webhookEvent{},
+	}
+
+	for _, e := range events {
+		payload.Events = append(payload.Events, webhookEvent{
+			Type:   e.Type,
+			Member: e.Member,
+			Role:   e.Role,
+		})
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(n.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrapf(err, "Error posting to webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("Webhook returned status %v: %v", resp.Status, string(body))
+	}
+	return nil
+}
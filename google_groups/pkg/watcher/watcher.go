@@ -0,0 +1,259 @@
+// Package watcher detects changes to the group specs on disk.
+package watcher
+
+import (
+	"bytes"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"github.com/kubeflow/internal-acls/google_groups/pkg/util"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultDebounce is how long to wait for a burst of events to settle before triggering.
+	DefaultDebounce = 2 * time.Second
+
+	// DefaultPollPeriod is how often to check for changes when falling back to polling.
+	DefaultPollPeriod = 30 * time.Second
+)
+
+// Watcher invokes a callback whenever the files matching a glob may have changed.
+//
+// Filesystem events are used when possible. Events are debounced so that a burst of writes,
+// e.g. a git-sync checkout or a ConfigMap update, results in a single callback.
+//
+// git-sync and ConfigMap volumes update their contents by atomically swapping a symlink. The symlink
+// may be the directory containing the files or one of its ancestors. To handle this we watch the directory
+// as well as its ancestors and re-resolve the watches after every burst of events.
+//
+// If filesystem events can't be used (or ForcePolling is set) the watcher falls back to polling and hashing
+// the contents of the matching files.
+type Watcher struct {
+	// Glob matching the files to watch.
+	Glob string
+	// Debounce is how long to wait after the last event before invoking the callback.
+	Debounce time.Duration
+	// PollPeriod is how often to poll for changes when not using filesystem events.
+	PollPeriod time.Duration
+	// ForcePolling disables filesystem events.
+	ForcePolling bool
+	Log          logr.Logger
+}
+
+// Run watches for changes until stop is closed. onChange is called after every debounced change.
+func (w *Watcher) Run(stop <-chan struct{}, onChange func()) error {
+	if w.Debounce == 0 {
+		w.Debounce = DefaultDebounce
+	}
+
+	if w.PollPeriod == 0 {
+		w.PollPeriod = DefaultPollPeriod
+	}
+
+	if w.ForcePolling {
+		w.Log.Info("Polling for changes", "glob", w.Glob, "period", w.PollPeriod)
+		return w.poll(stop, onChange)
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		w.Log.Error(err, "Could not create filesystem watcher; falling back to polling", "glob", w.Glob)
+		return w.poll(stop, onChange)
+	}
+
+	defer fsWatcher.Close()
+
+	watched, err := w.addWatches(fsWatcher, map[string]bool{})
+
+	if err != nil {
+		w.Log.Error(err, "Could not watch directory; falling back to polling", "glob", w.Glob)
+		return w.poll(stop, onChange)
+	}
+
+	w.Log.Info("Watching for filesystem events", "glob", w.Glob, "dirs", keys(watched))
+
+	// The timer is only armed once an event is received.
+	timer := time.NewTimer(w.Debounce)
+	stopTimer(timer)
+
+	for {
+		select {
+		case <-stop:
+			timer.Stop()
+			return nil
+		case e, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if !w.isRelevant(e) {
+				continue
+			}
+
+			w.Log.V(1).Info("Filesystem event", "event", e.String())
+			stopTimer(timer)
+			timer.Reset(w.Debounce)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			// Errors such as an event queue overflow mean we may have missed changes so we trigger a sync.
+			w.Log.Error(err, "Filesystem watcher reported an error", "glob", w.Glob)
+			stopTimer(timer)
+			timer.Reset(w.Debounce)
+		case <-timer.C:
+			// The directory we are watching may have been swapped out from under us.
+			watched, err = w.addWatches(fsWatcher, watched)
+
+			if err != nil {
+				w.Log.Error(err, "Could not update watches; falling back to polling", "glob", w.Glob)
+				onChange()
+				return w.poll(stop, onChange)
+			}
+
+			onChange()
+		}
+	}
+}
+
+// watchDirs returns the directories to watch. This is the directory containing the glob and all its ancestors.
+func (w *Watcher) watchDirs() ([]string, error) {
+	dir, err := filepath.Abs(filepath.Dir(w.Glob))
+
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{}
+
+	for {
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs, nil
+		}
+		dir = parent
+	}
+}
+
+// isRelevant returns true if the event could affect the files matching the glob.
+func (w *Watcher) isRelevant(e fsnotify.Event) bool {
+	dirs, err := w.watchDirs()
+
+	if err != nil {
+		return true
+	}
+
+	eventDir := filepath.Dir(e.Name)
+
+	// Any change inside the directory is relevant. ConfigMap volumes update the files by swapping
+	// a "..data" symlink which won't match the glob.
+	if eventDir == dirs[0] {
+		return true
+	}
+
+	// Changes in an ancestor are only relevant if they touch the path leading to the directory.
+	for i := 1; i < len(dirs); i++ {
+		if eventDir == dirs[i] {
+			return e.Name == dirs[i-1]
+		}
+	}
+	return false
+}
+
+// addWatches ensures all the directories returned by watchDirs are watched.
+//
+// The directories are removed and re-added because inotify resolves symlinks when the watch is added.
+// If a symlink has been swapped the old watch would point at the stale target.
+func (w *Watcher) addWatches(fsWatcher *fsnotify.Watcher, watched map[string]bool) (map[string]bool, error) {
+	dirs, err := w.watchDirs()
+
+	if err != nil {
+		return watched, err
+	}
+
+	for d := range watched {
+		// Ignore the error; the directory may no longer exist.
+		fsWatcher.Remove(d)
+	}
+
+	newWatched := map[string]bool{}
+
+	for i, d := range dirs {
+		if err := fsWatcher.Add(d); err != nil {
+			// The directory containing the glob must be watchable; ancestors are best effort
+			// since we might not have permission to read them.
+			if i == 0 {
+				return newWatched, err
+			}
+			w.Log.V(1).Info("Could not watch ancestor directory", "dir", d, "error", err.Error())
+			continue
+		}
+		newWatched[d] = true
+	}
+	return newWatched, nil
+}
+
+// poll periodically hashes the matching files and calls onChange when the hash changes.
+func (w *Watcher) poll(stop <-chan struct{}, onChange func()) error {
+	lastHash, err := w.hash()
+
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.PollPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			newHash, err := w.hash()
+
+			if err != nil {
+				w.Log.Error(err, "Could not compute hash of files", "glob", w.Glob)
+				continue
+			}
+
+			if bytes.Equal(newHash, lastHash) {
+				continue
+			}
+
+			lastHash = newHash
+			onChange()
+		}
+	}
+}
+
+func (w *Watcher) hash() ([]byte, error) {
+	matches, err := filepath.Glob(w.Glob)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return util.ContentHash(matches)
+}
+
+func keys(m map[string]bool) []string {
+	r := []string{}
+	for k := range m {
+		r = append(r, k)
+	}
+	return r
+}
+
+// stopTimer stops the timer and drains its channel so a tick that fired before it was stopped isn't received after
+// the timer is reset.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
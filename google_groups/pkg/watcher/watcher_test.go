@@ -0,0 +1,172 @@
+package watcher
+
+import (
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// runWatcher starts the watcher and returns a channel which receives a value on every callback.
+func runWatcher(t *testing.T, w *Watcher) (chan struct{}, func()) {
+	changes := make(chan struct{}, 10)
+	stop := make(chan struct{})
+
+	go func() {
+		err := w.Run(stop, func() {
+			changes <- struct{}{}
+		})
+
+		if err != nil {
+			t.Errorf("Run returned error; %v", err)
+		}
+	}()
+
+	// Give the watcher time to add its watches.
+	time.Sleep(100 * time.Millisecond)
+	return changes, func() { close(stop) }
+}
+
+// countChanges counts the callbacks received within the given period.
+func countChanges(changes chan struct{}, period time.Duration) int {
+	n := 0
+	timeout := time.After(period)
+	for {
+		select {
+		case <-changes:
+			n++
+		case <-timeout:
+			return n
+		}
+	}
+}
+
+func writeFile(t *testing.T, name string, contents string) {
+	if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+		t.Fatalf("Could not write %v; error %v", name, err)
+	}
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watcherTestDebounce")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := &Watcher{
+		Glob:     filepath.Join(dir, "*.yaml"),
+		Debounce: 200 * time.Millisecond,
+		Log:      zapr.NewLogger(zap.L()),
+	}
+
+	changes, stop := runWatcher(t, w)
+	defer stop()
+
+	// A burst of writes should produce a single callback.
+	for i := 0; i < 5; i++ {
+		writeFile(t, filepath.Join(dir, "a.yaml"), time.Now().String())
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if n := countChanges(changes, time.Second); n != 1 {
+		t.Errorf("Got %v callbacks; want 1", n)
+	}
+
+	// Files not matching the glob are still relevant since ConfigMaps swap a "..data" symlink.
+	writeFile(t, filepath.Join(dir, "..data"), "data")
+
+	if n := countChanges(changes, time.Second); n != 1 {
+		t.Errorf("Got %v callbacks; want 1", n)
+	}
+}
+
+func TestWatcherPolling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watcherTestPolling")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "a.yaml"), "a")
+
+	w := &Watcher{
+		Glob:         filepath.Join(dir, "*.yaml"),
+		PollPeriod:   100 * time.Millisecond,
+		ForcePolling: true,
+		Log:          zapr.NewLogger(zap.L()),
+	}
+
+	changes, stop := runWatcher(t, w)
+	defer stop()
+
+	if n := countChanges(changes, 300*time.Millisecond); n != 0 {
+		t.Errorf("Unchanged files: Got %v callbacks; want 0", n)
+	}
+
+	// Write the file atomically so a poll can't observe a partially written file.
+	writeFile(t, filepath.Join(dir, "a.yaml.tmp"), "b")
+	if err := os.Rename(filepath.Join(dir, "a.yaml.tmp"), filepath.Join(dir, "a.yaml")); err != nil {
+		t.Fatalf("Could not rename file; error %v", err)
+	}
+
+	if n := countChanges(changes, 300*time.Millisecond); n != 1 {
+		t.Errorf("Modified file: Got %v callbacks; want 1", n)
+	}
+}
+
+func TestWatcherSymlinkSwap(t *testing.T) {
+	// Simulate git-sync which checks out each revision into a new directory and then
+	// atomically swaps a symlink to point at it.
+	root, err := ioutil.TempDir("", "watcherTestSymlink")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory; %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	checkout := func(rev string) {
+		revDir := filepath.Join(root, "rev-"+rev)
+		if err := os.MkdirAll(filepath.Join(revDir, "groups"), 0755); err != nil {
+			t.Fatalf("Could not create %v; error %v", revDir, err)
+		}
+		writeFile(t, filepath.Join(revDir, "groups", "a.yaml"), rev)
+
+		tmpLink := filepath.Join(root, "tmp-link")
+		if err := os.Symlink(revDir, tmpLink); err != nil {
+			t.Fatalf("Could not create symlink; error %v", err)
+		}
+		if err := os.Rename(tmpLink, filepath.Join(root, "repo")); err != nil {
+			t.Fatalf("Could not swap symlink; error %v", err)
+		}
+	}
+
+	checkout("1")
+
+	w := &Watcher{
+		Glob:     filepath.Join(root, "repo", "groups", "*.yaml"),
+		Debounce: 100 * time.Millisecond,
+		Log:      zapr.NewLogger(zap.L()),
+	}
+
+	changes, stop := runWatcher(t, w)
+	defer stop()
+
+	// Swap twice to verify the watches are re-established after the first swap.
+	for _, rev := range []string{"2", "3"} {
+		checkout(rev)
+
+		if n := countChanges(changes, 500*time.Millisecond); n != 1 {
+			t.Errorf("Checkout %v: Got %v callbacks; want 1", rev, n)
+		}
+	}
+
+	// Changes to files in the directory should still be detected after the swap.
+	writeFile(t, filepath.Join(root, "repo", "groups", "b.yaml"), "b")
+
+	if n := countChanges(changes, 500*time.Millisecond); n != 1 {
+		t.Errorf("Write after swap: Got %v callbacks; want 1", n)
+	}
+}